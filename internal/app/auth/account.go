@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// PasswordResetPrefix marks the one-time password reset tokens
+	PasswordResetPrefix = "rt_"
+	// passwordResetExpiry is how long a password reset token is valid
+	passwordResetExpiry = 24 * time.Hour
+	// reauthMaxAge is how recently the users without a password must have logged in to confirm the deletion
+	reauthMaxAge = 5 * time.Minute
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrReauthRequired    = errors.New("log in again to confirm")
+)
+
+// GetUser gets a user by the credit.
+func (s *AuthService) GetUser(userCredit string) (*dao.User, error) {
+	users, err := s.userMapper.Select(&dao.User{Credit: userCredit})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) != 1 {
+		return nil, errors.New("user not found")
+	}
+	return users[0], nil
+}
+
+// UpdateDisplayName changes the display name of the user.
+func (s *AuthService) UpdateDisplayName(userCredit, displayName string) error {
+	if len(displayName) > 64 {
+		return errors.New("display name is too long")
+	}
+	_, err := s.userMapper.UpdateColumns(&dao.User{Credit: userCredit}, map[string]interface{}{
+		"display_name": displayName,
+		"update_at":    time.Now(),
+	})
+	if err != nil {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+// DeleteAccount deletes the user along with the subscriptions and personal data, the password is required to
+// confirm the deletion. The users provisioned by OIDC have no password, they confirm by a session of the jti logged
+// in with the provider just now instead.
+func (s *AuthService) DeleteAccount(userCredit, password, jti string) error {
+	user, err := s.GetUser(userCredit)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash == oidcPasswordHash {
+		if !s.isFreshSession(userCredit, jti) {
+			return ErrReauthRequired
+		}
+	} else if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return errors.New("invalid password")
+	}
+	sessions, err := s.sessionMapper.Select(&dao.Session{UserCredit: user.Credit})
+	if err != nil {
+		return err
+	}
+	if err := s.userMapper.DeleteCascade(user); err != nil {
+		return err
+	}
+	// the sessions are deleted along with the user, reject their tokens without waiting for the cache to expire
+	for _, session := range sessions {
+		s.sessions.set(session.JTI, false)
+	}
+	for _, hook := range s.accountDeletedHooks {
+		if err := hook(user.Credit); err != nil {
+			log.Errorf("failed to clean up after deleting user %s, err:%v", user.Credit, err)
+		}
+	}
+	return nil
+}
+
+// OnAccountDeleted registers a hook to clean up the data of the user kept by the other services, e.g. the contents
+// imported by the user, after the account is deleted.
+func (s *AuthService) OnAccountDeleted(hook func(userCredit string) error) {
+	s.accountDeletedHooks = append(s.accountDeletedHooks, hook)
+}
+
+// isFreshSession checks if the session of the jti is the user's and logged in within the reauthMaxAge.
+func (s *AuthService) isFreshSession(userCredit, jti string) bool {
+	if jti == "" {
+		return false
+	}
+	sessions, err := s.sessionMapper.Select(&dao.Session{JTI: jti, UserCredit: userCredit})
+	if err != nil || len(sessions) != 1 {
+		return false
+	}
+	return !sessions[0].Revoked && sessions[0].CreateAt.After(time.Now().Add(-reauthMaxAge))
+}
+
+// CreatePasswordReset issues a one-time token for the user to reset the password, the unused tokens issued before
+// are invalidated. The token is handed over to the user by the admin, no email is sent.
+func (s *AuthService) CreatePasswordReset(username string) (string, time.Time, error) {
+	users, err := s.userMapper.Select(&dao.User{Name: username})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if len(users) != 1 {
+		return "", time.Time{}, errors.New("user not found")
+	}
+	user := users[0]
+	if _, err := s.passwordResetMapper.ExecBySQL("UPDATE t_password_reset SET used = ?, update_at = ? WHERE user_credit = ? AND used = ?",
+		true, time.Now(), user.Credit, false); err != nil {
+		return "", time.Time{}, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	token := PasswordResetPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	reset := &dao.PasswordReset{
+		UserCredit: user.Credit,
+		TokenHash:  hashToken(token),
+		ExpireAt:   time.Now().Add(passwordResetExpiry),
+		CreateAt:   time.Now(),
+		UpdateAt:   time.Now(),
+	}
+	if _, err := s.passwordResetMapper.Insert(reset); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, reset.ExpireAt, nil
+}
+
+// ResetPassword sets the new password with a password reset token and revokes all the sessions of the user, the
+// token can only be used once.
+func (s *AuthService) ResetPassword(token, newPassword string) error {
+	if token == "" || newPassword == "" {
+		return ErrInvalidResetToken
+	}
+	resets, err := s.passwordResetMapper.Select(&dao.PasswordReset{TokenHash: hashToken(token)})
+	if err != nil {
+		return err
+	}
+	if len(resets) != 1 {
+		return ErrInvalidResetToken
+	}
+	reset := resets[0]
+	affected, err := s.passwordResetMapper.ExecBySQL("UPDATE t_password_reset SET used = ?, update_at = ? WHERE id = ? AND used = ? AND expire_at > ?",
+		true, time.Now(), reset.ID, false, time.Now())
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInvalidResetToken
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	_, err = s.userMapper.UpdateColumns(&dao.User{Credit: reset.UserCredit}, map[string]interface{}{
+		"password_hash": string(hashedPassword),
+		"update_at":     time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	// log out everywhere, the old password may be known by someone else
+	return s.RevokeOtherSessions(reset.UserCredit, "")
+}
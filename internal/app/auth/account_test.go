@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+)
+
+func TestAuthService_DeleteAccount(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{
+			name:     "Valid password",
+			password: "password",
+			wantErr:  false,
+		},
+		{
+			name:     "Invalid password",
+			password: "wrongpassword",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := MockAuthService()
+			teardownTest := setupTest(t, s)
+			defer teardownTest(t)
+			if _, _, err := s.CreateAPIToken("validUser1", "podcast app", []string{ScopeRead}); err != nil {
+				t.Fatalf("AuthService.CreateAPIToken() error = %v", err)
+			}
+			subscriptionMapper, err := dao.NewSubscriptionMapper(s.userMapper.DatabaseSource)
+			if err != nil {
+				t.Fatalf("NewSubscriptionMapper() error = %v", err)
+			}
+			if _, err := subscriptionMapper.Insert(&dao.Subscription{UserCredit: "validUser1", ChannelCredit: "channel1"}); err != nil {
+				t.Fatalf("Failed to insert subscription: %v", err)
+			}
+
+			if err := s.CreateSession("validUser1", "jti1", "device", "127.0.0.1", time.Now().Add(time.Hour)); err != nil {
+				t.Fatalf("AuthService.CreateSession() error = %v", err)
+			}
+			var deleted []string
+			s.OnAccountDeleted(func(userCredit string) error {
+				deleted = append(deleted, userCredit)
+				return nil
+			})
+
+			err = s.DeleteAccount("validUser1", tt.password, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AuthService.DeleteAccount() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			users, _ := s.userMapper.Select(&dao.User{Credit: "validUser1"})
+			tokens, _ := s.ListAPITokens("validUser1")
+			subscriptions, _ := subscriptionMapper.Select(&dao.Subscription{UserCredit: "validUser1"})
+			wantLeft := 0
+			if tt.wantErr {
+				wantLeft = 1
+			}
+			if len(users) != wantLeft || len(tokens) != wantLeft || len(subscriptions) != wantLeft {
+				t.Errorf("AuthService.DeleteAccount() left %d users, %d tokens, %d subscriptions, want %d",
+					len(users), len(tokens), len(subscriptions), wantLeft)
+			}
+			if s.IsSessionActive("jti1") != tt.wantErr {
+				t.Errorf("AuthService.IsSessionActive() = %v after the deletion, want %v", !tt.wantErr, tt.wantErr)
+			}
+			if len(deleted) != 1-wantLeft {
+				t.Errorf("AuthService.DeleteAccount() called the hooks for %v", deleted)
+			}
+		})
+	}
+}
+
+func TestAuthService_DeleteAccountOIDC(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	tests := []struct {
+		name     string
+		loggedIn time.Duration // how long ago the session logged in
+		jti      string
+		wantErr  error
+	}{
+		{
+			name:     "Fresh session",
+			loggedIn: time.Minute,
+			jti:      "fresh",
+			wantErr:  nil,
+		},
+		{
+			name:     "Stale session",
+			loggedIn: time.Hour,
+			jti:      "fresh",
+			wantErr:  ErrReauthRequired,
+		},
+		{
+			name:     "Missing session",
+			loggedIn: time.Minute,
+			jti:      "",
+			wantErr:  ErrReauthRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := MockAuthService()
+			teardownTest := setupTest(t, s)
+			defer teardownTest(t)
+			if _, err := s.userMapper.Insert(&dao.User{Name: "oidcUser", Credit: "oidcUser", PasswordHash: oidcPasswordHash}); err != nil {
+				t.Fatalf("Failed to insert user: %v", err)
+			}
+			if _, err := s.sessionMapper.Insert(&dao.Session{
+				JTI:        "fresh",
+				UserCredit: "oidcUser",
+				ExpireAt:   time.Now().Add(time.Hour),
+				CreateAt:   time.Now().Add(-tt.loggedIn),
+			}); err != nil {
+				t.Fatalf("Failed to insert session: %v", err)
+			}
+
+			if err := s.DeleteAccount("oidcUser", "", tt.jti); err != tt.wantErr {
+				t.Errorf("AuthService.DeleteAccount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthService_ResetPassword(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockAuthService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+
+	replaced, _, err := s.CreatePasswordReset("TestUser")
+	if err != nil {
+		t.Fatalf("AuthService.CreatePasswordReset() error = %v", err)
+	}
+	token, expireAt, err := s.CreatePasswordReset("TestUser")
+	if err != nil {
+		t.Fatalf("AuthService.CreatePasswordReset() error = %v", err)
+	}
+	if expireAt.Before(time.Now()) {
+		t.Errorf("AuthService.CreatePasswordReset() expireAt = %v", expireAt)
+	}
+	if _, _, err := s.CreatePasswordReset("NonExistentUser"); err == nil {
+		t.Errorf("AuthService.CreatePasswordReset() error = nil for non-existent user, want error")
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:    "Replaced token",
+			token:   replaced,
+			wantErr: true,
+		},
+		{
+			name:    "Valid token",
+			token:   token,
+			wantErr: false,
+		},
+		{
+			name:    "Used token",
+			token:   token,
+			wantErr: true,
+		},
+		{
+			name:    "Unknown token",
+			token:   PasswordResetPrefix + "unknown",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.ResetPassword(tt.token, "newpassword"); (err != nil) != tt.wantErr {
+				t.Errorf("AuthService.ResetPassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := s.Authenticate("TestUser", "newpassword"); err != nil {
+		t.Errorf("AuthService.Authenticate() with the reset password error = %v", err)
+	}
+}
+
+func TestAuthService_UpdateDisplayName(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockAuthService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+
+	if err := s.UpdateDisplayName("validUser1", "Test User"); err != nil {
+		t.Fatalf("AuthService.UpdateDisplayName() error = %v", err)
+	}
+	if user, err := s.GetUser("validUser1"); err != nil || user.DisplayName != "Test User" {
+		t.Errorf("AuthService.GetUser() = %v, error = %v", user, err)
+	}
+	if err := s.UpdateDisplayName("NonExistentUser", "Test User"); err == nil {
+		t.Errorf("AuthService.UpdateDisplayName() error = nil for non-existent user, want error")
+	}
+}
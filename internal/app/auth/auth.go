@@ -2,9 +2,13 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -12,10 +16,10 @@ import (
 type Authenticator interface {
 	// Authenticate authenticates the user
 	Authenticate(username, password string) (*dao.User, error)
-	// Register registers a new user
-	Register(username, password string) error
-	// ChangePassword changes the password of the user
-	ChangePassword(username, oldPassword, newPassword string) error
+	// Register registers a new user with the invite code
+	Register(username, password, inviteCode string) error
+	// ChangePassword changes the password of the user, and revokes the other sessions
+	ChangePassword(username, oldPassword, newPassword, currentJTI string) error
 }
 
 // Authorize checks if the user is authorized to perform the action
@@ -25,13 +29,58 @@ type Authorizer interface {
 }
 
 type AuthService struct {
-	userMapper *dao.UserMapper
+	userMapper             *dao.UserMapper
+	apiTokenMapper         *dao.APITokenMapper
+	inviteCodeMapper       *dao.InviteCodeMapper
+	inviteRedemptionMapper *dao.InviteRedemptionMapper
+	passwordResetMapper    *dao.PasswordResetMapper
+	sessionMapper          *dao.SessionMapper
+	sessions               *sessionCache
+	loginFailureMapper     *dao.LoginFailureMapper
+	loginPolicy            loginPolicy
+	userIdentityMapper     *dao.UserIdentityMapper
+	oidcStateMapper        *dao.OIDCStateMapper
+	oidc                   *oidcProvider // nil if the oidc login is disabled
+	registration           conf.RegistrationMode
+	admins                 []string
+	accountDeletedHooks    []func(userCredit string) error
 }
 
-func NewAuthService(mapper *dao.UnionMapper) (*AuthService, error) {
-	return &AuthService{
-		userMapper: mapper.UserMapper,
-	}, nil
+func NewAuthService(mapper *dao.UnionMapper, config *conf.AuthConfig) (*AuthService, error) {
+	s := &AuthService{
+		userMapper:             mapper.UserMapper,
+		apiTokenMapper:         mapper.APITokenMapper,
+		inviteCodeMapper:       mapper.InviteCodeMapper,
+		inviteRedemptionMapper: mapper.InviteRedemptionMapper,
+		passwordResetMapper:    mapper.PasswordResetMapper,
+		sessionMapper:          mapper.SessionMapper,
+		sessions:               newSessionCache(),
+		loginFailureMapper:     mapper.LoginFailureMapper,
+		loginPolicy:            newLoginPolicy(nil),
+		userIdentityMapper:     mapper.UserIdentityMapper,
+		oidcStateMapper:        mapper.OIDCStateMapper,
+		registration:           conf.InviteRegistration,
+	}
+	if config != nil {
+		if config.Registration != "" {
+			s.registration = config.Registration
+		}
+		s.admins = config.Admins
+		s.loginPolicy = newLoginPolicy(config.LoginLimitConfig)
+		if config.OIDCConfig != nil && config.OIDCConfig.Enable {
+			oidc, err := newOIDCProvider(config.OIDCConfig)
+			if err != nil {
+				return nil, err
+			}
+			s.oidc = oidc
+		}
+	}
+	switch s.registration {
+	case conf.InviteRegistration, conf.OpenRegistration, conf.ClosedRegistration:
+	default:
+		return nil, fmt.Errorf("unknown registration mode %s", s.registration)
+	}
+	return s, nil
 }
 
 // Authenticate authenticates the user
@@ -44,15 +93,19 @@ func (s *AuthService) Authenticate(username, password string) (*dao.User, error)
 		return nil, errors.New("invalid user or password")
 	}
 	user := users[0]
-	err = bcrypt.CompareHashAndPassword([]byte(user.Credit), []byte(password))
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	if err != nil {
 		return nil, errors.New("invalid user or password")
 	}
 	return user, nil
 }
 
-// Register registers a new user
-func (s *AuthService) Register(username, password string) error {
+// Register registers a new user, an invite code is required in the invite mode unless it's the first user, who is
+// bootstrapped as admin.
+func (s *AuthService) Register(username, password, inviteCode string) error {
+	if s.registration == conf.ClosedRegistration {
+		return errors.New("registration is disabled")
+	}
 	users, err := s.userMapper.Select(&dao.User{Name: username})
 	if err != nil {
 		return err
@@ -60,22 +113,62 @@ func (s *AuthService) Register(username, password string) error {
 	if len(users) > 0 {
 		return errors.New("user already exists")
 	}
+	first, err := s.isFirstUser()
+	if err != nil {
+		return err
+	}
+	var invite *dao.InviteCode
+	if s.registration == conf.InviteRegistration && !first {
+		if invite, err = s.redeemInviteCode(inviteCode); err != nil {
+			return err
+		}
+	}
+	// the first user is bootstrapped as admin
+	role := dao.UserRoleMember
+	if first {
+		role = dao.UserRoleAdmin
+	}
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
 	user := &dao.User{
-		Name:     username,
-		Credit:   string(hashedPassword),
-		CreateAt: time.Now(),
-		UpdateAt: time.Now(),
+		Name:         username,
+		Credit:       uuid.NewString(),
+		PasswordHash: string(hashedPassword),
+		Role:         role,
+		CreateAt:     time.Now(),
+		UpdateAt:     time.Now(),
+	}
+	if _, err = s.userMapper.Insert(user); err != nil {
+		// the use is not burnt by the failed registration, e.g. the user name is taken concurrently
+		if invite != nil {
+			s.releaseInviteCode(invite)
+		}
+		return err
+	}
+	if invite != nil {
+		_, err = s.inviteRedemptionMapper.Insert(&dao.InviteRedemption{
+			InviteCodeID: invite.ID,
+			UserCredit:   user.Credit,
+			UserName:     user.Name,
+			CreateAt:     time.Now(),
+		})
 	}
-	_, err = s.userMapper.Insert(user)
 	return err
 }
 
-// ChangePassword changes the password of the user
-func (s *AuthService) ChangePassword(username, oldPassword, newPassword string) error {
+func (s *AuthService) isFirstUser() (bool, error) {
+	users, err := s.userMapper.SelectWithPage(&dao.User{}, &db.Pagenation{PageIndex: 0, PageSize: 1})
+	if err != nil {
+		return false, err
+	}
+	return len(users) == 0, nil
+}
+
+// ChangePassword changes the password of the user, and revokes all the sessions of the user except the current one,
+// so that a stolen session does not survive the change.
+func (s *AuthService) ChangePassword(username, oldPassword, newPassword, currentJTI string) error {
 	users, err := s.userMapper.Select(&dao.User{Name: username})
 	if err != nil {
 		return err
@@ -84,7 +177,7 @@ func (s *AuthService) ChangePassword(username, oldPassword, newPassword string)
 		return errors.New("user not found")
 	}
 	user := users[0]
-	err = bcrypt.CompareHashAndPassword([]byte(user.Credit), []byte(oldPassword))
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword))
 	if err != nil {
 		return errors.New("invalid old password")
 	}
@@ -92,8 +185,10 @@ func (s *AuthService) ChangePassword(username, oldPassword, newPassword string)
 	if err != nil {
 		return err
 	}
-	user.Credit = string(hashedPassword)
+	user.PasswordHash = string(hashedPassword)
 	user.UpdateAt = time.Now()
-	_, err = s.userMapper.Update(&dao.User{ID: user.ID}, user)
-	return err
+	if _, err = s.userMapper.Update(&dao.User{ID: user.ID}, user); err != nil {
+		return err
+	}
+	return s.RevokeOtherSessions(user.Credit, currentJTI)
 }
\ No newline at end of file
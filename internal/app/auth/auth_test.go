@@ -33,10 +33,11 @@ func setupSuite(t *testing.T) func(t *testing.T) {
 func setupTest(t *testing.T, s *AuthService) func(t *testing.T) {
 	// Insert initial entities
 	user := &dao.User{
-		Credit:   "$2a$10$P/2om2cYvUSHBBwmjZqm5OVc4vR96zYmz5bxYf5u6126ziHVD7py.", // bcrypt hash for "password"
-		Name:     "TestUser",
-		CreateAt: fixedTime,
-		UpdateAt: fixedTime,
+		Credit:       "validUser1",
+		PasswordHash: "$2a$10$P/2om2cYvUSHBBwmjZqm5OVc4vR96zYmz5bxYf5u6126ziHVD7py.", // bcrypt hash for "password"
+		Name:         "TestUser",
+		CreateAt:     fixedTime,
+		UpdateAt:     fixedTime,
 	}
 	_, err := s.userMapper.Insert(user)
 	if err != nil {
@@ -65,7 +66,10 @@ func MockAuthService() *AuthService {
 		panic(err)
 	}
 
-	authService, err := NewAuthService(unionMapper)
+	authService, err := NewAuthService(unionMapper, &conf.AuthConfig{
+		Registration: conf.OpenRegistration,
+		Admins:       []string{"TestUser"},
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -155,7 +159,7 @@ func TestAuthService_Register(t *testing.T) {
 			teardownTest := setupTest(t, s)
 			defer teardownTest(t)
 
-			if err := s.Register(tt.username, tt.password); (err != nil) != tt.wantErr {
+			if err := s.Register(tt.username, tt.password, ""); (err != nil) != tt.wantErr {
 				t.Errorf("AuthService.Register() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -202,9 +206,19 @@ func TestAuthService_ChangePassword(t *testing.T) {
 			teardownTest := setupTest(t, s)
 			defer teardownTest(t)
 
-			if err := s.ChangePassword(tt.username, tt.oldPassword, tt.newPassword); (err != nil) != tt.wantErr {
+			for _, jti := range []string{"current", "other"} {
+				if err := s.CreateSession("validUser1", jti, "device", "127.0.0.1", time.Now().Add(time.Hour)); err != nil {
+					t.Fatalf("AuthService.CreateSession() error = %v", err)
+				}
+			}
+
+			if err := s.ChangePassword(tt.username, tt.oldPassword, tt.newPassword, "current"); (err != nil) != tt.wantErr {
 				t.Errorf("AuthService.ChangePassword() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			// the other sessions are revoked once the password is changed
+			if !s.IsSessionActive("current") || s.IsSessionActive("other") == !tt.wantErr {
+				t.Errorf("AuthService.ChangePassword() sessions current = %v, other = %v", s.IsSessionActive("current"), s.IsSessionActive("other"))
+			}
 		})
 	}
 }
\ No newline at end of file
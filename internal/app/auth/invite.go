@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrInvalidInviteCode = errors.New("invalid invite code")
+
+// CreateInviteCode creates an invite code which can be redeemed maxUses times before it expires.
+func (s *AuthService) CreateInviteCode(creatorCredit string, maxUses int, expiry time.Duration) (*dao.InviteCode, error) {
+	if maxUses <= 0 {
+		return nil, errors.New("max uses must be positive")
+	}
+	if expiry <= 0 {
+		return nil, errors.New("expiry must be positive")
+	}
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	invite := &dao.InviteCode{
+		Code:          base32.StdEncoding.EncodeToString(buf),
+		CreatorCredit: creatorCredit,
+		MaxUses:       maxUses,
+		ExpireAt:      time.Now().Add(expiry),
+		CreateAt:      time.Now(),
+		UpdateAt:      time.Now(),
+	}
+	if _, err := s.inviteCodeMapper.Insert(invite); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// ListInviteCodes lists all the invite codes with their redemptions.
+func (s *AuthService) ListInviteCodes() ([]*dao.InviteCode, map[uint][]*dao.InviteRedemption, error) {
+	invites, err := s.inviteCodeMapper.Select(&dao.InviteCode{})
+	if err != nil {
+		return nil, nil, err
+	}
+	redemptions, err := s.inviteRedemptionMapper.Select(&dao.InviteRedemption{})
+	if err != nil {
+		return nil, nil, err
+	}
+	redemptionMap := make(map[uint][]*dao.InviteRedemption)
+	for _, redemption := range redemptions {
+		redemptionMap[redemption.InviteCodeID] = append(redemptionMap[redemption.InviteCodeID], redemption)
+	}
+	return invites, redemptionMap, nil
+}
+
+// RevokeInviteCode stops the invite code from being redeemed, the users registered with it are kept.
+func (s *AuthService) RevokeInviteCode(code string) error {
+	if code == "" {
+		return ErrInvalidInviteCode
+	}
+	_, err := s.inviteCodeMapper.UpdateColumns(&dao.InviteCode{Code: code}, map[string]interface{}{
+		"revoked":   true,
+		"update_at": time.Now(),
+	})
+	if err != nil {
+		return ErrInvalidInviteCode
+	}
+	return nil
+}
+
+// redeemInviteCode consumes one use of the invite code, the conditional update makes sure the code is not
+// redeemed more than its max uses by the concurrent registrations.
+func (s *AuthService) redeemInviteCode(code string) (*dao.InviteCode, error) {
+	if code == "" {
+		return nil, ErrInvalidInviteCode
+	}
+	invites, err := s.inviteCodeMapper.Select(&dao.InviteCode{Code: code})
+	if err != nil {
+		return nil, err
+	}
+	if len(invites) != 1 {
+		return nil, ErrInvalidInviteCode
+	}
+	invite := invites[0]
+	affected, err := s.inviteCodeMapper.ExecBySQL(
+		"UPDATE t_invite_code SET used_count = used_count + 1, update_at = ? "+
+			"WHERE id = ? AND revoked = ? AND used_count < max_uses AND expire_at > ?",
+		time.Now(), invite.ID, false, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrInvalidInviteCode
+	}
+	return invite, nil
+}
+
+// releaseInviteCode gives back the use of the invite code consumed by a registration which failed afterwards.
+func (s *AuthService) releaseInviteCode(invite *dao.InviteCode) {
+	if _, err := s.inviteCodeMapper.ExecBySQL(
+		"UPDATE t_invite_code SET used_count = used_count - 1, update_at = ? WHERE id = ? AND used_count > 0",
+		time.Now(), invite.ID); err != nil {
+		log.Errorf("failed to release invite code %s, err:%v", invite.Code, err)
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+)
+
+func TestAuthService_RegisterWithInviteCode(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockAuthService()
+	s.registration = conf.InviteRegistration
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+
+	twice, err := s.CreateInviteCode("validUser1", 2, time.Hour)
+	if err != nil {
+		t.Fatalf("AuthService.CreateInviteCode() error = %v", err)
+	}
+	expired, err := s.CreateInviteCode("validUser1", 1, time.Hour)
+	if err != nil {
+		t.Fatalf("AuthService.CreateInviteCode() error = %v", err)
+	}
+	if _, err := s.inviteCodeMapper.UpdateColumns(&dao.InviteCode{ID: expired.ID}, map[string]interface{}{
+		"expire_at": time.Now().Add(-time.Minute),
+	}); err != nil {
+		t.Fatalf("Failed to expire invite code: %v", err)
+	}
+	revoked, err := s.CreateInviteCode("validUser1", 1, time.Hour)
+	if err != nil {
+		t.Fatalf("AuthService.CreateInviteCode() error = %v", err)
+	}
+	if err := s.RevokeInviteCode(revoked.Code); err != nil {
+		t.Fatalf("AuthService.RevokeInviteCode() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		username   string
+		inviteCode string
+		wantErr    bool
+	}{
+		{
+			name:       "Valid invite code",
+			username:   "NewUser1",
+			inviteCode: twice.Code,
+			wantErr:    false,
+		},
+		{
+			name:       "Invite code used once",
+			username:   "NewUser2",
+			inviteCode: twice.Code,
+			wantErr:    false,
+		},
+		{
+			name:       "Invite code used up",
+			username:   "NewUser3",
+			inviteCode: twice.Code,
+			wantErr:    true,
+		},
+		{
+			name:       "Expired invite code",
+			username:   "NewUser3",
+			inviteCode: expired.Code,
+			wantErr:    true,
+		},
+		{
+			name:       "Revoked invite code",
+			username:   "NewUser3",
+			inviteCode: revoked.Code,
+			wantErr:    true,
+		},
+		{
+			name:       "Missing invite code",
+			username:   "NewUser3",
+			inviteCode: "",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Register(tt.username, "password", tt.inviteCode); (err != nil) != tt.wantErr {
+				t.Errorf("AuthService.Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	invites, redemptions, err := s.ListInviteCodes()
+	if err != nil || len(invites) != 3 {
+		t.Fatalf("AuthService.ListInviteCodes() = %v, error = %v", invites, err)
+	}
+	if got := redemptions[twice.ID]; len(got) != 2 || got[0].UserName != "NewUser1" || got[1].UserName != "NewUser2" {
+		t.Errorf("AuthService.ListInviteCodes() redemptions = %v", got)
+	}
+}
+
+func TestAuthService_RegisterMode(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	tests := []struct {
+		name         string
+		registration conf.RegistrationMode
+		hasUser      bool
+		wantErr      bool
+	}{
+		{
+			name:         "First user without invite code",
+			registration: conf.InviteRegistration,
+			hasUser:      false,
+			wantErr:      false,
+		},
+		{
+			name:         "Second user without invite code",
+			registration: conf.InviteRegistration,
+			hasUser:      true,
+			wantErr:      true,
+		},
+		{
+			name:         "Open registration",
+			registration: conf.OpenRegistration,
+			hasUser:      true,
+			wantErr:      false,
+		},
+		{
+			name:         "Closed registration",
+			registration: conf.ClosedRegistration,
+			hasUser:      false,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := MockAuthService()
+			s.registration = tt.registration
+			if tt.hasUser {
+				teardownTest := setupTest(t, s)
+				defer teardownTest(t)
+			}
+
+			if err := s.Register("NewUser", "password", ""); (err != nil) != tt.wantErr {
+				t.Errorf("AuthService.Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthService_releaseInviteCode(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockAuthService()
+	s.registration = conf.InviteRegistration
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+
+	once, err := s.CreateInviteCode("validUser1", 1, time.Hour)
+	if err != nil {
+		t.Fatalf("AuthService.CreateInviteCode() error = %v", err)
+	}
+	// the use consumed by a failed registration is given back
+	invite, err := s.redeemInviteCode(once.Code)
+	if err != nil {
+		t.Fatalf("AuthService.redeemInviteCode() error = %v", err)
+	}
+	s.releaseInviteCode(invite)
+	if err := s.Register("NewUser1", "password", once.Code); err != nil {
+		t.Errorf("AuthService.Register() error = %v, want the invite code usable", err)
+	}
+	if err := s.Register("NewUser2", "password", once.Code); err == nil {
+		t.Errorf("AuthService.Register() error = nil, want the invite code used up")
+	}
+}
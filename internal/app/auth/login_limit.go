@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	log "github.com/sirupsen/logrus"
+)
+
+// LoginLockedError is returned when the logins of the user name or the ip are locked out by too many failures.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed logins, retry after %d seconds", int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// loginPolicy is the LoginLimitConfig with the defaults filled in.
+type loginPolicy struct {
+	window          time.Duration
+	maxUserFailures int
+	maxIPFailures   int
+	lockout         time.Duration
+	maxLockout      time.Duration
+}
+
+func newLoginPolicy(config *conf.LoginLimitConfig) loginPolicy {
+	p := loginPolicy{
+		window:          15 * time.Minute,
+		maxUserFailures: 5,
+		maxIPFailures:   20,
+		lockout:         time.Minute,
+		maxLockout:      time.Hour,
+	}
+	if config == nil {
+		return p
+	}
+	if config.WindowSeconds > 0 {
+		p.window = time.Duration(config.WindowSeconds) * time.Second
+	}
+	if config.MaxUserFailures > 0 {
+		p.maxUserFailures = config.MaxUserFailures
+	}
+	if config.MaxIPFailures > 0 {
+		p.maxIPFailures = config.MaxIPFailures
+	}
+	if config.LockoutSeconds > 0 {
+		p.lockout = time.Duration(config.LockoutSeconds) * time.Second
+	}
+	if config.MaxLockoutSeconds > 0 {
+		p.maxLockout = time.Duration(config.MaxLockoutSeconds) * time.Second
+	}
+	if p.maxLockout < p.lockout {
+		p.maxLockout = p.lockout
+	}
+	return p
+}
+
+// retryAfter returns how long the logins are still locked out by the failures, sorted from the latest. The failures
+// are counted in the window before the latest one, and the lockout doubles on every failure beyond the limit.
+func (p loginPolicy) retryAfter(failures []*dao.LoginFailure, maxFailures int) time.Duration {
+	if len(failures) < maxFailures {
+		return 0
+	}
+	latest := failures[0].CreateAt
+	count := 0
+	for _, failure := range failures {
+		if failure.CreateAt.After(latest.Add(-p.window)) {
+			count++
+		}
+	}
+	if count < maxFailures {
+		return 0
+	}
+	lockout := p.maxLockout
+	if exceeded := count - maxFailures; exceeded < 32 && p.lockout<<exceeded < p.maxLockout {
+		lockout = p.lockout << exceeded
+	}
+	return time.Until(latest.Add(lockout))
+}
+
+// Login authenticates the user from the ip. The logins locked out are rejected before checking the password, so
+// that the guessing costs no bcrypt, and the failures are recorded to lock out the further guessing.
+func (s *AuthService) Login(username, password, ip string) (*dao.User, error) {
+	if err := s.checkLoginLocked(username, ip); err != nil {
+		return nil, err
+	}
+	user, err := s.Authenticate(username, password)
+	if err != nil {
+		s.pruneLoginFailures()
+		if _, err := s.loginFailureMapper.Insert(&dao.LoginFailure{
+			UserName: username,
+			IP:       ip,
+			CreateAt: time.Now(),
+			UpdateAt: time.Now(),
+		}); err != nil {
+			log.Errorf("failed to record the failed login of user %s from %s, err:%v", username, ip, err)
+		}
+		// tell the client when to retry if this failure locks out the logins
+		if lockedErr := s.checkLoginLocked(username, ip); lockedErr != nil {
+			log.Warnf("logins of user %s or from %s are locked out, err:%v", username, ip, lockedErr)
+			return nil, lockedErr
+		}
+		return nil, err
+	}
+	if _, err := s.loginFailureMapper.ExecBySQL("UPDATE t_login_failure SET cleared = ?, update_at = ? WHERE user_name = ? AND cleared = ?",
+		true, time.Now(), username, false); err != nil {
+		log.Warnf("failed to clear the failed logins of user %s, err:%v", username, err)
+	}
+	return user, nil
+}
+
+// checkLoginLocked returns a LoginLockedError if the logins of the user name or the ip are locked out.
+func (s *AuthService) checkLoginLocked(username, ip string) error {
+	// the failures older than this can neither be counted nor lock out
+	since := time.Now().Add(-s.loginPolicy.window - s.loginPolicy.maxLockout)
+	userFailures, err := s.loginFailureMapper.SelectBySQL(
+		"SELECT * FROM t_login_failure WHERE user_name = ? AND cleared = ? AND create_at > ? ORDER BY create_at DESC",
+		username, false, since)
+	if err != nil {
+		return err
+	}
+	ipFailures, err := s.loginFailureMapper.SelectBySQL(
+		"SELECT * FROM t_login_failure WHERE ip = ? AND create_at > ? ORDER BY create_at DESC",
+		ip, since)
+	if err != nil {
+		return err
+	}
+	retryAfter := max(s.loginPolicy.retryAfter(userFailures, s.loginPolicy.maxUserFailures),
+		s.loginPolicy.retryAfter(ipFailures, s.loginPolicy.maxIPFailures))
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// pruneLoginFailures deletes the failures which can neither be counted nor lock out any more.
+func (s *AuthService) pruneLoginFailures() {
+	if _, err := s.loginFailureMapper.ExecBySQL("DELETE FROM t_login_failure WHERE create_at < ?",
+		time.Now().Add(-s.loginPolicy.window-s.loginPolicy.maxLockout)); err != nil {
+		log.Warnf("failed to delete the expired failed logins, err:%v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+)
+
+func TestAuthService_Login(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockAuthService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+
+	type failure struct {
+		username string
+		ip       string
+		ago      time.Duration
+	}
+	repeat := func(n int, f failure) []failure {
+		failures := make([]failure, n)
+		for i := range failures {
+			failures[i] = f
+		}
+		return failures
+	}
+
+	tests := []struct {
+		name           string
+		failures       []failure
+		username       string
+		password       string
+		ip             string
+		wantErr        bool
+		wantRetryAfter time.Duration // zero if not locked out
+	}{
+		{
+			name:     "Valid login",
+			username: "TestUser",
+			password: "password",
+			ip:       "10.0.0.1",
+			wantErr:  false,
+		},
+		{
+			name:     "Failures below the limit",
+			failures: repeat(3, failure{"TestUser", "10.0.0.1", time.Second}),
+			username: "TestUser",
+			password: "wrongpassword",
+			ip:       "10.0.0.1",
+			wantErr:  true,
+		},
+		{
+			name:           "Failure reaching the limit",
+			failures:       repeat(4, failure{"TestUser", "10.0.0.1", time.Second}),
+			username:       "TestUser",
+			password:       "wrongpassword",
+			ip:             "10.0.0.1",
+			wantErr:        true,
+			wantRetryAfter: time.Minute,
+		},
+		{
+			name:           "Valid password while locked out",
+			failures:       repeat(5, failure{"TestUser", "10.0.0.2", time.Second}),
+			username:       "TestUser",
+			password:       "password",
+			ip:             "10.0.0.1",
+			wantErr:        true,
+			wantRetryAfter: time.Minute - time.Second,
+		},
+		{
+			name:           "Lockout doubles on further failures",
+			failures:       repeat(7, failure{"TestUser", "10.0.0.1", time.Minute}),
+			username:       "TestUser",
+			password:       "password",
+			ip:             "10.0.0.1",
+			wantErr:        true,
+			wantRetryAfter: 3 * time.Minute,
+		},
+		{
+			name:     "Lockout expired",
+			failures: repeat(5, failure{"TestUser", "10.0.0.1", 2 * time.Minute}),
+			username: "TestUser",
+			password: "password",
+			ip:       "10.0.0.1",
+			wantErr:  false,
+		},
+		{
+			name:     "Failures out of the window",
+			failures: append(repeat(4, failure{"TestUser", "10.0.0.1", 20 * time.Minute}), failure{"TestUser", "10.0.0.1", time.Second}),
+			username: "TestUser",
+			password: "wrongpassword",
+			ip:       "10.0.0.1",
+			wantErr:  true,
+		},
+		{
+			name:           "IP locked out across user names",
+			failures:       repeat(20, failure{"AnotherUser", "10.0.0.3", time.Second}),
+			username:       "TestUser",
+			password:       "password",
+			ip:             "10.0.0.3",
+			wantErr:        true,
+			wantRetryAfter: time.Minute - time.Second,
+		},
+		{
+			name:     "Another IP not locked out",
+			failures: repeat(20, failure{"AnotherUser", "10.0.0.3", time.Second}),
+			username: "TestUser",
+			password: "password",
+			ip:       "10.0.0.4",
+			wantErr:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.loginFailureMapper.DB.Exec("DELETE FROM " + dao.LoginFailure{}.TableName())
+			for _, f := range tt.failures {
+				if _, err := s.loginFailureMapper.Insert(&dao.LoginFailure{
+					UserName: f.username,
+					IP:       f.ip,
+					CreateAt: time.Now().Add(-f.ago),
+					UpdateAt: time.Now().Add(-f.ago),
+				}); err != nil {
+					t.Fatalf("Failed to insert login failure: %v", err)
+				}
+			}
+			user, err := s.Login(tt.username, tt.password, tt.ip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AuthService.Login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && user.Name != tt.username {
+				t.Errorf("AuthService.Login() user = %v, want %v", user.Name, tt.username)
+			}
+			var lockedErr *LoginLockedError
+			locked := errors.As(err, &lockedErr)
+			if locked != (tt.wantRetryAfter > 0) {
+				t.Fatalf("AuthService.Login() error = %v, want locked out %v", err, tt.wantRetryAfter > 0)
+			}
+			if locked && (lockedErr.RetryAfter > tt.wantRetryAfter || lockedErr.RetryAfter < tt.wantRetryAfter-5*time.Second) {
+				t.Errorf("AuthService.Login() retry after = %v, want %v", lockedErr.RetryAfter, tt.wantRetryAfter)
+			}
+		})
+	}
+
+	// a successful login clears the failures of the user name, but keeps them as records
+	s.loginFailureMapper.DB.Exec("DELETE FROM " + dao.LoginFailure{}.TableName())
+	for i := 0; i < 4; i++ {
+		if _, err := s.Login("TestUser", "wrongpassword", "10.0.0.5"); err == nil {
+			t.Fatalf("AuthService.Login() error = nil, want error")
+		}
+	}
+	if _, err := s.Login("TestUser", "password", "10.0.0.5"); err != nil {
+		t.Fatalf("AuthService.Login() error = %v", err)
+	}
+	if _, err := s.Login("TestUser", "wrongpassword", "10.0.0.5"); errors.As(err, new(*LoginLockedError)) {
+		t.Errorf("AuthService.Login() error = %v, want the failures cleared", err)
+	}
+	failures, err := s.loginFailureMapper.Select(&dao.LoginFailure{UserName: "TestUser"})
+	if err != nil || len(failures) != 5 {
+		t.Errorf("Failed to keep the login failures, got %d, err: %v", len(failures), err)
+	}
+}
+
+func TestAuthService_pruneLoginFailures(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockAuthService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+
+	// the default window is 15 minutes, and the max lockout is an hour
+	for _, ago := range []time.Duration{time.Minute, 30 * time.Minute, 2 * time.Hour} {
+		if _, err := s.loginFailureMapper.Insert(&dao.LoginFailure{
+			UserName: "validUser1",
+			IP:       "192.0.2.1",
+			CreateAt: time.Now().Add(-ago),
+			UpdateAt: time.Now().Add(-ago),
+		}); err != nil {
+			t.Fatalf("Failed to insert login failure: %v", err)
+		}
+	}
+	if _, err := s.Login("validUser1", "wrong", "192.0.2.1"); err == nil {
+		t.Fatalf("AuthService.Login() error = nil, want error")
+	}
+	failures, err := s.loginFailureMapper.Select(&dao.LoginFailure{UserName: "validUser1"})
+	if err != nil {
+		t.Fatalf("Failed to select login failures: %v", err)
+	}
+	if len(failures) != 3 {
+		t.Errorf("Login failures = %d, want 3 with the oldest one pruned", len(failures))
+	}
+}
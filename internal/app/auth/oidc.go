@@ -0,0 +1,531 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	gojwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// oidcStateExpiry is how long the user has to log in at the provider
+	oidcStateExpiry = 10 * time.Minute
+	// oidcPasswordHash is the password hash of the users provisioned by OIDC, it's no bcrypt hash so that no
+	// password matches it
+	oidcPasswordHash = "!oidc"
+)
+
+var (
+	ErrOIDCDisabled     = errors.New("oidc login is disabled")
+	ErrInvalidOIDCState = errors.New("invalid or expired oidc state")
+)
+
+// roleRanks orders the roles by privilege, to pick the most privileged one of the groups.
+var roleRanks = map[dao.UserRole]int{
+	dao.UserRoleReadOnly: 1,
+	dao.UserRoleMember:   2,
+	dao.UserRoleAdmin:    3,
+}
+
+// OIDCIdentity is the identity verified by the ID token.
+type OIDCIdentity struct {
+	Issuer      string
+	Subject     string
+	Name        string // preferred_username, or email, or subject
+	DisplayName string
+	Groups      []string
+}
+
+// oidcProvider talks to the OpenID Connect provider, the discovery document and the keys are fetched on demand and
+// cached.
+type oidcProvider struct {
+	config      *conf.OIDCConfig
+	scopes      []string
+	groupsClaim string
+	roleMapping map[string]dao.UserRole
+	defaultRole dao.UserRole
+	client      *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]interface{}
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func newOIDCProvider(config *conf.OIDCConfig) (*oidcProvider, error) {
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oidc issuer, client id and redirect url are required")
+	}
+	p := &oidcProvider{
+		config:      config,
+		scopes:      config.Scopes,
+		groupsClaim: config.GroupsClaim,
+		roleMapping: make(map[string]dao.UserRole),
+		defaultRole: dao.UserRole(config.DefaultRole),
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+	if len(p.scopes) == 0 {
+		p.scopes = []string{"openid", "profile", "email", "groups"}
+	}
+	if p.groupsClaim == "" {
+		p.groupsClaim = "groups"
+	}
+	if p.defaultRole == "" {
+		p.defaultRole = dao.UserRoleMember
+	}
+	if _, ok := rolePermissions[p.defaultRole]; !ok {
+		return nil, fmt.Errorf("unknown oidc default role %s", p.defaultRole)
+	}
+	for group, role := range config.RoleMapping {
+		if _, ok := rolePermissions[dao.UserRole(role)]; !ok {
+			return nil, fmt.Errorf("unknown role %s of oidc group %s", role, group)
+		}
+		p.roleMapping[group] = dao.UserRole(role)
+	}
+	return p, nil
+}
+
+// role maps the groups to the most privileged role, the default role is used if none of the groups is mapped.
+func (p *oidcProvider) role(groups []string) dao.UserRole {
+	role := dao.UserRole("")
+	for _, group := range groups {
+		if mapped, ok := p.roleMapping[group]; ok && roleRanks[mapped] > roleRanks[role] {
+			role = mapped
+		}
+	}
+	if role == "" {
+		return p.defaultRole
+	}
+	return role
+}
+
+func (p *oidcProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var discovery oidcDiscovery
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover the oidc provider: %w", err)
+	}
+	if discovery.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("oidc issuer mismatch, expected %s, got %s", p.config.Issuer, discovery.Issuer)
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// getKey finds the key to verify the ID token by its kid, the keys are fetched again for an unknown kid in case the
+// provider rotated them.
+func (p *oidcProvider) getKey(ctx context.Context, kid string) (interface{}, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+	var jwks struct {
+		Keys []*jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch the oidc keys: %w", err)
+	}
+	p.keys = make(map[string]interface{})
+	for _, k := range jwks.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			log.Warnf("skip the oidc key %s, err:%v", k.Kid, err)
+			continue
+		}
+		p.keys[k.Kid] = key
+	}
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown oidc key %s", kid)
+}
+
+// findKey finds the cached key by the kid, the only key is used if the token has no kid.
+func (p *oidcProvider) findKey(kid string) interface{} {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s of %s", resp.Status, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// authURL builds the url of the provider to log in with the authorization code flow and PKCE.
+func (p *oidcProvider) authURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// exchange exchanges the authorization code for the ID token.
+func (p *oidcProvider) exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("failed to exchange the oidc code, status %s: %s", resp.Status, body)
+	}
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.IDToken == "" {
+		return "", errors.New("no id token in the oidc token response")
+	}
+	return token.IDToken, nil
+}
+
+// verify verifies the signature, issuer, audience, expiry and nonce of the ID token.
+func (p *oidcProvider) verify(ctx context.Context, idToken, nonce string) (*OIDCIdentity, error) {
+	claims := gojwt.MapClaims{}
+	parser := gojwt.NewParser(gojwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}))
+	if _, err := parser.ParseWithClaims(idToken, claims, func(token *gojwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, kid)
+	}); err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+	if !claims.VerifyIssuer(p.config.Issuer, true) {
+		return nil, errors.New("invalid id token: unexpected issuer")
+	}
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return nil, errors.New("invalid id token: unexpected audience")
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("invalid id token: expired")
+	}
+	if claims["nonce"] != nonce {
+		return nil, errors.New("invalid id token: unexpected nonce")
+	}
+	identity := &OIDCIdentity{Issuer: p.config.Issuer}
+	identity.Subject, _ = claims["sub"].(string)
+	if identity.Subject == "" {
+		return nil, errors.New("invalid id token: no subject")
+	}
+	for _, claim := range []string{"preferred_username", "email", "sub"} {
+		if identity.Name, _ = claims[claim].(string); identity.Name != "" {
+			break
+		}
+	}
+	identity.DisplayName, _ = claims["name"].(string)
+	switch groups := claims[p.groupsClaim].(type) {
+	case []interface{}:
+		for _, group := range groups {
+			if group, ok := group.(string); ok {
+				identity.Groups = append(identity.Groups, group)
+			}
+		}
+	case string:
+		identity.Groups = []string{groups}
+	}
+	return identity, nil
+}
+
+// jwk is a public key in the JWK set of the provider.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k *jwk) publicKey() (interface{}, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// OIDCEnabled checks if the OIDC login is configured.
+func (s *AuthService) OIDCEnabled() bool {
+	return s.oidc != nil
+}
+
+// OIDCPostLoginURL returns where to redirect the user after the OIDC login, empty to respond the token.
+func (s *AuthService) OIDCPostLoginURL() string {
+	if s.oidc == nil {
+		return ""
+	}
+	return s.oidc.config.PostLoginURL
+}
+
+// StartOIDCLogin starts an OIDC login, returns the url of the provider to redirect the user to, and the state to
+// bind the callback to the browser.
+func (s *AuthService) StartOIDCLogin(ctx context.Context) (string, string, error) {
+	if s.oidc == nil {
+		return "", "", ErrOIDCDisabled
+	}
+	// drop the logins abandoned at the provider
+	if _, err := s.oidcStateMapper.ExecBySQL("DELETE FROM t_oidc_state WHERE expire_at < ?", time.Now()); err != nil {
+		log.Warnf("failed to delete the expired oidc states, err:%v", err)
+	}
+	values := make([]string, 3)
+	for i := range values {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return "", "", err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(buf)
+	}
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+	authURL, err := s.oidc.authURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := s.oidcStateMapper.Insert(&dao.OIDCState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpireAt:     time.Now().Add(oidcStateExpiry),
+		CreateAt:     time.Now(),
+	}); err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// FinishOIDCLogin consumes the state of the login, exchanges the code for the ID token, and provisions the user of
+// the identity on the first login.
+func (s *AuthService) FinishOIDCLogin(ctx context.Context, state, code string) (*dao.User, error) {
+	if s.oidc == nil {
+		return nil, ErrOIDCDisabled
+	}
+	if state == "" || code == "" {
+		return nil, ErrInvalidOIDCState
+	}
+	states, err := s.oidcStateMapper.Select(&dao.OIDCState{State: state})
+	if err != nil {
+		return nil, err
+	}
+	if len(states) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+	// the state is deleted before the exchange, so that it's consumed once even by the concurrent callbacks, the
+	// callback losing the race finds no record to delete
+	if _, err := s.oidcStateMapper.Delete(states[0]); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+	if states[0].ExpireAt.Before(time.Now()) {
+		return nil, ErrInvalidOIDCState
+	}
+	idToken, err := s.oidc.exchange(ctx, code, states[0].CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := s.oidc.verify(ctx, idToken, states[0].Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return s.provisionOIDCUser(identity)
+}
+
+// provisionOIDCUser finds the user linked to the identity, or creates one. The role follows the groups on every
+// login if the role mapping is configured, otherwise it's only set on the creation.
+func (s *AuthService) provisionOIDCUser(identity *OIDCIdentity) (*dao.User, error) {
+	role := s.oidc.role(identity.Groups)
+	identities, err := s.userIdentityMapper.Select(&dao.UserIdentity{Issuer: identity.Issuer, Subject: identity.Subject})
+	if err != nil {
+		return nil, err
+	}
+	if len(identities) > 0 {
+		user, err := s.GetUser(identities[0].UserCredit)
+		if err != nil {
+			return nil, err
+		}
+		if len(s.oidc.roleMapping) > 0 && RoleOf(user) != role {
+			if err := s.SetRole(user.Name, role); err != nil {
+				return nil, err
+			}
+			log.Infof("role of oidc user %s changed from %s to %s", user.Name, RoleOf(user), role)
+			user.Role = role
+		}
+		return user, nil
+	}
+
+	// the local users are never linked by the name, nor the configured admins granted by it, pick another name if
+	// it's taken
+	name := identity.Name
+	taken, err := s.nameTaken(name)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		sum := sha256.Sum256([]byte(identity.Issuer + " " + identity.Subject))
+		name = name + "-" + hex.EncodeToString(sum[:3])
+		if taken, err = s.nameTaken(name); err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, fmt.Errorf("user %s already exists", name)
+		}
+	}
+	user := &dao.User{
+		Name:         name,
+		Credit:       uuid.NewString(),
+		DisplayName:  identity.DisplayName,
+		PasswordHash: oidcPasswordHash,
+		Role:         role,
+		CreateAt:     time.Now(),
+		UpdateAt:     time.Now(),
+	}
+	if err := s.userMapper.InsertWithIdentity(user, &dao.UserIdentity{
+		Issuer:   identity.Issuer,
+		Subject:  identity.Subject,
+		CreateAt: time.Now(),
+		UpdateAt: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+	log.Infof("provisioned oidc user %s as %s", user.Name, role)
+	return user, nil
+}
+
+// nameTaken checks if the name is used by a user or configured as an admin, who is granted by the name even before
+// registered.
+func (s *AuthService) nameTaken(name string) (bool, error) {
+	if slices.Contains(s.admins, name) {
+		return true, nil
+	}
+	users, err := s.userMapper.Select(&dao.User{Name: name})
+	if err != nil {
+		return false, err
+	}
+	return len(users) > 0, nil
+}
@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	gojwt "github.com/golang-jwt/jwt/v4"
+)
+
+// mockOIDCProvider is a local OIDC provider, which issues the codes of the users logged in by the test.
+type mockOIDCProvider struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]mockOIDCCode
+}
+
+type mockOIDCCode struct {
+	challenge string
+	claims    gojwt.MapClaims
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	p := &mockOIDCProvider{key: key, codes: make(map[string]mockOIDCCode)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "listen-tube" || secret != "secret" {
+			http.Error(w, "invalid client", http.StatusUnauthorized)
+			return
+		}
+		p.mu.Lock()
+		code, ok := p.codes[r.PostFormValue("code")]
+		delete(p.codes, r.PostFormValue("code"))
+		p.mu.Unlock()
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != code.challenge {
+			http.Error(w, "invalid grant", http.StatusBadRequest)
+			return
+		}
+		token := gojwt.NewWithClaims(gojwt.SigningMethodRS256, code.claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "id_token": idToken})
+	})
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+// login logs in the subject at the authorization url, and returns the code to the callback. The claims override
+// the default ones of the ID token.
+func (p *mockOIDCProvider) login(t *testing.T, authURL string, claims gojwt.MapClaims) url.Values {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Failed to parse auth url: %v", err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("redirect_uri") != "http://localhost:8080/auth/oidc/callback" {
+		t.Fatalf("Unexpected auth url %s", authURL)
+	}
+	idClaims := gojwt.MapClaims{
+		"iss":   p.URL,
+		"aud":   query.Get("client_id"),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for k, v := range claims {
+		idClaims[k] = v
+	}
+	code := randomString(t)
+	p.mu.Lock()
+	p.codes[code] = mockOIDCCode{challenge: query.Get("code_challenge"), claims: idClaims}
+	p.mu.Unlock()
+	return url.Values{"state": {query.Get("state")}, "code": {code}}
+}
+
+func randomString(t *testing.T) string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		t.Fatalf("Failed to generate random string: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func TestAuthService_OIDCLogin(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	provider := newMockOIDCProvider(t)
+	defer provider.Close()
+
+	s := MockAuthService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+	oidc, err := newOIDCProvider(&conf.OIDCConfig{
+		Enable:       true,
+		Issuer:       provider.URL,
+		ClientID:     "listen-tube",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:8080/auth/oidc/callback",
+		RoleMapping:  map[string]string{"podcast-admins": "admin", "guests": "readonly"},
+	})
+	if err != nil {
+		t.Fatalf("newOIDCProvider() error = %v", err)
+	}
+	s.oidc = oidc
+	s.admins = append(s.admins, "root") // configured but never registered
+
+	tests := []struct {
+		name      string
+		claims    gojwt.MapClaims
+		tamper    func(callback url.Values)
+		wantErr   bool
+		wantName  string
+		wantRole  dao.UserRole
+		wantUsers int // users linked to the subjects so far
+	}{
+		{
+			name:      "Provision a new user",
+			claims:    gojwt.MapClaims{"sub": "alice-sub", "preferred_username": "alice", "name": "Alice"},
+			wantName:  "alice",
+			wantRole:  dao.UserRoleMember,
+			wantUsers: 1,
+		},
+		{
+			name:      "Link by issuer and subject",
+			claims:    gojwt.MapClaims{"sub": "alice-sub", "preferred_username": "alice-renamed"},
+			wantName:  "alice",
+			wantRole:  dao.UserRoleMember,
+			wantUsers: 1,
+		},
+		{
+			name:      "Map the groups to the role",
+			claims:    gojwt.MapClaims{"sub": "alice-sub", "groups": []string{"guests", "podcast-admins"}},
+			wantName:  "alice",
+			wantRole:  dao.UserRoleAdmin,
+			wantUsers: 1,
+		},
+		{
+			name:      "Follow the groups on every login",
+			claims:    gojwt.MapClaims{"sub": "alice-sub", "groups": []string{"guests"}},
+			wantName:  "alice",
+			wantRole:  dao.UserRoleReadOnly,
+			wantUsers: 1,
+		},
+		{
+			name:      "Never link a local user by the name",
+			claims:    gojwt.MapClaims{"sub": "bob-sub", "preferred_username": "TestUser"},
+			wantName:  "TestUser-", // suffixed by the hash of the identity
+			wantRole:  dao.UserRoleMember,
+			wantUsers: 2,
+		},
+		{
+			name:      "Never take a configured admin name",
+			claims:    gojwt.MapClaims{"sub": "root-sub", "preferred_username": "root"},
+			wantName:  "root-",
+			wantRole:  dao.UserRoleMember,
+			wantUsers: 3,
+		},
+		{
+			name:      "Fall back to the email",
+			claims:    gojwt.MapClaims{"sub": "carol-sub", "email": "carol@example.com"},
+			wantName:  "carol@example.com",
+			wantRole:  dao.UserRoleMember,
+			wantUsers: 4,
+		},
+		{
+			name:   "Unknown state",
+			claims: gojwt.MapClaims{"sub": "dave-sub"},
+			tamper: func(callback url.Values) {
+				callback.Set("state", "unknown")
+			},
+			wantErr:   true,
+			wantUsers: 4,
+		},
+		{
+			name:   "Wrong code",
+			claims: gojwt.MapClaims{"sub": "dave-sub"},
+			tamper: func(callback url.Values) {
+				callback.Set("code", "wrong")
+			},
+			wantErr:   true,
+			wantUsers: 4,
+		},
+		{
+			name:      "Wrong nonce",
+			claims:    gojwt.MapClaims{"sub": "dave-sub", "nonce": "replayed"},
+			wantErr:   true,
+			wantUsers: 4,
+		},
+		{
+			name:      "Wrong audience",
+			claims:    gojwt.MapClaims{"sub": "dave-sub", "aud": "another-client"},
+			wantErr:   true,
+			wantUsers: 4,
+		},
+		{
+			name:      "Expired ID token",
+			claims:    gojwt.MapClaims{"sub": "dave-sub", "exp": time.Now().Add(-time.Minute).Unix()},
+			wantErr:   true,
+			wantUsers: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authURL, state, err := s.StartOIDCLogin(context.Background())
+			if err != nil {
+				t.Fatalf("AuthService.StartOIDCLogin() error = %v", err)
+			}
+			callback := provider.login(t, authURL, tt.claims)
+			if callback.Get("state") != state {
+				t.Fatalf("AuthService.StartOIDCLogin() state = %v, want %v", state, callback.Get("state"))
+			}
+			if tt.tamper != nil {
+				tt.tamper(callback)
+			}
+			user, err := s.FinishOIDCLogin(context.Background(), callback.Get("state"), callback.Get("code"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AuthService.FinishOIDCLogin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				if user.Name != tt.wantName && !(strings.HasSuffix(tt.wantName, "-") && strings.HasPrefix(user.Name, tt.wantName)) {
+					t.Errorf("AuthService.FinishOIDCLogin() name = %v, want %v", user.Name, tt.wantName)
+				}
+				if user.Role != tt.wantRole {
+					t.Errorf("AuthService.FinishOIDCLogin() role = %v, want %v", user.Role, tt.wantRole)
+				}
+				if _, err := s.Authenticate(user.Name, ""); err == nil {
+					t.Errorf("AuthService.Authenticate() error = nil, want no password login for oidc users")
+				}
+				// the state is consumed once
+				if _, err := s.FinishOIDCLogin(context.Background(), callback.Get("state"), callback.Get("code")); err != ErrInvalidOIDCState {
+					t.Errorf("AuthService.FinishOIDCLogin() replayed error = %v, want %v", err, ErrInvalidOIDCState)
+				}
+			}
+			identities, err := s.userIdentityMapper.Select(&dao.UserIdentity{})
+			if err != nil || len(identities) != tt.wantUsers {
+				t.Errorf("Linked users = %d, want %d, err: %v", len(identities), tt.wantUsers, err)
+			}
+		})
+	}
+}
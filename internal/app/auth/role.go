@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+)
+
+const (
+	// ActionRead reads the subscriptions and contents, or manages the own account
+	ActionRead = "read"
+	// ActionWrite manages the subscriptions and contents
+	ActionWrite = "write"
+	// ActionAdmin manages the users and invite codes
+	ActionAdmin = "admin"
+)
+
+var _ Authorizer = (*AuthService)(nil)
+
+// rolePermissions maps the roles to the actions they are allowed to perform.
+var rolePermissions = map[dao.UserRole][]string{
+	dao.UserRoleAdmin:    {ActionRead, ActionWrite, ActionAdmin},
+	dao.UserRoleMember:   {ActionRead, ActionWrite},
+	dao.UserRoleReadOnly: {ActionRead},
+}
+
+// Authorize checks if the user is authorized to perform the action by the role. The users in the configured admins
+// are always admins, in case no admin is left.
+func (s *AuthService) Authorize(username, action string) (bool, error) {
+	if slices.Contains(s.admins, username) {
+		return true, nil
+	}
+	users, err := s.userMapper.Select(&dao.User{Name: username})
+	if err != nil {
+		return false, err
+	}
+	if len(users) != 1 {
+		return false, errors.New("user not found")
+	}
+	return slices.Contains(rolePermissions[RoleOf(users[0])], action), nil
+}
+
+// SetRole changes the role of the user.
+func (s *AuthService) SetRole(username string, role dao.UserRole) error {
+	if _, ok := rolePermissions[role]; !ok {
+		return errors.New("unknown role")
+	}
+	_, err := s.userMapper.UpdateColumns(&dao.User{Name: username}, map[string]interface{}{
+		"role":      role,
+		"update_at": time.Now(),
+	})
+	if err != nil {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+// ListUsers lists all the users.
+func (s *AuthService) ListUsers() ([]*dao.User, error) {
+	return s.userMapper.Select(&dao.User{})
+}
+
+// RoleOf returns the role of the user, the users registered before the roles are introduced are members.
+func RoleOf(user *dao.User) dao.UserRole {
+	if user.Role == "" {
+		return dao.UserRoleMember
+	}
+	return user.Role
+}
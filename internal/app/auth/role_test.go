@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+)
+
+func TestAuthService_Authorize(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockAuthService()
+	s.admins = []string{"ConfigAdmin"}
+	// the first user is bootstrapped as admin
+	for _, username := range []string{"Admin", "Member", "Reader"} {
+		if err := s.Register(username, "password", ""); err != nil {
+			t.Fatalf("AuthService.Register() error = %v", err)
+		}
+	}
+	if err := s.SetRole("Reader", dao.UserRoleReadOnly); err != nil {
+		t.Fatalf("AuthService.SetRole() error = %v", err)
+	}
+	if err := s.SetRole("Reader", "superuser"); err == nil {
+		t.Errorf("AuthService.SetRole() error = nil for unknown role, want error")
+	}
+	if err := s.SetRole("NonExistentUser", dao.UserRoleAdmin); err == nil {
+		t.Errorf("AuthService.SetRole() error = nil for non-existent user, want error")
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		action   string
+		want     bool
+		wantErr  bool
+	}{
+		{name: "Admin manages users", username: "Admin", action: ActionAdmin, want: true},
+		{name: "Member manages users", username: "Member", action: ActionAdmin, want: false},
+		{name: "Member writes", username: "Member", action: ActionWrite, want: true},
+		{name: "Reader writes", username: "Reader", action: ActionWrite, want: false},
+		{name: "Reader reads", username: "Reader", action: ActionRead, want: true},
+		{name: "Configured admin", username: "ConfigAdmin", action: ActionAdmin, want: true},
+		{name: "Non-existent user", username: "NonExistentUser", action: ActionRead, want: false, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Authorize(tt.username, tt.action)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AuthService.Authorize() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("AuthService.Authorize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
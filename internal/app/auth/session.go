@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	log "github.com/sirupsen/logrus"
+)
+
+// sessionCacheTTL is how long the state of a session is cached, the sessions revoked by another instance are
+// rejected after it at the latest.
+const sessionCacheTTL = 30 * time.Second
+
+var ErrSessionRevoked = errors.New("session is revoked")
+
+// sessionCache caches whether the sessions are active, so that the DB isn't hit on every request.
+type sessionCache struct {
+	mu      sync.Mutex
+	entries map[string]sessionCacheEntry
+}
+
+type sessionCacheEntry struct {
+	active   bool
+	expireAt time.Time
+}
+
+func newSessionCache() *sessionCache {
+	return &sessionCache{
+		entries: make(map[string]sessionCacheEntry),
+	}
+}
+
+func (c *sessionCache) get(jti string) (active bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[jti]
+	if !ok || time.Now().After(entry.expireAt) {
+		return false, false
+	}
+	return entry.active, true
+}
+
+func (c *sessionCache) set(jti string, active bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// drop the expired entries, the cache never grows beyond the sessions seen in a TTL
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expireAt) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[jti] = sessionCacheEntry{active: active, expireAt: now.Add(sessionCacheTTL)}
+}
+
+// CreateSession records a new login of the user.
+func (s *AuthService) CreateSession(userCredit, jti, device, ip string, expireAt time.Time) error {
+	_, err := s.sessionMapper.Insert(&dao.Session{
+		JTI:        jti,
+		UserCredit: userCredit,
+		Device:     device,
+		IP:         ip,
+		LastSeenAt: time.Now(),
+		ExpireAt:   expireAt,
+		CreateAt:   time.Now(),
+		UpdateAt:   time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	s.sessions.set(jti, true)
+	return nil
+}
+
+// IsSessionActive checks if the session is neither revoked nor expired. The last seen time is recorded whenever the
+// cached state is refreshed, which is at most once a TTL.
+func (s *AuthService) IsSessionActive(jti string) bool {
+	if jti == "" {
+		return false
+	}
+	if active, ok := s.sessions.get(jti); ok {
+		return active
+	}
+	sessions, err := s.sessionMapper.Select(&dao.Session{JTI: jti})
+	if err != nil {
+		// do not cache the failure, the next request retries
+		log.Errorf("failed to select session, err:%v", err)
+		return false
+	}
+	active := len(sessions) == 1 && !sessions[0].Revoked && sessions[0].ExpireAt.After(time.Now())
+	if active {
+		if _, err := s.sessionMapper.UpdateColumns(&dao.Session{ID: sessions[0].ID}, map[string]interface{}{
+			"last_seen_at": time.Now(),
+		}); err != nil {
+			log.Warnf("failed to record the last seen time of session %d, err:%v", sessions[0].ID, err)
+		}
+	}
+	s.sessions.set(jti, active)
+	return active
+}
+
+// RenewSession extends the expiry of the session on token refresh.
+func (s *AuthService) RenewSession(jti string, expireAt time.Time) error {
+	affected, err := s.sessionMapper.ExecBySQL("UPDATE t_session SET expire_at = ?, last_seen_at = ?, update_at = ? WHERE jti = ? AND revoked = ?",
+		expireAt, time.Now(), time.Now(), jti, false)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// ListSessions lists the active sessions of the user.
+func (s *AuthService) ListSessions(userCredit string) ([]*dao.Session, error) {
+	return s.sessionMapper.SelectBySQL("SELECT * FROM t_session WHERE user_credit = ? AND revoked = ? AND expire_at > ? ORDER BY last_seen_at DESC",
+		userCredit, false, time.Now())
+}
+
+// RevokeSession revokes a session of the user.
+func (s *AuthService) RevokeSession(userCredit string, id uint) error {
+	sessions, err := s.sessionMapper.Select(&dao.Session{ID: id, UserCredit: userCredit})
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		return errors.New("session not found")
+	}
+	return s.revokeSessions(sessions)
+}
+
+// RevokeSessionByJTI revokes the session of the token, e.g. on logout.
+func (s *AuthService) RevokeSessionByJTI(jti string) error {
+	sessions, err := s.sessionMapper.Select(&dao.Session{JTI: jti})
+	if err != nil {
+		return err
+	}
+	return s.revokeSessions(sessions)
+}
+
+// RevokeOtherSessions revokes all the sessions of the user except the current one, revokes all if the current jti
+// is empty.
+func (s *AuthService) RevokeOtherSessions(userCredit, currentJTI string) error {
+	sessions, err := s.sessionMapper.Select(&dao.Session{UserCredit: userCredit})
+	if err != nil {
+		return err
+	}
+	others := make([]*dao.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if session.JTI != currentJTI && !session.Revoked {
+			others = append(others, session)
+		}
+	}
+	return s.revokeSessions(others)
+}
+
+func (s *AuthService) revokeSessions(sessions []*dao.Session) error {
+	for _, session := range sessions {
+		if _, err := s.sessionMapper.UpdateColumns(&dao.Session{ID: session.ID}, map[string]interface{}{
+			"revoked":   true,
+			"update_at": time.Now(),
+		}); err != nil {
+			return err
+		}
+		s.sessions.set(session.JTI, false)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+)
+
+func TestAuthService_RevokeSession(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockAuthService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+
+	expireAt := time.Now().Add(time.Hour)
+	for _, jti := range []string{"current", "other1", "other2", "revoked", "anotherUser"} {
+		userCredit := "validUser1"
+		if jti == "anotherUser" {
+			userCredit = "validUser2"
+		}
+		if err := s.CreateSession(userCredit, jti, "curl/8.0", "127.0.0.1", expireAt); err != nil {
+			t.Fatalf("AuthService.CreateSession() error = %v", err)
+		}
+	}
+	if err := s.CreateSession("validUser1", "expired", "curl/8.0", "127.0.0.1", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("AuthService.CreateSession() error = %v", err)
+	}
+	sessions, err := s.sessionMapper.Select(&dao.Session{JTI: "revoked"})
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("Failed to select session: %v", err)
+	}
+	if err := s.RevokeSession("validUser2", sessions[0].ID); err == nil {
+		t.Errorf("AuthService.RevokeSession() error = nil for another user, want error")
+	}
+	if err := s.RevokeSession("validUser1", sessions[0].ID); err != nil {
+		t.Fatalf("AuthService.RevokeSession() error = %v", err)
+	}
+	if err := s.RevokeOtherSessions("validUser1", "current"); err != nil {
+		t.Fatalf("AuthService.RevokeOtherSessions() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		jti    string
+		cached bool
+		want   bool
+	}{
+		{name: "Current session", jti: "current", cached: true, want: true},
+		{name: "Current session from DB", jti: "current", cached: false, want: true},
+		{name: "Revoked session", jti: "revoked", cached: true, want: false},
+		{name: "Revoked session from DB", jti: "revoked", cached: false, want: false},
+		{name: "Other session from DB", jti: "other1", cached: false, want: false},
+		{name: "Session of another user", jti: "anotherUser", cached: false, want: true},
+		{name: "Expired session", jti: "expired", cached: false, want: false},
+		{name: "Unknown session", jti: "unknown", cached: false, want: false},
+		{name: "Token without jti", jti: "", cached: false, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.cached {
+				s.sessions = newSessionCache()
+			}
+			if got := s.IsSessionActive(tt.jti); got != tt.want {
+				t.Errorf("AuthService.IsSessionActive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	got, err := s.ListSessions("validUser1")
+	if err != nil || len(got) != 1 || got[0].JTI != "current" {
+		t.Errorf("AuthService.ListSessions() = %v, error = %v", got, err)
+	}
+	if err := s.RenewSession("revoked", expireAt); err != ErrSessionRevoked {
+		t.Errorf("AuthService.RenewSession() error = %v, want %v", err, ErrSessionRevoked)
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	log "github.com/sirupsen/logrus"
+)
+
+// PlaceholderSecret is the placeholder of the secrets in the sample config, which is refused as a key.
+const PlaceholderSecret = "change-me"
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpiredSignature = errors.New("signature is expired")
+)
+
+// StreamSigner signs the urls with HMAC, so that the clients without cookies, e.g. the podcast apps,
+// can access the contents for a short time.
+type StreamSigner struct {
+	key    []byte
+	expiry time.Duration
+}
+
+// SignedClaims is carried by the signed url.
+type SignedClaims struct {
+	UserCredit    string
+	ContentCredit string
+	Scope         string
+	ExpireAt      time.Time
+}
+
+// NewStreamSigner creates a new StreamSigner, a random key is used if not configured, in which case the signed
+// urls are invalid after restart.
+func NewStreamSigner(config *conf.StreamSigningConfig) (*StreamSigner, error) {
+	s := &StreamSigner{
+		expiry: 24 * time.Hour,
+	}
+	if config != nil && config.ExpirySeconds > 0 {
+		s.expiry = time.Duration(config.ExpirySeconds) * time.Second
+	}
+	if config != nil && config.Key == PlaceholderSecret {
+		return nil, fmt.Errorf("stream signing key must be changed from the placeholder %s", PlaceholderSecret)
+	}
+	if config != nil && config.Key != "" {
+		s.key = []byte(config.Key)
+	} else {
+		log.Warn("stream signing key is not configured, use a random key")
+		s.key = make([]byte, 32)
+		if _, err := rand.Read(s.key); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Sign returns the query values of the signed url for the user to access the content with the scope.
+func (s *StreamSigner) Sign(userCredit, contentCredit, scope string) url.Values {
+	expireAt := time.Now().Add(s.expiry).Unix()
+	values := url.Values{}
+	values.Set("u", userCredit)
+	values.Set("scope", scope)
+	values.Set("exp", strconv.FormatInt(expireAt, 10))
+	values.Set("sig", s.signature(userCredit, contentCredit, scope, expireAt))
+	return values
+}
+
+// Verify checks the signature of the query values for the content, and returns the signed claims.
+func (s *StreamSigner) Verify(values url.Values, contentCredit string) (*SignedClaims, error) {
+	expireAt, err := strconv.ParseInt(values.Get("exp"), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	expected := s.signature(values.Get("u"), contentCredit, values.Get("scope"), expireAt)
+	if !hmac.Equal([]byte(expected), []byte(values.Get("sig"))) {
+		return nil, ErrInvalidSignature
+	}
+	if time.Now().Unix() > expireAt {
+		return nil, ErrExpiredSignature
+	}
+	return &SignedClaims{
+		UserCredit:    values.Get("u"),
+		ContentCredit: contentCredit,
+		Scope:         values.Get("scope"),
+		ExpireAt:      time.Unix(expireAt, 0),
+	}, nil
+}
+
+func (s *StreamSigner) signature(userCredit, contentCredit, scope string, expireAt int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(strings.Join([]string{userCredit, contentCredit, scope, strconv.FormatInt(expireAt, 10)}, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
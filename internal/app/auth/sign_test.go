@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+)
+
+func TestStreamSigner_Verify(t *testing.T) {
+	signer, err := NewStreamSigner(&conf.StreamSigningConfig{Key: "secret", ExpirySeconds: 60})
+	if err != nil {
+		t.Fatalf("NewStreamSigner() error = %v", err)
+	}
+	otherSigner, err := NewStreamSigner(&conf.StreamSigningConfig{Key: "other", ExpirySeconds: 60})
+	if err != nil {
+		t.Fatalf("NewStreamSigner() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		values        func() url.Values
+		contentCredit string
+		wantErr       error
+	}{
+		{
+			name: "Valid signature",
+			values: func() url.Values {
+				return signer.Sign("validUser1", "dQw4w9WgXcQ", ScopeStream)
+			},
+			contentCredit: "dQw4w9WgXcQ",
+			wantErr:       nil,
+		},
+		{
+			name: "Another content",
+			values: func() url.Values {
+				return signer.Sign("validUser1", "dQw4w9WgXcQ", ScopeStream)
+			},
+			contentCredit: "anotherContent",
+			wantErr:       ErrInvalidSignature,
+		},
+		{
+			name: "Tampered user",
+			values: func() url.Values {
+				values := signer.Sign("validUser1", "dQw4w9WgXcQ", ScopeStream)
+				values.Set("u", "validUser2")
+				return values
+			},
+			contentCredit: "dQw4w9WgXcQ",
+			wantErr:       ErrInvalidSignature,
+		},
+		{
+			name: "Signed by another key",
+			values: func() url.Values {
+				return otherSigner.Sign("validUser1", "dQw4w9WgXcQ", ScopeStream)
+			},
+			contentCredit: "dQw4w9WgXcQ",
+			wantErr:       ErrInvalidSignature,
+		},
+		{
+			name: "Expired signature",
+			values: func() url.Values {
+				expired := &StreamSigner{key: signer.key, expiry: -time.Minute}
+				return expired.Sign("validUser1", "dQw4w9WgXcQ", ScopeStream)
+			},
+			contentCredit: "dQw4w9WgXcQ",
+			wantErr:       ErrExpiredSignature,
+		},
+		{
+			name: "Missing signature",
+			values: func() url.Values {
+				return url.Values{}
+			},
+			contentCredit: "dQw4w9WgXcQ",
+			wantErr:       ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := signer.Verify(tt.values(), tt.contentCredit)
+			if err != tt.wantErr {
+				t.Errorf("StreamSigner.Verify() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && (claims.UserCredit != "validUser1" || claims.Scope != ScopeStream) {
+				t.Errorf("StreamSigner.Verify() = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestNewStreamSigner_placeholderKey(t *testing.T) {
+	if _, err := NewStreamSigner(&conf.StreamSigningConfig{Key: PlaceholderSecret}); err == nil {
+		t.Errorf("NewStreamSigner() with the placeholder key error = nil, want error")
+	}
+	if _, err := NewStreamSigner(&conf.StreamSigningConfig{}); err != nil {
+		t.Errorf("NewStreamSigner() with a random key error = %v", err)
+	}
+}
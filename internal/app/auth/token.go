@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ScopeRead allows to read the subscriptions and contents
+	ScopeRead = "read"
+	// ScopeStream allows to stream the audio file of a content, and to get the feeds and urls signed to stream
+	ScopeStream = "stream"
+	// ScopeManage allows to manage the subscriptions and contents
+	ScopeManage = "manage"
+
+	// APITokenPrefix marks the personal api tokens, to tell them apart from the JWTs
+	APITokenPrefix = "lt_"
+)
+
+// Scopes are all the scopes an api token can be granted.
+var Scopes = []string{ScopeRead, ScopeStream, ScopeManage}
+
+var (
+	ErrInvalidAPIToken   = errors.New("invalid api token")
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+// CreateAPIToken creates a named api token with the scopes for the user, the plain token is only returned here.
+func (s *AuthService) CreateAPIToken(userCredit, name string, scopes []string) (string, *dao.APIToken, error) {
+	if name == "" {
+		return "", nil, errors.New("token name is required")
+	}
+	if len(scopes) == 0 {
+		return "", nil, errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return "", nil, fmt.Errorf("unknown scope %s", scope)
+		}
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	token := APITokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	apiToken := &dao.APIToken{
+		UserCredit: userCredit,
+		Name:       name,
+		TokenHash:  hashToken(token),
+		Prefix:     token[:len(APITokenPrefix)+6],
+		Scopes:     strings.Join(scopes, ","),
+		CreateAt:   time.Now(),
+		UpdateAt:   time.Now(),
+	}
+	if _, err := s.apiTokenMapper.Insert(apiToken); err != nil {
+		return "", nil, err
+	}
+	return token, apiToken, nil
+}
+
+// ListAPITokens lists the api tokens of the user.
+func (s *AuthService) ListAPITokens(userCredit string) ([]*dao.APIToken, error) {
+	return s.apiTokenMapper.Select(&dao.APIToken{UserCredit: userCredit})
+}
+
+// RevokeAPIToken deletes an api token of the user.
+func (s *AuthService) RevokeAPIToken(userCredit string, id uint) error {
+	if id == 0 {
+		return errors.New("token id is required")
+	}
+	// gorm deletes by the primary key only, check the owner first
+	apiTokens, err := s.apiTokenMapper.Select(&dao.APIToken{ID: id, UserCredit: userCredit})
+	if err != nil {
+		return err
+	}
+	if len(apiTokens) == 0 {
+		return errors.New("token not found")
+	}
+	_, err = s.apiTokenMapper.Delete(apiTokens[0])
+	return err
+}
+
+// AuthenticateAPIToken finds the owner of the api token, and records when the token is used.
+func (s *AuthService) AuthenticateAPIToken(token string) (*dao.User, *dao.APIToken, error) {
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	apiTokens, err := s.apiTokenMapper.Select(&dao.APIToken{TokenHash: hashToken(token)})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(apiTokens) != 1 {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	apiToken := apiTokens[0]
+	users, err := s.userMapper.Select(&dao.User{Credit: apiToken.UserCredit})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(users) != 1 {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	if _, err := s.apiTokenMapper.UpdateColumns(&dao.APIToken{ID: apiToken.ID}, map[string]interface{}{
+		"last_used_at": time.Now(),
+	}); err != nil {
+		log.Warnf("failed to record the usage of api token %d, err:%v", apiToken.ID, err)
+	}
+	return users[0], apiToken, nil
+}
+
+// HasScope checks if the api token is granted the scope.
+func HasScope(apiToken *dao.APIToken, scope string) bool {
+	return slices.Contains(strings.Split(apiToken.Scopes, ","), scope)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
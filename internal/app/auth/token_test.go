@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAuthService_CreateAPIToken(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	tests := []struct {
+		name      string
+		tokenName string
+		scopes    []string
+		wantErr   bool
+	}{
+		{
+			name:      "Valid token",
+			tokenName: "podcast app",
+			scopes:    []string{ScopeRead, ScopeStream},
+			wantErr:   false,
+		},
+		{
+			name:      "Missing name",
+			tokenName: "",
+			scopes:    []string{ScopeRead},
+			wantErr:   true,
+		},
+		{
+			name:      "Missing scopes",
+			tokenName: "podcast app",
+			scopes:    nil,
+			wantErr:   true,
+		},
+		{
+			name:      "Unknown scope",
+			tokenName: "podcast app",
+			scopes:    []string{"admin"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := MockAuthService()
+			teardownTest := setupTest(t, s)
+			defer teardownTest(t)
+
+			token, apiToken, err := s.CreateAPIToken("validUser1", tt.tokenName, tt.scopes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AuthService.CreateAPIToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if !strings.HasPrefix(token, APITokenPrefix) || !strings.HasPrefix(token, apiToken.Prefix) {
+				t.Errorf("AuthService.CreateAPIToken() token = %v, prefix %v", token, apiToken.Prefix)
+			}
+			if apiToken.TokenHash == token || apiToken.TokenHash != hashToken(token) {
+				t.Errorf("AuthService.CreateAPIToken() stored hash = %v", apiToken.TokenHash)
+			}
+		})
+	}
+}
+
+func TestAuthService_AuthenticateAPIToken(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockAuthService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+
+	users, err := s.userMapper.Select(nil)
+	if err != nil || len(users) != 1 {
+		t.Fatalf("Failed to select user: %v", err)
+	}
+	user := users[0]
+	token, apiToken, err := s.CreateAPIToken(user.Credit, "podcast app", []string{ScopeStream})
+	if err != nil {
+		t.Fatalf("AuthService.CreateAPIToken() error = %v", err)
+	}
+	revokedToken, revokedAPIToken, err := s.CreateAPIToken(user.Credit, "old script", []string{ScopeRead})
+	if err != nil {
+		t.Fatalf("AuthService.CreateAPIToken() error = %v", err)
+	}
+	if err := s.RevokeAPIToken("validUser2", revokedAPIToken.ID); err == nil {
+		t.Errorf("AuthService.RevokeAPIToken() error = nil for another user, want error")
+	}
+	if err := s.RevokeAPIToken(user.Credit, revokedAPIToken.ID); err != nil {
+		t.Errorf("AuthService.RevokeAPIToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		wantScope string
+		wantErr   bool
+	}{
+		{
+			name:      "Valid token",
+			token:     token,
+			wantScope: ScopeStream,
+			wantErr:   false,
+		},
+		{
+			name:    "Revoked token",
+			token:   revokedToken,
+			wantErr: true,
+		},
+		{
+			name:    "Unknown token",
+			token:   APITokenPrefix + "unknown",
+			wantErr: true,
+		},
+		{
+			name:    "Not an api token",
+			token:   "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser, gotToken, err := s.AuthenticateAPIToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AuthService.AuthenticateAPIToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if gotUser.Name != user.Name || gotToken.ID != apiToken.ID {
+				t.Errorf("AuthService.AuthenticateAPIToken() = %v, %v", gotUser, gotToken)
+			}
+			if !HasScope(gotToken, tt.wantScope) || HasScope(gotToken, ScopeManage) {
+				t.Errorf("AuthService.AuthenticateAPIToken() scopes = %v", gotToken.Scopes)
+			}
+		})
+	}
+
+	tokens, err := s.ListAPITokens(user.Credit)
+	if err != nil || len(tokens) != 1 || tokens[0].LastUsedAt.IsZero() {
+		t.Errorf("AuthService.ListAPITokens() = %v, error = %v", tokens, err)
+	}
+}
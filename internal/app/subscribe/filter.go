@@ -0,0 +1,142 @@
+package subscribe
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/tube/fetcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// SubscriptionFilter decides which contents of the channel the subscriber wants to download, it's evaluated when
+// the contents are fetched. The zero values want all.
+type SubscriptionFilter struct {
+	TitleInclude     string `json:"title_include,omitempty"` // regexp the title must match, e.g. (?i)podcast
+	TitleExclude     string `json:"title_exclude,omitempty"` // regexp the title must not match, e.g. (?i)trailer
+	MinLengthSeconds int    `json:"min_length_seconds,omitempty"`
+	MaxLengthSeconds int    `json:"max_length_seconds,omitempty"`
+	SkipShorts       bool   `json:"skip_shorts,omitempty"`
+	SkipLive         bool   `json:"skip_live,omitempty"` // the livestreams, on air or the vods
+
+	// the title regexps compiled by Validate, nil if not set
+	titleInclude *regexp.Regexp
+	titleExclude *regexp.Regexp
+}
+
+// Validate checks the filter and compiles the title regexps.
+func (f *SubscriptionFilter) Validate() error {
+	if f.MinLengthSeconds < 0 || f.MaxLengthSeconds < 0 {
+		return fmt.Errorf("length must not be negative")
+	}
+	if f.MaxLengthSeconds > 0 && f.MinLengthSeconds > f.MaxLengthSeconds {
+		return fmt.Errorf("min length must not be greater than max length")
+	}
+	titleInclude, err := compileTitle(f.TitleInclude)
+	if err != nil {
+		return fmt.Errorf("invalid title include, err: %v", err)
+	}
+	titleExclude, err := compileTitle(f.TitleExclude)
+	if err != nil {
+		return fmt.Errorf("invalid title exclude, err: %v", err)
+	}
+	f.titleInclude, f.titleExclude = titleInclude, titleExclude
+	return nil
+}
+
+func compileTitle(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+// reject returns why the content is not wanted, or empty if wanted. The length is not checked if unknown, nor the
+// title if the filter is not validated.
+func (f *SubscriptionFilter) reject(content *fetcher.Content) string {
+	switch {
+	case f.SkipShorts && content.Type == dao.ContentTypeShort:
+		return "short"
+	case f.SkipLive && content.Type == dao.ContentTypeLive:
+		return "livestream"
+	case f.titleInclude != nil && !f.titleInclude.MatchString(content.Title):
+		return "title not included"
+	case f.titleExclude != nil && f.titleExclude.MatchString(content.Title):
+		return "title excluded"
+	case content.Length > 0 && f.MinLengthSeconds > 0 && content.Length < time.Duration(f.MinLengthSeconds)*time.Second:
+		return "shorter than the min length"
+	case content.Length > 0 && f.MaxLengthSeconds > 0 && content.Length > time.Duration(f.MaxLengthSeconds)*time.Second:
+		return "longer than the max length"
+	default:
+		return ""
+	}
+}
+
+// SubscriptionFilterOf parses the filter of a subscription, the subscription without a filter wants all.
+func SubscriptionFilterOf(subscription *dao.Subscription) (*SubscriptionFilter, error) {
+	var filter SubscriptionFilter
+	if subscription.Filter == "" {
+		return &filter, nil
+	}
+	if err := json.Unmarshal([]byte(subscription.Filter), &filter); err != nil {
+		return nil, fmt.Errorf("invalid filter of the subscription, err: %v", err)
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+// SetSubscriptionFilter replaces the filter of a subscription, which applies to the contents fetched later.
+func (s *SubscribeService) SetSubscriptionFilter(userCredit, channelCredit string, filter *SubscriptionFilter) error {
+	subscriptions, err := s.subscriptionMapper.Select(&dao.Subscription{UserCredit: userCredit, ChannelCredit: channelCredit})
+	if err != nil || len(subscriptions) == 0 {
+		return fmt.Errorf("not subscribed to the channel")
+	}
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return err
+	}
+	if _, err := s.subscriptionMapper.UpdateColumns(&dao.Subscription{ID: subscriptions[0].ID}, map[string]interface{}{
+		"filter":    string(data),
+		"update_at": time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to update subscription, err: %v", err)
+	}
+	return nil
+}
+
+// listChannelFilters lists the filters of the subscriptions to the channel, the invalid ones want all.
+func (s *SubscribeService) listChannelFilters(channelCredit string) ([]*SubscriptionFilter, error) {
+	subscriptions, err := s.subscriptionMapper.Select(&dao.Subscription{ChannelCredit: channelCredit})
+	if err != nil {
+		return nil, err
+	}
+	filters := make([]*SubscriptionFilter, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		filter, err := SubscriptionFilterOf(subscription)
+		if err != nil {
+			log.Warnf("ignore the filter of subscription %d, err:%v", subscription.ID, err)
+			filter = &SubscriptionFilter{}
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// rejectByAll returns why the content is not wanted by any of the filters, or empty if any wants it. The content is
+// wanted if there's no filter.
+func rejectByAll(filters []*SubscriptionFilter, content *fetcher.Content) string {
+	reason := ""
+	for _, filter := range filters {
+		if reason = filter.reject(content); reason == "" {
+			return ""
+		}
+	}
+	return reason
+}
@@ -0,0 +1,188 @@
+package subscribe
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/tube/fetcher"
+)
+
+func TestSubscribeService_updateFetchResultWithFilters(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+	if _, err := s.subscriptionMapper.Insert(&dao.Subscription{UserCredit: "validUser2", ChannelCredit: "UC_x5XG1OV2P6uZZ5FSM9Ttw"}); err != nil {
+		t.Fatalf("Failed to insert subscription: %v", err)
+	}
+	if err := s.SetSubscriptionFilter("validUser1", "UC_x5XG1OV2P6uZZ5FSM9Ttw", &SubscriptionFilter{
+		TitleExclude:     "(?i)trailer",
+		MinLengthSeconds: 120,
+		SkipShorts:       true,
+		SkipLive:         true,
+	}); err != nil {
+		t.Fatalf("SubscribeService.SetSubscriptionFilter() error = %v", err)
+	}
+	if err := s.SetSubscriptionFilter("validUser2", "UC_x5XG1OV2P6uZZ5FSM9Ttw", &SubscriptionFilter{
+		TitleInclude: "Interview",
+		SkipShorts:   true,
+	}); err != nil {
+		t.Fatalf("SubscribeService.SetSubscriptionFilter() error = %v", err)
+	}
+	if err := s.SetSubscriptionFilter("validUser1", "UC_x5XG1OV2P6uZZ5FSM9Ttw", &SubscriptionFilter{TitleInclude: "("}); err == nil {
+		t.Errorf("SubscribeService.SetSubscriptionFilter() error = nil for invalid regexp, want error")
+	}
+	if err := s.SetSubscriptionFilter("validUser2", "unknown", &SubscriptionFilter{}); err == nil {
+		t.Errorf("SubscribeService.SetSubscriptionFilter() error = nil for unsubscribed channel, want error")
+	}
+
+	tests := []struct {
+		name       string
+		content    fetcher.Content
+		wantState  dao.ContentState
+		wantReason string
+	}{
+		{
+			name:      "Wanted by all",
+			content:   fetcher.Content{Title: "Interview with Gopher", Length: 30 * time.Minute},
+			wantState: dao.ContentStatePrepared,
+		},
+		{
+			name:       "Short rejected by all",
+			content:    fetcher.Content{Title: "Interview in a minute", Length: time.Minute, Type: dao.ContentTypeShort},
+			wantState:  dao.ContentStateSkipped,
+			wantReason: "short",
+		},
+		{
+			name:      "Livestream wanted by one",
+			content:   fetcher.Content{Title: "Live Interview", Length: 2 * time.Hour, Type: dao.ContentTypeLive},
+			wantState: dao.ContentStatePrepared,
+		},
+		{
+			name:       "Trailer rejected by all",
+			content:    fetcher.Content{Title: "Season 2 Trailer", Length: 3 * time.Minute},
+			wantState:  dao.ContentStateSkipped,
+			wantReason: "title not included",
+		},
+		{
+			name:       "Too short for one and not included by the other",
+			content:    fetcher.Content{Title: "Quick update", Length: time.Minute},
+			wantState:  dao.ContentStateSkipped,
+			wantReason: "title not included",
+		},
+		{
+			name:      "Unknown length is not checked",
+			content:   fetcher.Content{Title: "Quick update"},
+			wantState: dao.ContentStatePrepared,
+		},
+		{
+			name:      "Members only fails regardless",
+			content:   fetcher.Content{Title: "Interview for members", Length: time.Hour, MembersOnly: true},
+			wantState: dao.ContentStateFailed,
+		},
+	}
+
+	channel, err := s.GetChannel("UC_x5XG1OV2P6uZZ5FSM9Ttw")
+	if err != nil {
+		t.Fatalf("SubscribeService.GetChannel() error = %v", err)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.content.Credit = "filtered" + string(rune('a'+i))
+			s.updateFetchResult(channel, &fetcher.Result{Contents: []fetcher.Content{tt.content}})
+			contents, err := s.contentMapper.Select(&dao.Content{ContentCredit: tt.content.Credit})
+			if err != nil || len(contents) == 0 {
+				t.Fatalf("Failed to insert content: %v", err)
+			}
+			if contents[0].State != tt.wantState || !strings.HasSuffix(contents[0].Info, tt.wantReason) {
+				t.Errorf("Content state = %v, info = %s, want %v, %s", contents[0].State, contents[0].Info, tt.wantState, tt.wantReason)
+			}
+		})
+	}
+
+	// the skipped content can be requeued by hand
+	if err := s.RequeueContent("validUser1", "filteredb", false); err != nil {
+		t.Errorf("SubscribeService.RequeueContent() error = %v for skipped content", err)
+	}
+}
+
+func TestSubscribeService_updateFetchResultUpcoming(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+	if err := s.SetSubscriptionFilter("validUser1", "UC_x5XG1OV2P6uZZ5FSM9Ttw", &SubscriptionFilter{SkipLive: true}); err != nil {
+		t.Fatalf("SubscribeService.SetSubscriptionFilter() error = %v", err)
+	}
+	channel, err := s.GetChannel("UC_x5XG1OV2P6uZZ5FSM9Ttw")
+	if err != nil {
+		t.Fatalf("SubscribeService.GetChannel() error = %v", err)
+	}
+	startTime := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		content   fetcher.Content
+		wantState dao.ContentState
+		wantType  dao.ContentType
+	}{
+		{
+			name:      "Scheduled premiere waits",
+			content:   fetcher.Content{Credit: "premiere", Title: "Premiere", PublishedTime: startTime, Type: dao.ContentTypeUpcoming},
+			wantState: dao.ContentStateUpcoming,
+			wantType:  dao.ContentTypeUpcoming,
+		},
+		{
+			name:      "Premiere rescheduled",
+			content:   fetcher.Content{Credit: "premiere", Title: "Premiere", PublishedTime: startTime.Add(time.Hour), Type: dao.ContentTypeUpcoming},
+			wantState: dao.ContentStateUpcoming,
+			wantType:  dao.ContentTypeUpcoming,
+		},
+		{
+			name:      "Premiere aired",
+			content:   fetcher.Content{Credit: "premiere", Title: "Premiere", PublishedTime: startTime, Length: 10 * time.Minute, Type: dao.ContentTypePremiere},
+			wantState: dao.ContentStatePrepared,
+			wantType:  dao.ContentTypePremiere,
+		},
+		{
+			name:      "Aired premiere is not re-checked",
+			content:   fetcher.Content{Credit: "premiere", Title: "Premiere", PublishedTime: startTime, Length: 10 * time.Minute, Type: dao.ContentTypeRegular},
+			wantState: dao.ContentStatePrepared,
+			wantType:  dao.ContentTypePremiere,
+		},
+		{
+			name:      "Livestream on air waits",
+			content:   fetcher.Content{Credit: "stream", Title: "Stream", PublishedTime: startTime, Type: dao.ContentTypeLive},
+			wantState: dao.ContentStateUpcoming,
+			wantType:  dao.ContentTypeLive,
+		},
+		{
+			name:      "Livestream vod filtered once aired",
+			content:   fetcher.Content{Credit: "stream", Title: "Stream", PublishedTime: startTime, Length: 2 * time.Hour, Type: dao.ContentTypeLive},
+			wantState: dao.ContentStateSkipped,
+			wantType:  dao.ContentTypeLive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.updateFetchResult(channel, &fetcher.Result{Contents: []fetcher.Content{tt.content}})
+			contents, err := s.contentMapper.Select(&dao.Content{ContentCredit: tt.content.Credit})
+			if err != nil || len(contents) != 1 {
+				t.Fatalf("Failed to insert content: %v", err)
+			}
+			if contents[0].State != tt.wantState || contents[0].Type != tt.wantType {
+				t.Errorf("Content state = %v, type = %v, want %v, %v", contents[0].State, contents[0].Type, tt.wantState, tt.wantType)
+			}
+			if tt.wantState == dao.ContentStateUpcoming && !contents[0].PublishedTime.Equal(tt.content.PublishedTime) {
+				t.Errorf("Content published time = %v, want %v", contents[0].PublishedTime, tt.content.PublishedTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package subscribe
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/util/str"
+)
+
+// completedMargin is how close to the end the content is taken as completed, so that the outro needn't be played.
+const completedMargin = 30 * time.Second
+
+// ListenStatus tells the clients where the user is with a content.
+type ListenStatus string
+
+const (
+	ListenStatusUnplayed   ListenStatus = "unplayed"
+	ListenStatusInProgress ListenStatus = "in_progress"
+	ListenStatusPlayed     ListenStatus = "played"
+)
+
+// Progress is the playback progress reported by a device.
+type Progress struct {
+	Position  int    // seconds from the start
+	Completed bool   // played to the end
+	Device    string // name of the device, e.g. web, phone or car
+	PlayedAt  time.Time
+}
+
+// StatusOf returns the listen status by the listen state, which is nil if the content was never played.
+func StatusOf(state *dao.ListenState) ListenStatus {
+	switch {
+	case state == nil:
+		return ListenStatusUnplayed
+	case state.Played:
+		return ListenStatusPlayed
+	case state.Position > 0:
+		return ListenStatusInProgress
+	default:
+		return ListenStatusUnplayed
+	}
+}
+
+// ReportProgress records the playback progress of a content reported by a device, and returns the latest listen
+// state. The reports played before the recorded one are ignored, e.g. from a device which was offline for a while,
+// so that the position is not rolled back. The content played to the end is marked as played.
+func (s *SubscribeService) ReportProgress(userCredit, contentCredit string, progress *Progress) (*dao.ListenState, error) {
+	if progress.Position < 0 {
+		return nil, fmt.Errorf("position must not be negative")
+	}
+	content, err := s.GetSubscribedContent(userCredit, contentCredit)
+	if err != nil {
+		return nil, err
+	}
+	playedAt := progress.PlayedAt
+	if playedAt.IsZero() || playedAt.After(time.Now()) {
+		playedAt = time.Now()
+	}
+	completed := progress.Completed ||
+		(content.Length > completedMargin && time.Duration(progress.Position)*time.Second >= content.Length-completedMargin)
+
+	states, err := s.listenStateMapper.Select(&dao.ListenState{UserCredit: userCredit, ContentCredit: contentCredit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list listen state, err: %v", err)
+	}
+	if len(states) == 0 {
+		state := &dao.ListenState{
+			UserCredit:    userCredit,
+			ContentCredit: contentCredit,
+			Played:        completed,
+			Position:      progress.Position,
+			Device:        progress.Device,
+			LastPlayedAt:  playedAt,
+			CreateAt:      time.Now(),
+			UpdateAt:      time.Now(),
+		}
+		if completed {
+			state.PlayedAt = time.Now()
+		}
+		if _, err := s.listenStateMapper.Insert(state); err != nil {
+			return nil, fmt.Errorf("failed to save listen state, err: %v", err)
+		}
+		return state, nil
+	}
+	state := states[0]
+	if state.LastPlayedAt.After(playedAt) {
+		return state, nil
+	}
+	columns := map[string]interface{}{
+		"position":       progress.Position,
+		"device":         progress.Device,
+		"last_played_at": playedAt,
+		"update_at":      time.Now(),
+	}
+	// replaying a played content keeps it played, until it's marked as unplayed
+	if completed && !state.Played {
+		columns["played"] = true
+		columns["played_at"] = time.Now()
+	}
+	if _, err := s.listenStateMapper.UpdateColumns(&dao.ListenState{ID: state.ID}, columns); err != nil {
+		return nil, fmt.Errorf("failed to save listen state, err: %v", err)
+	}
+	return s.GetListenState(userCredit, contentCredit)
+}
+
+// GetListenState gets the listen state of a content for the user, an empty state is returned if it was never
+// played.
+func (s *SubscribeService) GetListenState(userCredit, contentCredit string) (*dao.ListenState, error) {
+	if _, err := s.GetSubscribedContent(userCredit, contentCredit); err != nil {
+		return nil, err
+	}
+	states, err := s.listenStateMapper.Select(&dao.ListenState{UserCredit: userCredit, ContentCredit: contentCredit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list listen state, err: %v", err)
+	}
+	if len(states) == 0 {
+		return &dao.ListenState{UserCredit: userCredit, ContentCredit: contentCredit}, nil
+	}
+	return states[0], nil
+}
+
+// ListListenStates lists the listen states of the contents for the user by the content credits, the contents never
+// played are absent.
+func (s *SubscribeService) ListListenStates(userCredit string, contentCredits []string) (map[string]*dao.ListenState, error) {
+	result := make(map[string]*dao.ListenState)
+	if len(contentCredits) == 0 {
+		return result, nil
+	}
+	states, err := s.listenStateMapper.SelectBySQL("SELECT * FROM t_listen_state WHERE user_credit = ? AND content_credit IN (?)",
+		userCredit, contentCredits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list listen states, err: %v", err)
+	}
+	for _, state := range states {
+		result[state.ContentCredit] = state
+	}
+	return result, nil
+}
+
+// ContentFilter filters the contents by the listen state of the user, the channel, the published time and the
+// length, the zero values match all.
+type ContentFilter struct {
+	ChannelCredit string
+	Tags          []string // the subscriptions tagged with any of the tags
+	Played        *bool
+	Starred       *bool
+	Archived      *bool
+	Since         time.Time // published at or after
+	Until         time.Time // published before
+	MinLength     time.Duration
+	MaxLength     time.Duration
+	Order         ContentOrder
+}
+
+// ContentOrder is the order of the filtered contents, default to the newest first.
+type ContentOrder string
+
+const (
+	ContentOrderNewest   ContentOrder = "newest"
+	ContentOrderOldest   ContentOrder = "oldest"
+	ContentOrderShortest ContentOrder = "shortest"
+	ContentOrderLongest  ContentOrder = "longest"
+)
+
+var contentOrderBy = map[ContentOrder]string{
+	"":                   " ORDER BY c.published_time DESC",
+	ContentOrderNewest:   " ORDER BY c.published_time DESC",
+	ContentOrderOldest:   " ORDER BY c.published_time",
+	ContentOrderShortest: " ORDER BY c.length, c.published_time DESC",
+	ContentOrderLongest:  " ORDER BY c.length DESC, c.published_time DESC",
+}
+
+// matchTags tells if the tags of the subscription match the filter.
+func (f *ContentFilter) matchTags(subscription *dao.Subscription) bool {
+	if len(f.Tags) == 0 {
+		return true
+	}
+	for _, tag := range str.StringToArrayWithSplit(subscription.Tags, ",") {
+		for _, want := range f.Tags {
+			if strings.EqualFold(tag, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// where builds the conditions of the filter on the contents c joined with the listen states l of the user, which are
+// null if never played.
+func (f *ContentFilter) where() (string, []interface{}) {
+	var sql strings.Builder
+	args := make([]interface{}, 0)
+	flags := []struct {
+		column string
+		value  *bool
+	}{{"played", f.Played}, {"starred", f.Starred}, {"archived", f.Archived}}
+	for _, flag := range flags {
+		if flag.value != nil {
+			sql.WriteString(" AND COALESCE(l." + flag.column + ", ?) = ?")
+			args = append(args, false, *flag.value)
+		}
+	}
+	if !f.Since.IsZero() {
+		sql.WriteString(" AND c.published_time >= ?")
+		args = append(args, f.Since)
+	}
+	if !f.Until.IsZero() {
+		sql.WriteString(" AND c.published_time < ?")
+		args = append(args, f.Until)
+	}
+	if f.MinLength > 0 {
+		sql.WriteString(" AND c.length >= ?")
+		args = append(args, f.MinLength)
+	}
+	if f.MaxLength > 0 {
+		sql.WriteString(" AND c.length <= ?")
+		args = append(args, f.MaxLength)
+	}
+	return sql.String(), args
+}
+
+// ArchiveContent archives a content to hide it from the inbox, or moves it back.
+func (s *SubscribeService) ArchiveContent(userCredit, contentCredit string, archived bool) error {
+	if _, err := s.GetSubscribedContent(userCredit, contentCredit); err != nil {
+		return err
+	}
+	return s.saveListenState(userCredit, contentCredit, map[string]interface{}{"archived": archived})
+}
+
+// StarContent stars a content as a favorite, or unstars it.
+func (s *SubscribeService) StarContent(userCredit, contentCredit string, starred bool) error {
+	if _, err := s.GetSubscribedContent(userCredit, contentCredit); err != nil {
+		return err
+	}
+	return s.saveListenState(userCredit, contentCredit, map[string]interface{}{"starred": starred})
+}
+
+// MarkChannelPlayed marks all the listed contents of a subscribed channel as played, and returns how many contents
+// are newly marked.
+func (s *SubscribeService) MarkChannelPlayed(userCredit, channelCredit string) (int, error) {
+	subscriptions, err := s.subscriptionMapper.Select(&dao.Subscription{UserCredit: userCredit, ChannelCredit: channelCredit})
+	if err != nil || len(subscriptions) == 0 {
+		return 0, fmt.Errorf("not subscribed to the channel")
+	}
+	contents, err := s.contentMapper.SelectBySQL("SELECT * FROM t_content WHERE state IN (?) AND channel_credit = ?",
+		[]dao.ContentState{dao.ContentStateDownloaded, dao.ContentStateEvicted}, channelCredit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list contents, err: %v", err)
+	}
+	contentCredits := make([]string, 0, len(contents))
+	for _, content := range contents {
+		contentCredits = append(contentCredits, content.ContentCredit)
+	}
+	states, err := s.ListListenStates(userCredit, contentCredits)
+	if err != nil {
+		return 0, err
+	}
+	marked := 0
+	for _, contentCredit := range contentCredits {
+		if state, ok := states[contentCredit]; ok && state.Played {
+			continue
+		}
+		if err := s.saveListenState(userCredit, contentCredit, map[string]interface{}{
+			"played":    true,
+			"played_at": time.Now(),
+		}); err != nil {
+			return marked, err
+		}
+		marked++
+	}
+	return marked, nil
+}
+
+// saveListenState updates the columns of the listen state of a content for the user, the state is created if the
+// content was never played.
+func (s *SubscribeService) saveListenState(userCredit, contentCredit string, columns map[string]interface{}) error {
+	states, err := s.listenStateMapper.Select(&dao.ListenState{UserCredit: userCredit, ContentCredit: contentCredit})
+	if err != nil {
+		return fmt.Errorf("failed to list listen state, err: %v", err)
+	}
+	state := &dao.ListenState{UserCredit: userCredit, ContentCredit: contentCredit, CreateAt: time.Now()}
+	if len(states) > 0 {
+		state = states[0]
+	} else if _, err := s.listenStateMapper.Insert(state); err != nil {
+		return fmt.Errorf("failed to save listen state, err: %v", err)
+	}
+	columns["update_at"] = time.Now()
+	if _, err := s.listenStateMapper.UpdateColumns(&dao.ListenState{ID: state.ID}, columns); err != nil {
+		return fmt.Errorf("failed to save listen state, err: %v", err)
+	}
+	return nil
+}
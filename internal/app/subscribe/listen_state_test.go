@@ -0,0 +1,242 @@
+package subscribe
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+)
+
+func TestSubscribeService_ReportProgress(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+	if _, err := s.contentMapper.UpdateColumns(&dao.Content{ContentCredit: "dQw4w9WgXcQ"}, map[string]interface{}{
+		"length": 10 * time.Minute,
+	}); err != nil {
+		t.Fatalf("Failed to update content length: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		userCredit    string
+		contentCredit string
+		progress      Progress
+		wantErr       bool
+		wantPosition  int
+		wantDevice    string
+		wantStatus    ListenStatus
+	}{
+		{
+			name:          "Start playing on the phone",
+			userCredit:    "validUser1",
+			contentCredit: "dQw4w9WgXcQ",
+			progress:      Progress{Position: 120, Device: "phone"},
+			wantPosition:  120,
+			wantDevice:    "phone",
+			wantStatus:    ListenStatusInProgress,
+		},
+		{
+			name:          "Resume in the car",
+			userCredit:    "validUser1",
+			contentCredit: "dQw4w9WgXcQ",
+			progress:      Progress{Position: 300, Device: "car"},
+			wantPosition:  300,
+			wantDevice:    "car",
+			wantStatus:    ListenStatusInProgress,
+		},
+		{
+			name:          "Ignore the report played earlier",
+			userCredit:    "validUser1",
+			contentCredit: "dQw4w9WgXcQ",
+			progress:      Progress{Position: 150, Device: "web", PlayedAt: time.Now().Add(-time.Hour)},
+			wantPosition:  300,
+			wantDevice:    "car",
+			wantStatus:    ListenStatusInProgress,
+		},
+		{
+			name:          "Complete near the end",
+			userCredit:    "validUser1",
+			contentCredit: "dQw4w9WgXcQ",
+			progress:      Progress{Position: 580, Device: "car"},
+			wantPosition:  580,
+			wantDevice:    "car",
+			wantStatus:    ListenStatusPlayed,
+		},
+		{
+			name:          "Replay a played content",
+			userCredit:    "validUser1",
+			contentCredit: "dQw4w9WgXcQ",
+			progress:      Progress{Position: 10, Device: "web"},
+			wantPosition:  10,
+			wantDevice:    "web",
+			wantStatus:    ListenStatusPlayed,
+		},
+		{
+			name:          "Complete explicitly",
+			userCredit:    "validUser1",
+			contentCredit: "any",
+			progress:      Progress{Position: 0, Completed: true, Device: "web"},
+			wantPosition:  0,
+			wantDevice:    "web",
+			wantStatus:    ListenStatusPlayed,
+		},
+		{
+			name:          "Negative position",
+			userCredit:    "validUser1",
+			contentCredit: "dQw4w9WgXcQ",
+			progress:      Progress{Position: -1},
+			wantErr:       true,
+		},
+		{
+			name:          "Content of unsubscribed channel",
+			userCredit:    "validUser2",
+			contentCredit: "dQw4w9WgXcQ",
+			progress:      Progress{Position: 10},
+			wantErr:       true,
+		},
+		{
+			name:          "Empty content credit",
+			userCredit:    "validUser1",
+			contentCredit: "",
+			progress:      Progress{Position: 10},
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := s.ReportProgress(tt.userCredit, tt.contentCredit, &tt.progress)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SubscribeService.ReportProgress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if state.Position != tt.wantPosition || state.Device != tt.wantDevice || StatusOf(state) != tt.wantStatus {
+				t.Errorf("SubscribeService.ReportProgress() = %d, %s, %s, want %d, %s, %s", state.Position, state.Device,
+					StatusOf(state), tt.wantPosition, tt.wantDevice, tt.wantStatus)
+			}
+			got, err := s.GetListenState(tt.userCredit, tt.contentCredit)
+			if err != nil || got.Position != state.Position || got.Played != state.Played {
+				t.Errorf("SubscribeService.GetListenState() = %+v, error = %v, want %+v", got, err, state)
+			}
+		})
+	}
+
+	// marking as unplayed starts over
+	if err := s.MarkPlayed("validUser1", "dQw4w9WgXcQ", false); err != nil {
+		t.Fatalf("SubscribeService.MarkPlayed() error = %v", err)
+	}
+	states, err := s.ListListenStates("validUser1", []string{"dQw4w9WgXcQ", "any", "unknown"})
+	if err != nil || len(states) != 2 {
+		t.Fatalf("SubscribeService.ListListenStates() = %v, error = %v", states, err)
+	}
+	if status := StatusOf(states["dQw4w9WgXcQ"]); status != ListenStatusUnplayed {
+		t.Errorf("StatusOf() = %v after marked as unplayed, want %v", status, ListenStatusUnplayed)
+	}
+	if status := StatusOf(states["unknown"]); status != ListenStatusUnplayed {
+		t.Errorf("StatusOf() = %v for never played, want %v", status, ListenStatusUnplayed)
+	}
+}
+
+func TestSubscribeService_FilterContent(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+	// dQw4w9WgXcQ is published at fixedTime, add two older ones and one of another channel
+	for i, contentCredit := range []string{"older1", "older2"} {
+		if _, err := s.contentMapper.Insert(&dao.Content{
+			ChannelCredit: "UC_x5XG1OV2P6uZZ5FSM9Ttw",
+			ContentCredit: contentCredit,
+			State:         dao.ContentStateDownloaded,
+			PublishedTime: fixedTime.AddDate(0, 0, -i-1),
+		}); err != nil {
+			t.Fatalf("Failed to insert content: %v", err)
+		}
+	}
+	if _, err := s.channelMapper.Insert(&dao.Channel{ChannelCredit: "another"}); err != nil {
+		t.Fatalf("Failed to insert channel: %v", err)
+	}
+	if _, err := s.subscriptionMapper.Insert(&dao.Subscription{UserCredit: "validUser1", ChannelCredit: "another"}); err != nil {
+		t.Fatalf("Failed to insert subscription: %v", err)
+	}
+	if _, err := s.contentMapper.Insert(&dao.Content{
+		ChannelCredit: "another",
+		ContentCredit: "anotherContent",
+		State:         dao.ContentStateEvicted,
+		PublishedTime: fixedTime.AddDate(0, 0, -10),
+	}); err != nil {
+		t.Fatalf("Failed to insert content: %v", err)
+	}
+	if _, err := s.contentMapper.UpdateColumns(&dao.Content{ContentCredit: "dQw4w9WgXcQ"}, map[string]interface{}{
+		"published_time": fixedTime,
+	}); err != nil {
+		t.Fatalf("Failed to update content: %v", err)
+	}
+
+	if err := s.StarContent("validUser1", "older1", true); err != nil {
+		t.Fatalf("SubscribeService.StarContent() error = %v", err)
+	}
+	if err := s.ArchiveContent("validUser1", "older2", true); err != nil {
+		t.Fatalf("SubscribeService.ArchiveContent() error = %v", err)
+	}
+	if err := s.ArchiveContent("validUser2", "older2", true); err == nil {
+		t.Errorf("SubscribeService.ArchiveContent() error = nil for unsubscribed channel, want error")
+	}
+	if marked, err := s.MarkChannelPlayed("validUser1", "UC_x5XG1OV2P6uZZ5FSM9Ttw"); err != nil || marked != 3 {
+		t.Fatalf("SubscribeService.MarkChannelPlayed() = %d, error = %v, want 3", marked, err)
+	}
+	if marked, err := s.MarkChannelPlayed("validUser1", "UC_x5XG1OV2P6uZZ5FSM9Ttw"); err != nil || marked != 0 {
+		t.Errorf("SubscribeService.MarkChannelPlayed() again = %d, error = %v, want 0", marked, err)
+	}
+	if _, err := s.MarkChannelPlayed("validUser2", "UC_x5XG1OV2P6uZZ5FSM9Ttw"); err == nil {
+		t.Errorf("SubscribeService.MarkChannelPlayed() error = nil for unsubscribed channel, want error")
+	}
+	if err := s.MarkPlayed("validUser1", "dQw4w9WgXcQ", false); err != nil {
+		t.Fatalf("SubscribeService.MarkPlayed() error = %v", err)
+	}
+
+	yes, no := true, false
+	tests := []struct {
+		name   string
+		filter ContentFilter
+		want   []string
+	}{
+		{name: "No filter", filter: ContentFilter{}, want: []string{"dQw4w9WgXcQ", "older1", "older2", "anotherContent"}},
+		{name: "Inbox", filter: ContentFilter{Archived: &no}, want: []string{"dQw4w9WgXcQ", "older1", "anotherContent"}},
+		{name: "Archived", filter: ContentFilter{Archived: &yes}, want: []string{"older2"}},
+		{name: "Starred", filter: ContentFilter{Starred: &yes}, want: []string{"older1"}},
+		{name: "Played", filter: ContentFilter{Played: &yes}, want: []string{"older1", "older2"}},
+		{name: "Unplayed", filter: ContentFilter{Played: &no}, want: []string{"dQw4w9WgXcQ", "anotherContent"}},
+		{name: "Unplayed in the inbox of a channel", filter: ContentFilter{ChannelCredit: "another", Played: &no, Archived: &no},
+			want: []string{"anotherContent"}},
+		{name: "Unsubscribed channel", filter: ContentFilter{ChannelCredit: "unknown"}, want: []string{}},
+		{name: "Published since", filter: ContentFilter{Since: fixedTime.AddDate(0, 0, -1)}, want: []string{"dQw4w9WgXcQ", "older1"}},
+		{name: "Published in range", filter: ContentFilter{Since: fixedTime.AddDate(0, 0, -2), Until: fixedTime},
+			want: []string{"older1", "older2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents, err := s.FilterContent("validUser1", &tt.filter, 1, 10)
+			if err != nil {
+				t.Fatalf("SubscribeService.FilterContent() error = %v", err)
+			}
+			got := make([]string, 0, len(contents))
+			for _, content := range contents {
+				got = append(got, content.ContentCredit)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SubscribeService.FilterContent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
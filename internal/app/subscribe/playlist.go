@@ -0,0 +1,258 @@
+package subscribe
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/google/uuid"
+)
+
+// QueuePlaylistCredit refers to the up next queue of the user in place of a playlist credit.
+const QueuePlaylistCredit = "queue"
+
+// CreatePlaylist creates a playlist for the user.
+func (s *SubscribeService) CreatePlaylist(userCredit, name string) (*dao.Playlist, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("playlist name must not be empty")
+	}
+	playlist := &dao.Playlist{
+		UserCredit:     userCredit,
+		PlaylistCredit: uuid.NewString(),
+		Name:           name,
+		Kind:           dao.PlaylistKindCustom,
+		CreateAt:       time.Now(),
+		UpdateAt:       time.Now(),
+	}
+	if _, err := s.playlistMapper.Insert(playlist); err != nil {
+		return nil, fmt.Errorf("failed to create playlist, err: %v", err)
+	}
+	return playlist, nil
+}
+
+// RenamePlaylist renames a playlist of the user.
+func (s *SubscribeService) RenamePlaylist(userCredit, playlistCredit, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("playlist name must not be empty")
+	}
+	playlist, err := s.GetPlaylist(userCredit, playlistCredit)
+	if err != nil {
+		return err
+	}
+	if playlist.Kind == dao.PlaylistKindQueue {
+		return fmt.Errorf("the up next queue can not be renamed")
+	}
+	if _, err := s.playlistMapper.UpdateColumns(&dao.Playlist{ID: playlist.ID}, map[string]interface{}{
+		"name":      name,
+		"update_at": time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to rename playlist, err: %v", err)
+	}
+	return nil
+}
+
+// DeletePlaylist deletes a playlist of the user along with its items.
+func (s *SubscribeService) DeletePlaylist(userCredit, playlistCredit string) error {
+	playlist, err := s.GetPlaylist(userCredit, playlistCredit)
+	if err != nil {
+		return err
+	}
+	if playlist.Kind == dao.PlaylistKindQueue {
+		return fmt.Errorf("the up next queue can not be deleted")
+	}
+	if _, err := s.playlistItemMapper.ExecBySQL("DELETE FROM t_playlist_item WHERE playlist_credit = ?", playlist.PlaylistCredit); err != nil {
+		return fmt.Errorf("failed to delete playlist items, err: %v", err)
+	}
+	if _, err := s.playlistMapper.Delete(&dao.Playlist{ID: playlist.ID}); err != nil {
+		return fmt.Errorf("failed to delete playlist, err: %v", err)
+	}
+	return nil
+}
+
+// ListPlaylists lists the playlists of the user, the up next queue comes first.
+func (s *SubscribeService) ListPlaylists(userCredit string) ([]*dao.Playlist, error) {
+	queue, err := s.GetPlaylist(userCredit, QueuePlaylistCredit)
+	if err != nil {
+		return nil, err
+	}
+	playlists, err := s.playlistMapper.SelectBySQL("SELECT * FROM t_playlist WHERE user_credit = ? AND kind IN (?) ORDER BY create_at",
+		userCredit, []dao.PlaylistKind{dao.PlaylistKindCustom, dao.PlaylistKindSmart})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list playlists, err: %v", err)
+	}
+	return append([]*dao.Playlist{queue}, playlists...), nil
+}
+
+// GetPlaylist gets a playlist of the user by its credit, or the up next queue by QueuePlaylistCredit, which is
+// created on the first access.
+func (s *SubscribeService) GetPlaylist(userCredit, playlistCredit string) (*dao.Playlist, error) {
+	if playlistCredit == "" {
+		return nil, fmt.Errorf("playlist does not exist")
+	}
+	if playlistCredit != QueuePlaylistCredit {
+		playlists, err := s.playlistMapper.Select(&dao.Playlist{UserCredit: userCredit, PlaylistCredit: playlistCredit})
+		if err != nil || len(playlists) == 0 {
+			return nil, fmt.Errorf("playlist does not exist")
+		}
+		return playlists[0], nil
+	}
+	playlists, err := s.playlistMapper.SelectBySQL("SELECT * FROM t_playlist WHERE user_credit = ? AND kind = ?",
+		userCredit, dao.PlaylistKindQueue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the up next queue, err: %v", err)
+	}
+	if len(playlists) > 0 {
+		return playlists[0], nil
+	}
+	users, err := s.userMapper.Select(&dao.User{Credit: userCredit})
+	if err != nil || len(users) == 0 {
+		return nil, fmt.Errorf("user does not exist")
+	}
+	queue := &dao.Playlist{
+		UserCredit:     userCredit,
+		PlaylistCredit: uuid.NewString(),
+		Name:           "Up Next",
+		Kind:           dao.PlaylistKindQueue,
+		CreateAt:       time.Now(),
+		UpdateAt:       time.Now(),
+	}
+	if _, err := s.playlistMapper.Insert(queue); err != nil {
+		return nil, fmt.Errorf("failed to create the up next queue, err: %v", err)
+	}
+	return queue, nil
+}
+
+// ListPlaylistContents lists the contents of a playlist of the user in the playing order, the contents of a smart
+// playlist are evaluated by its rules.
+func (s *SubscribeService) ListPlaylistContents(userCredit, playlistCredit string) ([]*dao.Content, error) {
+	playlist, err := s.GetPlaylist(userCredit, playlistCredit)
+	if err != nil {
+		return nil, err
+	}
+	if playlist.Kind == dao.PlaylistKindSmart {
+		return s.evaluateSmartPlaylist(playlist, []dao.ContentState{dao.ContentStateDownloaded, dao.ContentStateEvicted})
+	}
+	return s.contentMapper.SelectBySQL("SELECT c.* FROM t_playlist_item i JOIN t_content c ON c.content_credit = i.content_credit "+
+		"WHERE i.playlist_credit = ? ORDER BY i.position", playlist.PlaylistCredit)
+}
+
+// AddPlaylistItem adds a content of the user's subscribed channels to a playlist, at the end or to be played next.
+// The content already in the playlist is moved instead.
+func (s *SubscribeService) AddPlaylistItem(userCredit, playlistCredit, contentCredit string, next bool) error {
+	if _, err := s.GetSubscribedContent(userCredit, contentCredit); err != nil {
+		return err
+	}
+	playlist, err := s.GetPlaylist(userCredit, playlistCredit)
+	if err != nil {
+		return err
+	}
+	items, err := s.listPlaylistItems(playlist)
+	if err != nil {
+		return err
+	}
+	item, items := takePlaylistItem(items, contentCredit)
+	if item == nil {
+		item = &dao.PlaylistItem{
+			UserCredit:     userCredit,
+			PlaylistCredit: playlist.PlaylistCredit,
+			ContentCredit:  contentCredit,
+			Position:       -1,
+			CreateAt:       time.Now(),
+			UpdateAt:       time.Now(),
+		}
+		if _, err := s.playlistItemMapper.Insert(item); err != nil {
+			return fmt.Errorf("failed to add playlist item, err: %v", err)
+		}
+	}
+	if next {
+		return s.reorderPlaylist(playlist, append([]*dao.PlaylistItem{item}, items...))
+	}
+	return s.reorderPlaylist(playlist, append(items, item))
+}
+
+// MovePlaylistItem moves a content of a playlist to the position, which starts from 0.
+func (s *SubscribeService) MovePlaylistItem(userCredit, playlistCredit, contentCredit string, position int) error {
+	playlist, err := s.GetPlaylist(userCredit, playlistCredit)
+	if err != nil {
+		return err
+	}
+	items, err := s.listPlaylistItems(playlist)
+	if err != nil {
+		return err
+	}
+	item, items := takePlaylistItem(items, contentCredit)
+	if item == nil {
+		return fmt.Errorf("content is not in the playlist")
+	}
+	if position < 0 || position > len(items) {
+		return fmt.Errorf("position out of range")
+	}
+	items = append(items[:position], append([]*dao.PlaylistItem{item}, items[position:]...)...)
+	return s.reorderPlaylist(playlist, items)
+}
+
+// RemovePlaylistItem removes a content from a playlist.
+func (s *SubscribeService) RemovePlaylistItem(userCredit, playlistCredit, contentCredit string) error {
+	playlist, err := s.GetPlaylist(userCredit, playlistCredit)
+	if err != nil {
+		return err
+	}
+	items, err := s.listPlaylistItems(playlist)
+	if err != nil {
+		return err
+	}
+	item, items := takePlaylistItem(items, contentCredit)
+	if item == nil {
+		return fmt.Errorf("content is not in the playlist")
+	}
+	if _, err := s.playlistItemMapper.Delete(&dao.PlaylistItem{ID: item.ID}); err != nil {
+		return fmt.Errorf("failed to remove playlist item, err: %v", err)
+	}
+	return s.reorderPlaylist(playlist, items)
+}
+
+func (s *SubscribeService) listPlaylistItems(playlist *dao.Playlist) ([]*dao.PlaylistItem, error) {
+	if playlist.Kind == dao.PlaylistKindSmart {
+		return nil, fmt.Errorf("the contents of a smart playlist are defined by its rules")
+	}
+	items, err := s.playlistItemMapper.SelectBySQL("SELECT * FROM t_playlist_item WHERE playlist_credit = ? ORDER BY position",
+		playlist.PlaylistCredit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list playlist items, err: %v", err)
+	}
+	return items, nil
+}
+
+// takePlaylistItem takes the item of the content out of the items, the item is nil if absent.
+func takePlaylistItem(items []*dao.PlaylistItem, contentCredit string) (*dao.PlaylistItem, []*dao.PlaylistItem) {
+	for i, item := range items {
+		if item.ContentCredit == contentCredit {
+			return item, append(items[:i:i], items[i+1:]...)
+		}
+	}
+	return nil, items
+}
+
+// reorderPlaylist saves the positions of the items by their order, only the moved ones are updated.
+func (s *SubscribeService) reorderPlaylist(playlist *dao.Playlist, items []*dao.PlaylistItem) error {
+	for i, item := range items {
+		if item.Position == i {
+			continue
+		}
+		if _, err := s.playlistItemMapper.UpdateColumns(&dao.PlaylistItem{ID: item.ID}, map[string]interface{}{
+			"position":  i,
+			"update_at": time.Now(),
+		}); err != nil {
+			return fmt.Errorf("failed to reorder playlist, err: %v", err)
+		}
+	}
+	if _, err := s.playlistMapper.UpdateColumns(&dao.Playlist{ID: playlist.ID}, map[string]interface{}{
+		"update_at": time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to update playlist, err: %v", err)
+	}
+	return nil
+}
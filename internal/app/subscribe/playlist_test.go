@@ -0,0 +1,163 @@
+package subscribe
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+)
+
+func TestSubscribeService_PlaylistItems(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+	// contents of another subscribed channel can be mixed into the playlists
+	if _, err := s.subscriptionMapper.Insert(&dao.Subscription{UserCredit: "validUser1", ChannelCredit: "another"}); err != nil {
+		t.Fatalf("Failed to insert subscription: %v", err)
+	}
+	for _, contentCredit := range []string{"c1", "c2"} {
+		if _, err := s.contentMapper.Insert(&dao.Content{
+			ChannelCredit: "another",
+			ContentCredit: contentCredit,
+			State:         dao.ContentStateDownloaded,
+		}); err != nil {
+			t.Fatalf("Failed to insert content: %v", err)
+		}
+	}
+	playlist, err := s.CreatePlaylist("validUser1", " Commute ")
+	if err != nil || playlist.Name != "Commute" {
+		t.Fatalf("SubscribeService.CreatePlaylist() = %+v, error = %v", playlist, err)
+	}
+
+	tests := []struct {
+		name           string
+		userCredit     string
+		playlistCredit string
+		apply          func(s *SubscribeService, userCredit, playlistCredit string) error
+		wantErr        bool
+		want           []string
+	}{
+		{
+			name:           "Append to the playlist",
+			userCredit:     "validUser1",
+			playlistCredit: playlist.PlaylistCredit,
+			apply: func(s *SubscribeService, userCredit, playlistCredit string) error {
+				for _, contentCredit := range []string{"dQw4w9WgXcQ", "c1", "c2"} {
+					if err := s.AddPlaylistItem(userCredit, playlistCredit, contentCredit, false); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: []string{"dQw4w9WgXcQ", "c1", "c2"},
+		},
+		{
+			name:           "Insert next moves the existing item",
+			userCredit:     "validUser1",
+			playlistCredit: playlist.PlaylistCredit,
+			apply: func(s *SubscribeService, userCredit, playlistCredit string) error {
+				return s.AddPlaylistItem(userCredit, playlistCredit, "c2", true)
+			},
+			want: []string{"c2", "dQw4w9WgXcQ", "c1"},
+		},
+		{
+			name:           "Move to the end",
+			userCredit:     "validUser1",
+			playlistCredit: playlist.PlaylistCredit,
+			apply: func(s *SubscribeService, userCredit, playlistCredit string) error {
+				return s.MovePlaylistItem(userCredit, playlistCredit, "c2", 2)
+			},
+			want: []string{"dQw4w9WgXcQ", "c1", "c2"},
+		},
+		{
+			name:           "Move out of range",
+			userCredit:     "validUser1",
+			playlistCredit: playlist.PlaylistCredit,
+			apply: func(s *SubscribeService, userCredit, playlistCredit string) error {
+				return s.MovePlaylistItem(userCredit, playlistCredit, "c2", 3)
+			},
+			wantErr: true,
+			want:    []string{"dQw4w9WgXcQ", "c1", "c2"},
+		},
+		{
+			name:           "Remove from the middle",
+			userCredit:     "validUser1",
+			playlistCredit: playlist.PlaylistCredit,
+			apply: func(s *SubscribeService, userCredit, playlistCredit string) error {
+				return s.RemovePlaylistItem(userCredit, playlistCredit, "c1")
+			},
+			want: []string{"dQw4w9WgXcQ", "c2"},
+		},
+		{
+			name:           "Queue is separated from the playlists",
+			userCredit:     "validUser1",
+			playlistCredit: QueuePlaylistCredit,
+			apply: func(s *SubscribeService, userCredit, playlistCredit string) error {
+				if err := s.AddPlaylistItem(userCredit, playlistCredit, "c1", true); err != nil {
+					return err
+				}
+				return s.AddPlaylistItem(userCredit, playlistCredit, "c2", true)
+			},
+			want: []string{"c2", "c1"},
+		},
+		{
+			name:           "Content of unsubscribed channel",
+			userCredit:     "validUser2",
+			playlistCredit: QueuePlaylistCredit,
+			apply: func(s *SubscribeService, userCredit, playlistCredit string) error {
+				return s.AddPlaylistItem(userCredit, playlistCredit, "dQw4w9WgXcQ", false)
+			},
+			wantErr: true,
+			want:    []string{},
+		},
+		{
+			name:           "Playlist of another user",
+			userCredit:     "validUser2",
+			playlistCredit: playlist.PlaylistCredit,
+			apply: func(s *SubscribeService, userCredit, playlistCredit string) error {
+				return s.RemovePlaylistItem(userCredit, playlistCredit, "c2")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.apply(s, tt.userCredit, tt.playlistCredit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want == nil {
+				return
+			}
+			contents, err := s.ListPlaylistContents(tt.userCredit, tt.playlistCredit)
+			if err != nil {
+				t.Fatalf("SubscribeService.ListPlaylistContents() error = %v", err)
+			}
+			got := make([]string, 0, len(contents))
+			for _, content := range contents {
+				got = append(got, content.ContentCredit)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SubscribeService.ListPlaylistContents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	playlists, err := s.ListPlaylists("validUser1")
+	if err != nil || len(playlists) != 2 || playlists[0].Kind != dao.PlaylistKindQueue {
+		t.Fatalf("SubscribeService.ListPlaylists() = %v, error = %v, want the queue and a playlist", playlists, err)
+	}
+	if err := s.DeletePlaylist("validUser1", playlists[0].PlaylistCredit); err == nil {
+		t.Errorf("SubscribeService.DeletePlaylist() error = nil for the queue, want error")
+	}
+	if err := s.DeletePlaylist("validUser1", playlist.PlaylistCredit); err != nil {
+		t.Fatalf("SubscribeService.DeletePlaylist() error = %v", err)
+	}
+	if items, _ := s.playlistItemMapper.Select(&dao.PlaylistItem{PlaylistCredit: playlist.PlaylistCredit}); len(items) != 0 {
+		t.Errorf("Playlist items = %d after deleted, want 0", len(items))
+	}
+}
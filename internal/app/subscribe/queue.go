@@ -0,0 +1,292 @@
+package subscribe
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// manualPriority is the priority of the contents requested by the users, e.g. imported, requeued or accessed
+	// after evicted, which are downloaded ahead of the others
+	manualPriority = 100
+	// maxChannelPriority bounds the download priority of the channel set by the user, from the negative one
+	maxChannelPriority = 10
+
+	// the weights of the score of the prepared contents, the higher score is downloaded first
+	subscriberWeight      = 3.0 // per doubling of the subscribers
+	channelPriorityWeight = 2.0 // per point of the average channel priority of the subscribers
+	recencyWeight         = 1.0 // per day published within the recency window
+	recencyWindowDays     = 7
+	waitingWeight         = 1.0 // per waitingHoursPerPoint waiting in the queue, so that every content comes out eventually
+	waitingHoursPerPoint  = 6
+
+	// downloadCandidateLimit bounds each kind of the prepared contents selected to head the download queue, rather than
+	// scoring all of them
+	downloadCandidateLimit = 100
+)
+
+// QueuedContent is a content waiting in the download queue.
+type QueuedContent struct {
+	Content  *dao.Content
+	Position int     // starts from 1, 0 for the downloading ones
+	Score    float64 // the score of the content, the manual and download first ones go ahead regardless of it
+	Manual   bool    // requested by the users
+}
+
+// channelDemand describes who is waiting for the contents of a channel.
+type channelDemand struct {
+	subscribers int
+	priority    float64 // the average channel priority of the subscribers, so that no single one rules the queue
+}
+
+// downloadQueue lists the head of the download queue in the order to download: the manual requests first, then the
+// contents matching the smart playlists downloaded first, then the others by the score. Only the candidates are
+// listed rather than all the prepared contents, see downloadCandidates.
+func (s *SubscribeService) downloadQueue(now time.Time) ([]*QueuedContent, error) {
+	contents, firsts, err := s.downloadCandidates(now)
+	if err != nil {
+		return nil, err
+	}
+	var channelCredits []string
+	for _, content := range contents {
+		if !slices.Contains(channelCredits, content.ChannelCredit) {
+			channelCredits = append(channelCredits, content.ChannelCredit)
+		}
+	}
+	demands, err := s.channelDemands(channelCredits)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := make([]*QueuedContent, 0, len(contents))
+	for _, content := range contents {
+		queue = append(queue, &QueuedContent{
+			Content: content,
+			Score:   scoreContent(content, demands[content.ChannelCredit], now),
+			Manual:  content.Priority > 0,
+		})
+	}
+	slices.SortStableFunc(queue, func(a, b *QueuedContent) int {
+		// the manual requests of higher priority first, the earlier requested first
+		if a.Manual || b.Manual {
+			switch {
+			case !b.Manual:
+				return -1
+			case !a.Manual:
+				return 1
+			case a.Content.Priority != b.Content.Priority:
+				return b.Content.Priority - a.Content.Priority
+			default:
+				return a.Content.UpdateAt.Compare(b.Content.UpdateAt)
+			}
+		}
+		// then the download first ones in the order of the smart playlists
+		ai, aFirst := firsts[a.Content.ContentCredit]
+		bi, bFirst := firsts[b.Content.ContentCredit]
+		if aFirst || bFirst {
+			switch {
+			case !bFirst:
+				return -1
+			case !aFirst:
+				return 1
+			default:
+				return ai - bi
+			}
+		}
+		// then the higher score first, the newer first on a tie
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return b.Content.PublishedTime.Compare(a.Content.PublishedTime)
+	})
+	for i, queued := range queue {
+		queued.Position = i + 1
+	}
+	return queue, nil
+}
+
+// downloadCandidates selects the prepared contents which may head the download queue, without scanning all of them:
+// the earliest manual requests of the highest priority, the first contents of the smart playlists downloaded first,
+// and the newest and the longest waiting contents, which lets every content come out eventually. Each kind is bounded
+// by downloadCandidateLimit. The download first ones are returned with their order in the smart playlists.
+func (s *SubscribeService) downloadCandidates(now time.Time) ([]*dao.Content, map[string]int, error) {
+	var candidates []*dao.Content
+	seen := make(map[uint]bool)
+	add := func(contents []*dao.Content) {
+		for _, content := range contents {
+			if !seen[content.ID] {
+				seen[content.ID] = true
+				candidates = append(candidates, content)
+			}
+		}
+	}
+
+	manuals, err := s.contentMapper.SelectBySQL("SELECT * FROM t_content WHERE state = ? AND priority > 0 ORDER BY priority DESC, update_at ASC LIMIT ?",
+		dao.ContentStatePrepared, downloadCandidateLimit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list manual requests, err: %v", err)
+	}
+	add(manuals)
+	firsts := make(map[string]int)
+	for i, content := range s.downloadFirstContents(now) {
+		if _, ok := firsts[content.ContentCredit]; !ok {
+			firsts[content.ContentCredit] = i
+		}
+		add([]*dao.Content{content})
+	}
+	for _, order := range []string{"published_time DESC", "update_at ASC"} {
+		contents, err := s.contentMapper.SelectBySQL("SELECT * FROM t_content WHERE state = ? ORDER BY "+order+" LIMIT ?",
+			dao.ContentStatePrepared, downloadCandidateLimit)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list prepared contents, err: %v", err)
+		}
+		add(contents)
+	}
+	return candidates, firsts, nil
+}
+
+// scoreContent scores a prepared content by who is waiting for it, how recent it is and how long it has waited.
+func scoreContent(content *dao.Content, demand channelDemand, now time.Time) float64 {
+	score := subscriberWeight*math.Log2(1+float64(demand.subscribers)) + channelPriorityWeight*demand.priority
+	if days := now.Sub(content.PublishedTime).Hours() / 24; days < recencyWindowDays {
+		score += recencyWeight * (recencyWindowDays - math.Max(days, 0))
+	}
+	// the content has waited since it's prepared or requeued
+	queuedAt := content.UpdateAt
+	if queuedAt.IsZero() {
+		queuedAt = content.CreateAt
+	}
+	if hours := now.Sub(queuedAt).Hours(); !queuedAt.IsZero() && hours > 0 {
+		score += waitingWeight * hours / waitingHoursPerPoint
+	}
+	return score
+}
+
+// channelDemands counts the subscribers and the average channel priority of them by the channels, of all the channels
+// if channelCredits is nil.
+func (s *SubscribeService) channelDemands(channelCredits []string) (map[string]channelDemand, error) {
+	var subscriptions []*dao.Subscription
+	var err error
+	if channelCredits == nil {
+		subscriptions, err = s.subscriptionMapper.Select(&dao.Subscription{})
+	} else {
+		subscriptions, err = s.subscriptionMapper.SelectBySQL("SELECT * FROM t_subscription WHERE channel_credit IN ?", channelCredits)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions, err: %v", err)
+	}
+	priorities := make(map[string]int)
+	demands := make(map[string]channelDemand)
+	for _, subscription := range subscriptions {
+		demand := demands[subscription.ChannelCredit]
+		demand.subscribers++
+		demands[subscription.ChannelCredit] = demand
+		priorities[subscription.ChannelCredit] += subscription.Priority
+	}
+	for channelCredit, demand := range demands {
+		demand.priority = float64(priorities[channelCredit]) / float64(demand.subscribers)
+		demands[channelCredit] = demand
+	}
+	return demands, nil
+}
+
+// downloadFirstContents lists the first prepared contents matching the smart playlists downloaded first, in the
+// order of the playlists.
+func (s *SubscribeService) downloadFirstContents(now time.Time) []*dao.Content {
+	playlists, err := s.playlistMapper.SelectBySQL("SELECT * FROM t_playlist WHERE kind = ? AND download_first = ? ORDER BY update_at",
+		dao.PlaylistKindSmart, true)
+	if err != nil {
+		log.Errorf("failed to list smart playlists: %v", err)
+		return nil
+	}
+	var result []*dao.Content
+	for _, playlist := range playlists {
+		rules, err := SmartRulesOf(playlist)
+		if err != nil {
+			log.Warnf("failed to evaluate smart playlist %s, err:%v", playlist.PlaylistCredit, err)
+			continue
+		}
+		filter, limit := rules.filter(now)
+		contents, err := s.filterContent(playlist.UserCredit, filter, []dao.ContentState{dao.ContentStatePrepared}, 1,
+			min(limit, downloadCandidateLimit))
+		if err != nil {
+			log.Warnf("failed to evaluate smart playlist %s, err:%v", playlist.PlaylistCredit, err)
+			continue
+		}
+		result = append(result, contents...)
+	}
+	return result
+}
+
+// nextDownload returns the head of the download queue, or nil if the queue is empty.
+func (s *SubscribeService) nextDownload(now time.Time) (*dao.Content, error) {
+	queue, err := s.downloadQueue(now)
+	if err != nil || len(queue) == 0 {
+		return nil, err
+	}
+	return queue[0].Content, nil
+}
+
+// ListDownloadQueue lists the contents of the user's subscribed channels waiting at the head of the download queue
+// with their positions, the downloading ones first, and returns the length of the whole queue.
+func (s *SubscribeService) ListDownloadQueue(userCredit string) ([]*QueuedContent, int, error) {
+	subscriptions, err := s.subscriptionMapper.Select(&dao.Subscription{UserCredit: userCredit})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list subscriptions")
+	}
+	subscribed := make(map[string]bool)
+	for _, subscription := range subscriptions {
+		subscribed[subscription.ChannelCredit] = true
+	}
+	downloading, err := s.contentMapper.Select(&dao.Content{State: dao.ContentStateDownloading})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list downloading contents, err: %v", err)
+	}
+	queue, err := s.downloadQueue(time.Now())
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.contentMapper.Count(&dao.Content{State: dao.ContentStatePrepared})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count prepared contents, err: %v", err)
+	}
+	result := make([]*QueuedContent, 0)
+	for _, content := range downloading {
+		if subscribed[content.ChannelCredit] {
+			result = append(result, &QueuedContent{Content: content, Manual: content.Priority > 0})
+		}
+	}
+	for _, queued := range queue {
+		if subscribed[queued.Content.ChannelCredit] {
+			result = append(result, queued)
+		}
+	}
+	return result, int(total), nil
+}
+
+// SetSubscriptionPriority sets the download priority of a subscribed channel, from -10 to 10, the contents of the
+// channels of higher priority are downloaded earlier.
+func (s *SubscribeService) SetSubscriptionPriority(userCredit, channelCredit string, priority int) error {
+	if priority < -maxChannelPriority || priority > maxChannelPriority {
+		return fmt.Errorf("priority must be between %d and %d", -maxChannelPriority, maxChannelPriority)
+	}
+	subscriptions, err := s.subscriptionMapper.Select(&dao.Subscription{UserCredit: userCredit, ChannelCredit: channelCredit})
+	if err != nil || len(subscriptions) == 0 {
+		return fmt.Errorf("not subscribed to the channel")
+	}
+	if _, err := s.subscriptionMapper.UpdateColumns(&dao.Subscription{ID: subscriptions[0].ID}, map[string]interface{}{
+		"priority":  priority,
+		"update_at": time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to update subscription, err: %v", err)
+	}
+	return nil
+}
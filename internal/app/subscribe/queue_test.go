@@ -0,0 +1,220 @@
+package subscribe
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+)
+
+func TestScoreContent(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	fresh := &dao.Content{PublishedTime: now.Add(-time.Hour), UpdateAt: now}
+	tests := []struct {
+		name         string
+		higher       *dao.Content
+		higherDemand channelDemand
+		lower        *dao.Content
+		lowerDemand  channelDemand
+	}{
+		{
+			name:         "More subscribers",
+			higher:       fresh,
+			higherDemand: channelDemand{subscribers: 500},
+			lower:        fresh,
+			lowerDemand:  channelDemand{subscribers: 1},
+		},
+		{
+			name:         "Higher channel priority",
+			higher:       fresh,
+			higherDemand: channelDemand{subscribers: 1, priority: 5},
+			lower:        fresh,
+			lowerDemand:  channelDemand{subscribers: 10},
+		},
+		{
+			name:         "More recent",
+			higher:       fresh,
+			higherDemand: channelDemand{subscribers: 1},
+			lower:        &dao.Content{PublishedTime: now.AddDate(0, 0, -5), UpdateAt: now},
+			lowerDemand:  channelDemand{subscribers: 1},
+		},
+		{
+			name:         "Waited long enough",
+			higher:       &dao.Content{PublishedTime: now.AddDate(-1, 0, 0), UpdateAt: now.AddDate(0, 0, -30)},
+			higherDemand: channelDemand{subscribers: 1, priority: -10},
+			lower:        fresh,
+			lowerDemand:  channelDemand{subscribers: 500, priority: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			higher := scoreContent(tt.higher, tt.higherDemand, now)
+			lower := scoreContent(tt.lower, tt.lowerDemand, now)
+			if higher <= lower {
+				t.Errorf("scoreContent() = %v, want higher than %v", higher, lower)
+			}
+		})
+	}
+}
+
+func TestSubscribeService_ListDownloadQueue(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+	now := time.Now()
+	for _, subscription := range []*dao.Subscription{
+		{UserCredit: "validUser1", ChannelCredit: "popular"},
+		{UserCredit: "validUser2", ChannelCredit: "popular"},
+		{UserCredit: "validUser3", ChannelCredit: "popular"},
+		{UserCredit: "validUser2", ChannelCredit: "niche"},
+	} {
+		if _, err := s.subscriptionMapper.Insert(subscription); err != nil {
+			t.Fatalf("Failed to insert subscription: %v", err)
+		}
+	}
+	for _, content := range []*dao.Content{
+		{ContentCredit: "popular1", ChannelCredit: "popular", State: dao.ContentStatePrepared},
+		{ContentCredit: "niche1", ChannelCredit: "niche", State: dao.ContentStatePrepared},
+		{ContentCredit: "failed1", ChannelCredit: "niche", State: dao.ContentStateFailed},
+	} {
+		content.PublishedTime = now.Add(-time.Hour)
+		content.UpdateAt = now
+		if _, err := s.contentMapper.Insert(content); err != nil {
+			t.Fatalf("Failed to insert content: %v", err)
+		}
+	}
+	// the content of the test channel has waited since long ago
+	if _, err := s.contentMapper.UpdateColumns(&dao.Content{ContentCredit: "any"}, map[string]interface{}{
+		"state": dao.ContentStateDownloading,
+	}); err != nil {
+		t.Fatalf("Failed to update content: %v", err)
+	}
+
+	queueOf := func(userCredit string) ([]string, []int, int) {
+		queue, total, err := s.ListDownloadQueue(userCredit)
+		if err != nil {
+			t.Fatalf("SubscribeService.ListDownloadQueue() error = %v", err)
+		}
+		credits := make([]string, 0, len(queue))
+		positions := make([]int, 0, len(queue))
+		for _, queued := range queue {
+			credits = append(credits, queued.Content.ContentCredit)
+			positions = append(positions, queued.Position)
+		}
+		return credits, positions, total
+	}
+
+	// the channel of more subscribers goes first, only the subscribed contents are listed
+	credits, positions, total := queueOf("validUser2")
+	if !reflect.DeepEqual(credits, []string{"popular1", "niche1"}) || !reflect.DeepEqual(positions, []int{1, 2}) || total != 2 {
+		t.Errorf("SubscribeService.ListDownloadQueue() = %v, %v, %d, want [popular1 niche1], [1 2], 2", credits, positions, total)
+	}
+	credits, positions, _ = queueOf("validUser1")
+	if !reflect.DeepEqual(credits, []string{"any", "popular1"}) || !reflect.DeepEqual(positions, []int{0, 1}) {
+		t.Errorf("SubscribeService.ListDownloadQueue() = %v, %v, want [any popular1], [0 1]", credits, positions)
+	}
+
+	// the channel prioritized by the subscriber goes first
+	if err := s.SetSubscriptionPriority("validUser2", "niche", 11); err == nil {
+		t.Errorf("SubscribeService.SetSubscriptionPriority() error = nil for out of range priority, want error")
+	}
+	if err := s.SetSubscriptionPriority("validUser1", "niche", 5); err == nil {
+		t.Errorf("SubscribeService.SetSubscriptionPriority() error = nil for unsubscribed channel, want error")
+	}
+	if err := s.SetSubscriptionPriority("validUser2", "niche", 5); err != nil {
+		t.Fatalf("SubscribeService.SetSubscriptionPriority() error = %v", err)
+	}
+	if credits, _, _ = queueOf("validUser2"); !reflect.DeepEqual(credits, []string{"niche1", "popular1"}) {
+		t.Errorf("SubscribeService.ListDownloadQueue() = %v, want [niche1 popular1]", credits)
+	}
+
+	// the manual requests jump the queue
+	if err := s.SetSubscriptionPriority("validUser2", "niche", -5); err != nil {
+		t.Fatalf("SubscribeService.SetSubscriptionPriority() error = %v", err)
+	}
+	if err := s.RequeueContent("validUser2", "failed1", false); err != nil {
+		t.Fatalf("SubscribeService.RequeueContent() error = %v", err)
+	}
+	if credits, _, _ = queueOf("validUser2"); !reflect.DeepEqual(credits, []string{"failed1", "popular1", "niche1"}) {
+		t.Errorf("SubscribeService.ListDownloadQueue() = %v, want [failed1 popular1 niche1]", credits)
+	}
+	if content := s.takeNextDownload(); content == nil || content.ContentCredit != "failed1" {
+		t.Errorf("SubscribeService.takeNextDownload() = %v, want failed1", content)
+	}
+}
+
+func TestSubscribeService_channelDemands(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+	for _, subscription := range []*dao.Subscription{
+		{UserCredit: "validUser1", ChannelCredit: "popular", Priority: 10},
+		{UserCredit: "validUser2", ChannelCredit: "popular"},
+		{UserCredit: "validUser3", ChannelCredit: "popular"},
+		{UserCredit: "validUser4", ChannelCredit: "popular"},
+		{UserCredit: "validUser2", ChannelCredit: "niche", Priority: -4},
+	} {
+		if _, err := s.subscriptionMapper.Insert(subscription); err != nil {
+			t.Fatalf("Failed to insert subscription: %v", err)
+		}
+	}
+
+	// a single subscriber prioritizing the channel counts by its share of the subscribers
+	demands, err := s.channelDemands([]string{"popular", "niche"})
+	if err != nil {
+		t.Fatalf("SubscribeService.channelDemands() error = %v", err)
+	}
+	want := map[string]channelDemand{
+		"popular": {subscribers: 4, priority: 2.5},
+		"niche":   {subscribers: 1, priority: -4},
+	}
+	if !reflect.DeepEqual(demands, want) {
+		t.Errorf("SubscribeService.channelDemands() = %v, want %v", demands, want)
+	}
+}
+
+func TestSubscribeService_nextDownload(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+	now := time.Now()
+	for _, subscription := range []*dao.Subscription{
+		{UserCredit: "validUser1", ChannelCredit: "popular"},
+		{UserCredit: "validUser2", ChannelCredit: "popular"},
+		{UserCredit: "validUser2", ChannelCredit: "niche"},
+	} {
+		if _, err := s.subscriptionMapper.Insert(subscription); err != nil {
+			t.Fatalf("Failed to insert subscription: %v", err)
+		}
+	}
+	for _, content := range []*dao.Content{
+		{ContentCredit: "popular1", ChannelCredit: "popular", PublishedTime: now.Add(-2 * time.Hour)},
+		{ContentCredit: "niche1", ChannelCredit: "niche", PublishedTime: now.Add(-time.Hour)},
+	} {
+		content.State = dao.ContentStatePrepared
+		content.UpdateAt = now
+		if _, err := s.contentMapper.Insert(content); err != nil {
+			t.Fatalf("Failed to insert content: %v", err)
+		}
+	}
+
+	// the head of the queue is taken without listing the whole queue
+	queue, err := s.downloadQueue(now)
+	if err != nil || len(queue) == 0 {
+		t.Fatalf("SubscribeService.downloadQueue() = %v, error = %v", queue, err)
+	}
+	content, err := s.nextDownload(now)
+	if err != nil || content == nil || content.ContentCredit != queue[0].Content.ContentCredit {
+		t.Errorf("SubscribeService.nextDownload() = %v, error = %v, want %s", content, err, queue[0].Content.ContentCredit)
+	}
+}
@@ -0,0 +1,144 @@
+package subscribe
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+)
+
+// tryStartRetention periodically evicts the downloaded contents matching the retention rules.
+func (s *SubscribeService) tryStartRetention(ctx context.Context) {
+	if s.retentionConfig == nil || !s.retentionConfig.Enable {
+		log.Info("retention disabled")
+		return
+	}
+	timer := time.NewTicker(time.Duration(s.retentionConfig.CleanupIntervalSeconds) * time.Second)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("retention stopped")
+			return
+		case <-timer.C:
+			s.applyRetention()
+		}
+	}
+}
+
+// applyRetention evicts the downloaded contents by every enabled retention rule in order.
+func (s *SubscribeService) applyRetention() {
+	rules := []struct {
+		name    string
+		enabled bool
+		find    func() ([]*dao.Content, error)
+	}{
+		{"keep last per channel", s.retentionConfig.KeepLastPerChannel > 0, s.findBeyondKeepLast},
+		{"max age", s.retentionConfig.MaxAgeDays > 0, s.findBeyondMaxAge},
+		{"played by all subscribers", s.retentionConfig.DeleteAfterPlayed, s.findPlayedByAll},
+		{"disk quota", s.retentionConfig.QuotaMB > 0, s.findBeyondQuota},
+	}
+	for _, rule := range rules {
+		if !rule.enabled {
+			continue
+		}
+		contents, err := rule.find()
+		if err != nil {
+			log.Errorf("failed to apply retention rule %s, err:%v", rule.name, err)
+			continue
+		}
+		for _, content := range contents {
+			s.evictContent(content, rule.name)
+		}
+	}
+}
+
+// findBeyondKeepLast finds the downloaded contents older than the newest N contents of their channel.
+func (s *SubscribeService) findBeyondKeepLast() ([]*dao.Content, error) {
+	sql := "SELECT * FROM t_content WHERE state = ? ORDER BY channel_credit, published_time DESC"
+	contents, err := s.contentMapper.SelectBySQL(sql, dao.ContentStateDownloaded)
+	if err != nil {
+		return nil, err
+	}
+	var result []*dao.Content
+	kept := make(map[string]int)
+	for _, content := range contents {
+		if kept[content.ChannelCredit] < s.retentionConfig.KeepLastPerChannel {
+			kept[content.ChannelCredit]++
+			continue
+		}
+		result = append(result, content)
+	}
+	return result, nil
+}
+
+// findBeyondMaxAge finds the downloaded contents published more than N days ago.
+func (s *SubscribeService) findBeyondMaxAge() ([]*dao.Content, error) {
+	sql := "SELECT * FROM t_content WHERE state = ? AND published_time < ?"
+	deadline := time.Now().AddDate(0, 0, -s.retentionConfig.MaxAgeDays)
+	return s.contentMapper.SelectBySQL(sql, dao.ContentStateDownloaded, deadline)
+}
+
+// findPlayedByAll finds the downloaded contents which every subscriber of the channel has played.
+func (s *SubscribeService) findPlayedByAll() ([]*dao.Content, error) {
+	sql := `SELECT * FROM t_content c WHERE c.state = ?
+		AND EXISTS (SELECT 1 FROM t_subscription s WHERE s.channel_credit = c.channel_credit)
+		AND NOT EXISTS (SELECT 1 FROM t_subscription s WHERE s.channel_credit = c.channel_credit
+			AND NOT EXISTS (SELECT 1 FROM t_listen_state l WHERE l.user_credit = s.user_credit
+				AND l.content_credit = c.content_credit AND l.played = ?))`
+	return s.contentMapper.SelectBySQL(sql, dao.ContentStateDownloaded, true)
+}
+
+// findBeyondQuota finds the least recently accessed contents, which exceed the disk quota in total.
+func (s *SubscribeService) findBeyondQuota() ([]*dao.Content, error) {
+	sql := "SELECT * FROM t_content WHERE state = ? ORDER BY access_at DESC"
+	contents, err := s.contentMapper.SelectBySQL(sql, dao.ContentStateDownloaded)
+	if err != nil {
+		return nil, err
+	}
+	var result []*dao.Content
+	var total int64
+	quota := s.retentionConfig.QuotaMB * 1024 * 1024
+	for _, content := range contents {
+		size := content.Size
+		if size == 0 && filepath.IsAbs(content.Path) {
+			// the size is not recorded for the contents downloaded by the older versions
+			if fi, err := os.Stat(content.Path); err == nil {
+				size = fi.Size()
+			}
+		}
+		if size == 0 {
+			continue
+		}
+		total += size
+		if total > quota {
+			result = append(result, content)
+		}
+	}
+	return result, nil
+}
+
+// evictContent removes the downloaded file of the content from the storage, and marks it as evicted.
+func (s *SubscribeService) evictContent(content *dao.Content, reason string) {
+	if content.Path != "" {
+		if err := s.storage.Delete(context.Background(), content.Path); err != nil {
+			log.Errorf("failed to remove file of content %s, err:%v", content.ContentCredit, err)
+			return
+		}
+	}
+	if _, err := s.contentMapper.UpdateColumns(&dao.Content{ID: content.ID, State: dao.ContentStateDownloaded}, map[string]interface{}{
+		"state":     dao.ContentStateEvicted,
+		"info":      fmt.Sprintf("evicted by %s", reason),
+		"path":      "",
+		"size":      0,
+		"update_at": time.Now(),
+	}); err != nil {
+		log.Errorf("failed to evict content %s, err:%v", content.ContentCredit, err)
+		return
+	}
+	log.Infof("evicted content %s by %s", content.ContentCredit, reason)
+}
@@ -0,0 +1,140 @@
+package subscribe
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+)
+
+func TestSubscribeService_applyRetention(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	tests := []struct {
+		name        string
+		config      *conf.RetentionConfig
+		played      []string
+		wantEvicted []string
+	}{
+		{
+			name:        "Keep last per channel",
+			config:      &conf.RetentionConfig{KeepLastPerChannel: 2},
+			wantEvicted: []string{"dQw4w9WgXcQ"},
+		},
+		{
+			name:        "Max age",
+			config:      &conf.RetentionConfig{MaxAgeDays: 7},
+			wantEvicted: []string{"dQw4w9WgXcQ", "lastMonth"},
+		},
+		{
+			name:        "Played by all subscribers",
+			config:      &conf.RetentionConfig{DeleteAfterPlayed: true},
+			played:      []string{"yesterday"},
+			wantEvicted: []string{"yesterday"},
+		},
+		{
+			name:        "Disk quota",
+			config:      &conf.RetentionConfig{QuotaMB: 1},
+			wantEvicted: []string{"lastMonth"},
+		},
+		{
+			name:        "No rules",
+			config:      &conf.RetentionConfig{},
+			wantEvicted: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := MockSubscribeService()
+			teardownTest := setupTest(t, s)
+			defer teardownTest(t)
+			s.retentionConfig = tt.config
+
+			// the accessed yesterday content and the accessed last month content take 1MB in total
+			for _, c := range []struct {
+				credit   string
+				age      time.Duration
+				size     int64
+				accessAt time.Time
+			}{
+				{"yesterday", 24 * time.Hour, 512 * 1024, time.Now()},
+				{"lastMonth", 30 * 24 * time.Hour, 768 * 1024, fixedTime},
+			} {
+				path := filepath.Join(t.TempDir(), c.credit+".mp3")
+				if err := os.WriteFile(path, []byte(c.credit), 0644); err != nil {
+					t.Fatalf("Failed to write content file: %v", err)
+				}
+				if _, err := s.contentMapper.Insert(&dao.Content{
+					Platform:      "YouTube",
+					ChannelCredit: "UC_x5XG1OV2P6uZZ5FSM9Ttw",
+					ContentCredit: c.credit,
+					State:         dao.ContentStateDownloaded,
+					PublishedTime: time.Now().Add(-c.age),
+					Path:          path,
+					Size:          c.size,
+					AccessAt:      c.accessAt,
+					CreateAt:      fixedTime,
+					UpdateAt:      fixedTime,
+				}); err != nil {
+					t.Fatalf("Failed to insert content: %v", err)
+				}
+			}
+			for _, credit := range tt.played {
+				if err := s.MarkPlayed("validUser1", credit, true); err != nil {
+					t.Fatalf("Failed to mark content played: %v", err)
+				}
+			}
+
+			s.applyRetention()
+
+			evicted, err := s.contentMapper.Select(&dao.Content{State: dao.ContentStateEvicted})
+			if err != nil {
+				t.Fatalf("Failed to list evicted contents: %v", err)
+			}
+			var got []string
+			for _, content := range evicted {
+				got = append(got, content.ContentCredit)
+				if content.Path != "" {
+					t.Errorf("Evicted content %s path = %v, want empty", content.ContentCredit, content.Path)
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.wantEvicted) {
+				t.Errorf("SubscribeService.applyRetention() evicted = %v, want %v", got, tt.wantEvicted)
+			}
+		})
+	}
+}
+
+func TestSubscribeService_AccessContent(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+
+	if _, err := s.AccessContent("validUser1", "dQw4w9WgXcQ"); err != nil {
+		t.Fatalf("SubscribeService.AccessContent() error = %v", err)
+	}
+	content, _ := s.GetContent("dQw4w9WgXcQ")
+	s.evictContent(content, "test")
+
+	if _, err := s.AccessContent("validUser1", "dQw4w9WgXcQ"); err != ErrContentEvicted {
+		t.Errorf("SubscribeService.AccessContent() error = %v, want %v", err, ErrContentEvicted)
+	}
+	if _, err := s.AccessContent("validUser2", "dQw4w9WgXcQ"); err == nil {
+		t.Errorf("SubscribeService.AccessContent() error = nil for unsubscribed user, want error")
+	}
+	content, _ = s.GetContent("dQw4w9WgXcQ")
+	if content.State != dao.ContentStatePrepared {
+		t.Errorf("Content state = %v, want %v", content.State, dao.ContentStatePrepared)
+	}
+}
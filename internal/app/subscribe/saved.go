@@ -0,0 +1,171 @@
+package subscribe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// savedChannelPrefix prefixes the credit of the saved pseudo-channel of each user
+const savedChannelPrefix = "saved:"
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not public either
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// SavedChannelCredit returns the credit of the saved pseudo-channel of the user, which holds the imported contents.
+func SavedChannelCredit(userCredit string) string {
+	return savedChannelPrefix + userCredit
+}
+
+// ImportContent imports the single content at the url into the saved pseudo-channel of the user without subscribing
+// to its channel. Any url downloadable by the backend is accepted, the content is downloaded ahead of the fetched ones
+// and listed in the feed once downloaded. Importing the same url again returns the existing content.
+func (s *SubscribeService) ImportContent(ctx context.Context, userCredit, rawURL string) (*dao.Content, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid url")
+	}
+	// the backend fetches the url from the server, which must not reach the internal hosts
+	if err := s.checkPublicHost(ctx, u.Hostname()); err != nil {
+		return nil, err
+	}
+	channelCredit, err := s.ensureSavedChannel(userCredit)
+	if err != nil {
+		return nil, err
+	}
+	if content := s.findImported(channelCredit, u.String()); content != nil {
+		return content, nil
+	}
+	metadata, err := s.downloader.Probe(ctx, u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to import the url, err: %v", err)
+	}
+	// the url may be a short link of the canonical one which is imported already
+	if content := s.findImported(channelCredit, metadata.URL); content != nil {
+		return content, nil
+	}
+	publishedTime := metadata.PublishedTime
+	if publishedTime.IsZero() {
+		publishedTime = time.Now()
+	}
+	content := &dao.Content{
+		Platform:      metadata.Platform,
+		ChannelCredit: channelCredit,
+		Title:         metadata.Title,
+		Thumbnail:     metadata.Thumbnail,
+		ContentCredit: uuid.NewString(),
+		State:         dao.ContentStatePrepared,
+		Info:          "imported",
+		PublishedTime: publishedTime,
+		Length:        metadata.Length,
+		URL:           metadata.URL,
+		Priority:      manualPriority,
+		CreateAt:      time.Now(),
+		UpdateAt:      time.Now(),
+	}
+	if _, err := s.contentMapper.Insert(content); err != nil {
+		return nil, fmt.Errorf("failed to create content, err: %v", err)
+	}
+	return content, nil
+}
+
+// checkPublicHost rejects the host unless all its addresses are public, e.g. the loopback, private and link-local
+// ones of the server, the storage and the cloud metadata.
+func (s *SubscribeService) checkPublicHost(ctx context.Context, host string) error {
+	addrs, err := s.lookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("failed to resolve host %s", host)
+	}
+	for _, addr := range addrs {
+		ip := addr.IP
+		if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+			ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || sharedAddressSpace.Contains(ip) {
+			return fmt.Errorf("host %s is not public", host)
+		}
+	}
+	return nil
+}
+
+// DeleteSavedChannel deletes the saved pseudo-channel of the user along with the imported contents and their files,
+// which nobody else can reach after the user is deleted.
+func (s *SubscribeService) DeleteSavedChannel(userCredit string) error {
+	channelCredit := SavedChannelCredit(userCredit)
+	contents, err := s.contentMapper.Select(&dao.Content{ChannelCredit: channelCredit})
+	if err != nil {
+		return fmt.Errorf("failed to list contents, err: %v", err)
+	}
+	for _, content := range contents {
+		if content.State == dao.ContentStateDownloading {
+			_ = s.downloader.Cancel(content.ContentCredit)
+		}
+		if content.Path != "" {
+			if err := s.storage.Delete(context.Background(), content.Path); err != nil {
+				log.Errorf("failed to remove file of content %s, err:%v", content.ContentCredit, err)
+			}
+		}
+	}
+	if _, err := s.contentMapper.ExecBySQL("DELETE FROM t_content WHERE channel_credit = ?", channelCredit); err != nil {
+		return fmt.Errorf("failed to delete contents, err: %v", err)
+	}
+	if _, err := s.channelMapper.ExecBySQL("DELETE FROM t_channel WHERE channel_credit = ?", channelCredit); err != nil {
+		return fmt.Errorf("failed to delete saved channel, err: %v", err)
+	}
+	return nil
+}
+
+// findImported returns the content imported from the url into the saved channel, or nil if not imported.
+func (s *SubscribeService) findImported(channelCredit, url string) *dao.Content {
+	contents, err := s.contentMapper.Select(&dao.Content{ChannelCredit: channelCredit, URL: url})
+	if err != nil || len(contents) == 0 {
+		return nil
+	}
+	return contents[0]
+}
+
+// ensureSavedChannel creates the saved pseudo-channel of the user and subscribes the user to it if not yet, and
+// returns its credit.
+func (s *SubscribeService) ensureSavedChannel(userCredit string) (string, error) {
+	users, err := s.userMapper.Select(&dao.User{Credit: userCredit})
+	if err != nil || len(users) == 0 {
+		return "", fmt.Errorf("user does not exist")
+	}
+	channelCredit := SavedChannelCredit(userCredit)
+	channels, err := s.channelMapper.Select(&dao.Channel{ChannelCredit: channelCredit})
+	if err != nil {
+		return "", fmt.Errorf("failed to list channel")
+	}
+	if len(channels) == 0 {
+		if _, err := s.channelMapper.Insert(&dao.Channel{
+			Platform:      dao.PlatformSaved,
+			Name:          "Saved",
+			Description:   "The contents imported one by one",
+			ChannelCredit: channelCredit,
+			CreateAt:      time.Now(),
+			UpdateAt:      time.Now(),
+		}); err != nil {
+			return "", fmt.Errorf("failed to create saved channel, err: %v", err)
+		}
+	}
+	subscriptions, err := s.subscriptionMapper.Select(&dao.Subscription{UserCredit: userCredit, ChannelCredit: channelCredit})
+	if err != nil {
+		return "", fmt.Errorf("failed to list subscriptions")
+	}
+	if len(subscriptions) == 0 {
+		if _, err := s.subscriptionMapper.Insert(&dao.Subscription{
+			UserCredit:    userCredit,
+			ChannelCredit: channelCredit,
+			CreateAt:      time.Now(),
+			UpdateAt:      time.Now(),
+		}); err != nil {
+			return "", fmt.Errorf("failed to create subscription, err: %v", err)
+		}
+	}
+	return channelCredit, nil
+}
@@ -0,0 +1,160 @@
+package subscribe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/tube/downloader"
+)
+
+func TestSubscribeService_ImportContent(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+
+	tests := []struct {
+		name       string
+		userCredit string
+		url        string
+		wantErr    bool
+		wantURL    string
+	}{
+		{
+			name:       "Import a video",
+			userCredit: "validUser1",
+			url:        "https://www.youtube.com/watch?v=imported1",
+			wantURL:    "https://www.youtube.com/watch?v=imported1",
+		},
+		{
+			name:       "Import the short link of the same video",
+			userCredit: "validUser1",
+			url:        "https://youtu.be/imported1",
+			wantURL:    "https://www.youtube.com/watch?v=imported1",
+		},
+		{
+			name:       "Import the same video for another user",
+			userCredit: "validUser2",
+			url:        " https://youtu.be/imported1 ",
+			wantURL:    "https://www.youtube.com/watch?v=imported1",
+		},
+		{
+			name:       "Unsupported url",
+			userCredit: "validUser1",
+			url:        "https://example.com/video.mp4",
+			wantErr:    true,
+		},
+		{
+			name:       "Loopback host",
+			userCredit: "validUser1",
+			url:        "http://127.0.0.1:9000/listen-tube/audio.mp3",
+			wantErr:    true,
+		},
+		{
+			name:       "Cloud metadata host",
+			userCredit: "validUser1",
+			url:        "http://169.254.169.254/latest/meta-data/",
+			wantErr:    true,
+		},
+		{
+			name:       "Host resolved to a private address",
+			userCredit: "validUser1",
+			url:        "https://intranet.example/video.mp4",
+			wantErr:    true,
+		},
+		{
+			name:       "Not an url",
+			userCredit: "validUser1",
+			url:        "imported1",
+			wantErr:    true,
+		},
+		{
+			name:       "Unknown user",
+			userCredit: "unknown",
+			url:        "https://youtu.be/imported1",
+			wantErr:    true,
+		},
+	}
+
+	credits := make(map[string]string)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := s.ImportContent(context.Background(), tt.userCredit, tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SubscribeService.ImportContent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if content.URL != tt.wantURL || content.ChannelCredit != SavedChannelCredit(tt.userCredit) ||
+				content.State != dao.ContentStatePrepared || content.Priority != manualPriority {
+				t.Errorf("SubscribeService.ImportContent() = %+v", content)
+			}
+			// each user has a copy of the imported content, imported once
+			if credit, ok := credits[tt.userCredit]; ok && credit != content.ContentCredit {
+				t.Errorf("SubscribeService.ImportContent() imported again, credit = %s, want %s", content.ContentCredit, credit)
+			}
+			credits[tt.userCredit] = content.ContentCredit
+		})
+	}
+	if credits["validUser1"] == credits["validUser2"] {
+		t.Errorf("SubscribeService.ImportContent() shares the content between the users")
+	}
+
+	// the saved channel is subscribed but never fetched
+	if _, err := s.GetSubscribedContent("validUser1", credits["validUser1"]); err != nil {
+		t.Errorf("SubscribeService.GetSubscribedContent() error = %v for the imported content", err)
+	}
+	if channel := s.takeNextFetcher(); channel == nil || channel.Platform == dao.PlatformSaved {
+		t.Errorf("SubscribeService.takeNextFetcher() = %v, want a subscribed channel", channel)
+	}
+
+	// the imported contents are downloaded first and listed in the feed then
+	content := s.takeNextDownload()
+	if content == nil || content.ContentCredit != credits["validUser1"] {
+		t.Fatalf("SubscribeService.takeNextDownload() = %v, want %s", content, credits["validUser1"])
+	}
+	result, err := s.downloader.Download(context.Background(), &downloader.DownloadOption{
+		ContentCredit: content.ContentCredit,
+		URL:           content.URL,
+		Format:        "mp3",
+	})
+	if err != nil {
+		t.Fatalf("Downloader.Download() error = %v", err)
+	}
+	s.updateDownloadResult(*content, result)
+	contents, err := s.FilterContent("validUser1", &ContentFilter{ChannelCredit: SavedChannelCredit("validUser1")}, 1, 10)
+	if err != nil || len(contents) != 1 || contents[0].ContentCredit != credits["validUser1"] {
+		t.Errorf("SubscribeService.FilterContent() = %v, %v, want the imported content", contents, err)
+	}
+}
+
+func TestSubscribeService_DeleteSavedChannel(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+
+	for _, userCredit := range []string{"validUser1", "validUser2"} {
+		if _, err := s.ImportContent(context.Background(), userCredit, "https://youtu.be/imported1"); err != nil {
+			t.Fatalf("SubscribeService.ImportContent() error = %v", err)
+		}
+	}
+	if err := s.DeleteSavedChannel("validUser1"); err != nil {
+		t.Fatalf("SubscribeService.DeleteSavedChannel() error = %v", err)
+	}
+	// the saved channel of the other user is kept
+	for userCredit, want := range map[string]int{"validUser1": 0, "validUser2": 1} {
+		channels, _ := s.channelMapper.Select(&dao.Channel{ChannelCredit: SavedChannelCredit(userCredit)})
+		contents, _ := s.contentMapper.Select(&dao.Content{ChannelCredit: SavedChannelCredit(userCredit)})
+		if len(channels) != want || len(contents) != want {
+			t.Errorf("SubscribeService.DeleteSavedChannel() left %d channels, %d contents of %s, want %d",
+				len(channels), len(contents), userCredit, want)
+		}
+	}
+}
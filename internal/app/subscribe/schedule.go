@@ -0,0 +1,114 @@
+package subscribe
+
+import (
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMinFetchInterval = 15 * time.Minute
+	defaultMaxFetchInterval = 24 * time.Hour
+	defaultJitterPercent    = 10
+	// cadenceSamples is the number of the latest contents to observe the upload cadence from
+	cadenceSamples = 10
+	// fetchesPerUpload is how many times a channel is fetched within its usual gap between two uploads
+	fetchesPerUpload = 4
+	// upcomingGrace is how long after the scheduled start of an upcoming content the channel is fetched, to catch it
+	// once it airs
+	upcomingGrace = 5 * time.Minute
+	// fetchCandidates is the number of the due channels to try claiming at once, for the concurrent workers
+	fetchCandidates = 10
+)
+
+// fetchInterval computes how long to wait before fetching the channel again by the published times of its latest
+// contents. The channel is fetched several times within its usual gap between two uploads, and less often once it
+// has gone quiet for longer than that. The channel without contents is fetched at the max interval.
+func fetchInterval(publishedTimes []time.Time, now time.Time, minInterval, maxInterval time.Duration) time.Duration {
+	if len(publishedTimes) == 0 {
+		return maxInterval
+	}
+	publishedTimes = slices.Clone(publishedTimes)
+	slices.SortFunc(publishedTimes, func(a, b time.Time) int {
+		return b.Compare(a)
+	})
+	gaps := make([]time.Duration, 0, len(publishedTimes)-1)
+	for i := 1; i < len(publishedTimes); i++ {
+		gaps = append(gaps, publishedTimes[i-1].Sub(publishedTimes[i]))
+	}
+	// the median gap, not skewed by the bursts or the breaks
+	gap := time.Duration(0)
+	if len(gaps) > 0 {
+		slices.Sort(gaps)
+		gap = gaps[len(gaps)/2]
+	}
+	if quiet := now.Sub(publishedTimes[0]); quiet > gap {
+		gap = quiet
+	}
+	return max(minInterval, min(maxInterval, gap/fetchesPerUpload))
+}
+
+// jitter randomizes the interval by up to the percent either way, so that the channels fetched together drift apart.
+func jitter(interval time.Duration, percent int) time.Duration {
+	if percent <= 0 {
+		return interval
+	}
+	delta := int64(interval) * int64(percent) / 100
+	if delta <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(2*delta+1)-delta)
+}
+
+// fetchIntervals returns the configured min and max fetch intervals of a channel and the jitter percent.
+func (s *SubscribeService) fetchIntervals() (time.Duration, time.Duration, int) {
+	minInterval, maxInterval, jitterPercent := defaultMinFetchInterval, defaultMaxFetchInterval, defaultJitterPercent
+	if s.fetcherConfig != nil {
+		if s.fetcherConfig.MinFetchIntervalSeconds > 0 {
+			minInterval = time.Duration(s.fetcherConfig.MinFetchIntervalSeconds) * time.Second
+		}
+		if s.fetcherConfig.MaxFetchIntervalSeconds > 0 {
+			maxInterval = time.Duration(s.fetcherConfig.MaxFetchIntervalSeconds) * time.Second
+		}
+		if s.fetcherConfig.JitterPercent != 0 {
+			jitterPercent = s.fetcherConfig.JitterPercent
+		}
+	}
+	if maxInterval < minInterval {
+		maxInterval = minInterval
+	}
+	return minInterval, maxInterval, jitterPercent
+}
+
+// nextFetchAt schedules the next fetch of the channel by the upload cadence of its latest aired contents, and no later
+// than shortly after the start of its earliest upcoming content.
+func (s *SubscribeService) nextFetchAt(channelCredit string, now time.Time) time.Time {
+	minInterval, maxInterval, jitterPercent := s.fetchIntervals()
+	contents, err := s.contentMapper.SelectBySQL("SELECT * FROM t_content WHERE channel_credit = ? AND state <> ? ORDER BY published_time DESC LIMIT ?",
+		channelCredit, dao.ContentStateUpcoming, cadenceSamples)
+	if err != nil {
+		log.Warnf("failed to list contents of channel %s, err:%v", channelCredit, err)
+	}
+	publishedTimes := make([]time.Time, 0, len(contents))
+	for _, content := range contents {
+		publishedTimes = append(publishedTimes, content.PublishedTime)
+	}
+	interval := jitter(fetchInterval(publishedTimes, now, minInterval, maxInterval), jitterPercent)
+	next := now.Add(max(minInterval, min(maxInterval, interval)))
+
+	// the upcoming contents overdue for longer than the grace are left to the cadence, or they'd be fetched endlessly
+	upcomings, err := s.contentMapper.SelectBySQL("SELECT * FROM t_content WHERE channel_credit = ? AND state = ? AND published_time > ? ORDER BY published_time ASC LIMIT 1",
+		channelCredit, dao.ContentStateUpcoming, now.Add(-upcomingGrace))
+	if err != nil {
+		log.Warnf("failed to list upcoming contents of channel %s, err:%v", channelCredit, err)
+	}
+	if len(upcomings) > 0 {
+		if start := upcomings[0].PublishedTime.Add(upcomingGrace); start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
@@ -0,0 +1,187 @@
+package subscribe
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/tube/fetcher"
+)
+
+func TestFetchInterval(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	every := func(gap time.Duration, n int, since time.Duration) []time.Time {
+		times := make([]time.Time, 0, n)
+		for i := 0; i < n; i++ {
+			times = append(times, now.Add(-since-time.Duration(i)*gap))
+		}
+		return times
+	}
+	tests := []struct {
+		name           string
+		publishedTimes []time.Time
+		want           time.Duration
+	}{
+		{
+			name:           "Hourly uploads bounded by the min interval",
+			publishedTimes: every(time.Hour, 10, 10*time.Minute),
+			want:           15 * time.Minute,
+		},
+		{
+			name:           "Daily uploads",
+			publishedTimes: every(24*time.Hour, 10, time.Hour),
+			want:           6 * time.Hour,
+		},
+		{
+			name:           "Daily uploads in any order with a break",
+			publishedTimes: append([]time.Time{now.AddDate(0, -3, 0)}, every(24*time.Hour, 5, time.Hour)...),
+			want:           6 * time.Hour,
+		},
+		{
+			name:           "Daily uploads gone quiet for 2 days",
+			publishedTimes: every(24*time.Hour, 10, 48*time.Hour),
+			want:           12 * time.Hour,
+		},
+		{
+			name:           "Quiet since 2019 bounded by the max interval",
+			publishedTimes: every(24*time.Hour, 3, 5*365*24*time.Hour),
+			want:           24 * time.Hour,
+		},
+		{
+			name: "No contents",
+			want: 24 * time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fetchInterval(tt.publishedTimes, now, 15*time.Minute, 24*time.Hour); got != tt.want {
+				t.Errorf("fetchInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	if got := jitter(time.Hour, 0); got != time.Hour {
+		t.Errorf("jitter() = %v, want %v without jitter", got, time.Hour)
+	}
+	for i := 0; i < 100; i++ {
+		if got := jitter(time.Hour, 10); got < 54*time.Minute || got > 66*time.Minute {
+			t.Fatalf("jitter() = %v, want within 10%% of %v", got, time.Hour)
+		}
+	}
+}
+
+func TestSubscribeService_scheduleFetch(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+	// neither the channels nobody subscribes to nor the saved channels are fetched
+	for _, channel := range []*dao.Channel{
+		{Platform: "YouTube", ChannelCredit: "orphan"},
+		{Platform: dao.PlatformSaved, ChannelCredit: SavedChannelCredit("validUser1")},
+	} {
+		if _, err := s.channelMapper.Insert(channel); err != nil {
+			t.Fatalf("Failed to insert channel: %v", err)
+		}
+	}
+	if _, err := s.subscriptionMapper.Insert(&dao.Subscription{UserCredit: "validUser1", ChannelCredit: SavedChannelCredit("validUser1")}); err != nil {
+		t.Fatalf("Failed to insert subscription: %v", err)
+	}
+
+	channel := s.takeNextFetcher()
+	if channel == nil || channel.ChannelCredit != "UC_x5XG1OV2P6uZZ5FSM9Ttw" {
+		t.Fatalf("SubscribeService.takeNextFetcher() = %v, want UC_x5XG1OV2P6uZZ5FSM9Ttw", channel)
+	}
+	// the taken channel is not due until the fetch fails for the min interval
+	if channel := s.takeNextFetcher(); channel != nil {
+		t.Errorf("SubscribeService.takeNextFetcher() = %v, want nil", channel)
+	}
+
+	// the channel uploading daily is fetched every 6 hours
+	now := time.Now()
+	contents := make([]fetcher.Content, 0)
+	for i := 0; i < 5; i++ {
+		contents = append(contents, fetcher.Content{
+			Credit:        "daily" + string(rune('a'+i)),
+			Title:         "Daily",
+			PublishedTime: now.Add(-time.Hour - time.Duration(i)*24*time.Hour),
+			Length:        time.Minute,
+		})
+	}
+	s.updateFetchResult(channel, &fetcher.Result{Contents: contents})
+	channels, err := s.channelMapper.Select(&dao.Channel{ChannelCredit: "UC_x5XG1OV2P6uZZ5FSM9Ttw"})
+	if err != nil || len(channels) == 0 {
+		t.Fatalf("Failed to select channel: %v", err)
+	}
+	if next := channels[0].NextFetchAt.Sub(now); next < 5*time.Hour || next > 7*time.Hour {
+		t.Errorf("Channel next fetch in %v, want about 6h", next)
+	}
+
+	// the channel is fetched shortly after its earliest upcoming content starts, the overdue one is ignored
+	for _, content := range []*dao.Content{
+		{ContentCredit: "overdue", PublishedTime: now.Add(-time.Hour)},
+		{ContentCredit: "premiere", PublishedTime: now.Add(2 * time.Hour)},
+		{ContentCredit: "later", PublishedTime: now.Add(3 * time.Hour)},
+	} {
+		content.ChannelCredit = "UC_x5XG1OV2P6uZZ5FSM9Ttw"
+		content.State = dao.ContentStateUpcoming
+		if _, err := s.contentMapper.Insert(content); err != nil {
+			t.Fatalf("Failed to insert content: %v", err)
+		}
+	}
+	if next := s.nextFetchAt("UC_x5XG1OV2P6uZZ5FSM9Ttw", now); !next.Equal(now.Add(2*time.Hour + upcomingGrace)) {
+		t.Errorf("SubscribeService.nextFetchAt() in %v, want %v", next.Sub(now), 2*time.Hour+upcomingGrace)
+	}
+}
+
+func TestSubscribeService_takeNextFetcherConcurrently(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+	for i := 0; i < 5; i++ {
+		credit := "concurrent" + string(rune('a'+i))
+		if _, err := s.channelMapper.Insert(&dao.Channel{Platform: "YouTube", ChannelCredit: credit}); err != nil {
+			t.Fatalf("Failed to insert channel: %v", err)
+		}
+		if _, err := s.subscriptionMapper.Insert(&dao.Subscription{UserCredit: "validUser1", ChannelCredit: credit}); err != nil {
+			t.Fatalf("Failed to insert subscription: %v", err)
+		}
+	}
+
+	// every due channel is taken once by the workers taking together
+	var mu sync.Mutex
+	taken := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				channel := s.takeNextFetcher()
+				if channel == nil {
+					return
+				}
+				mu.Lock()
+				taken[channel.ChannelCredit]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(taken) != 6 {
+		t.Errorf("SubscribeService.takeNextFetcher() took %d channels, want 6", len(taken))
+	}
+	for credit, n := range taken {
+		if n != 1 {
+			t.Errorf("SubscribeService.takeNextFetcher() took %s %d times, want once", credit, n)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package subscribe
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultSmartPlaylistLimit is the max contents of a smart playlist if not limited by the rules
+	defaultSmartPlaylistLimit = 100
+	maxSmartPlaylistLimit     = 500
+)
+
+// SmartRules define the contents of a smart playlist, which are evaluated on every access, the zero values match
+// all. E.g. the unplayed contents of the channels tagged tech, shorter than 20 minutes, published in the last 7
+// days, newest first.
+type SmartRules struct {
+	Tags                []string     `json:"tags,omitempty"` // the subscriptions tagged with any of the tags
+	Played              *bool        `json:"played,omitempty"`
+	Starred             *bool        `json:"starred,omitempty"`
+	Archived            *bool        `json:"archived,omitempty"`
+	PublishedWithinDays int          `json:"published_within_days,omitempty"`
+	MinLengthSeconds    int          `json:"min_length_seconds,omitempty"`
+	MaxLengthSeconds    int          `json:"max_length_seconds,omitempty"`
+	Order               ContentOrder `json:"order,omitempty"` // newest, oldest, shortest or longest, default to newest
+	Limit               int          `json:"limit,omitempty"` // default to 100, at most 500
+}
+
+// Validate checks the rules.
+func (r *SmartRules) Validate() error {
+	if r.PublishedWithinDays < 0 || r.MinLengthSeconds < 0 || r.MaxLengthSeconds < 0 || r.Limit < 0 {
+		return fmt.Errorf("rules must not be negative")
+	}
+	if r.MaxLengthSeconds > 0 && r.MinLengthSeconds > r.MaxLengthSeconds {
+		return fmt.Errorf("min length must not be greater than max length")
+	}
+	if r.Limit > maxSmartPlaylistLimit {
+		return fmt.Errorf("limit must not be greater than %d", maxSmartPlaylistLimit)
+	}
+	if _, ok := contentOrderBy[r.Order]; !ok {
+		return fmt.Errorf("unknown order %s", r.Order)
+	}
+	return nil
+}
+
+// filter converts the rules to the content filter at the time, and returns the max contents.
+func (r *SmartRules) filter(now time.Time) (*ContentFilter, int) {
+	filter := &ContentFilter{
+		Tags:      r.Tags,
+		Played:    r.Played,
+		Starred:   r.Starred,
+		Archived:  r.Archived,
+		MinLength: time.Duration(r.MinLengthSeconds) * time.Second,
+		MaxLength: time.Duration(r.MaxLengthSeconds) * time.Second,
+		Order:     r.Order,
+	}
+	if r.PublishedWithinDays > 0 {
+		filter.Since = now.AddDate(0, 0, -r.PublishedWithinDays)
+	}
+	limit := r.Limit
+	if limit == 0 {
+		limit = defaultSmartPlaylistLimit
+	}
+	return filter, limit
+}
+
+// SmartRulesOf parses the rules of a smart playlist.
+func SmartRulesOf(playlist *dao.Playlist) (*SmartRules, error) {
+	if playlist.Kind != dao.PlaylistKindSmart {
+		return nil, fmt.Errorf("not a smart playlist")
+	}
+	var rules SmartRules
+	if err := json.Unmarshal([]byte(playlist.Rules), &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules of the smart playlist, err: %v", err)
+	}
+	return &rules, nil
+}
+
+// CreateSmartPlaylist creates a smart playlist for the user. If downloadFirst, the contents matching the rules are
+// downloaded before the others.
+func (s *SubscribeService) CreateSmartPlaylist(userCredit, name string, rules *SmartRules, downloadFirst bool) (*dao.Playlist, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("playlist name must not be empty")
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+	playlist := &dao.Playlist{
+		UserCredit:     userCredit,
+		PlaylistCredit: uuid.NewString(),
+		Name:           name,
+		Kind:           dao.PlaylistKindSmart,
+		Rules:          string(data),
+		DownloadFirst:  downloadFirst,
+		CreateAt:       time.Now(),
+		UpdateAt:       time.Now(),
+	}
+	if _, err := s.playlistMapper.Insert(playlist); err != nil {
+		return nil, fmt.Errorf("failed to create playlist, err: %v", err)
+	}
+	return playlist, nil
+}
+
+// UpdateSmartRules replaces the rules of a smart playlist of the user.
+func (s *SubscribeService) UpdateSmartRules(userCredit, playlistCredit string, rules *SmartRules, downloadFirst bool) error {
+	playlist, err := s.GetPlaylist(userCredit, playlistCredit)
+	if err != nil {
+		return err
+	}
+	if playlist.Kind != dao.PlaylistKindSmart {
+		return fmt.Errorf("not a smart playlist")
+	}
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	if _, err := s.playlistMapper.UpdateColumns(&dao.Playlist{ID: playlist.ID}, map[string]interface{}{
+		"rules":          string(data),
+		"download_first": downloadFirst,
+		"update_at":      time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to update playlist, err: %v", err)
+	}
+	return nil
+}
+
+// evaluateSmartPlaylist lists the contents of the states matching the rules of the smart playlist.
+func (s *SubscribeService) evaluateSmartPlaylist(playlist *dao.Playlist, states []dao.ContentState) ([]*dao.Content, error) {
+	rules, err := SmartRulesOf(playlist)
+	if err != nil {
+		return nil, err
+	}
+	filter, limit := rules.filter(time.Now())
+	return s.filterContent(playlist.UserCredit, filter, states, 1, limit)
+}
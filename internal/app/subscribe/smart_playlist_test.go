@@ -0,0 +1,140 @@
+package subscribe
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+)
+
+func TestSubscribeService_SmartPlaylist(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+	if _, err := s.subscriptionMapper.Insert(&dao.Subscription{UserCredit: "validUser1", ChannelCredit: "tech"}); err != nil {
+		t.Fatalf("Failed to insert subscription: %v", err)
+	}
+	if err := s.SetSubscriptionTags("validUser1", "tech", []string{" Tech ", "news", "tech", ""}); err != nil {
+		t.Fatalf("SubscribeService.SetSubscriptionTags() error = %v", err)
+	}
+	if err := s.SetSubscriptionTags("validUser2", "tech", []string{"tech"}); err == nil {
+		t.Errorf("SubscribeService.SetSubscriptionTags() error = nil for unsubscribed channel, want error")
+	}
+	if subscriptions, _ := s.subscriptionMapper.Select(&dao.Subscription{ChannelCredit: "tech"}); subscriptions[0].Tags != "tech,news" {
+		t.Errorf("Subscription tags = %s, want tech,news", subscriptions[0].Tags)
+	}
+	now := time.Now()
+	for _, content := range []*dao.Content{
+		{ContentCredit: "short", PublishedTime: now.Add(-time.Hour), Length: 10 * time.Minute},
+		{ContentCredit: "long", PublishedTime: now.Add(-2 * time.Hour), Length: time.Hour},
+		{ContentCredit: "shorter", PublishedTime: now.Add(-3 * time.Hour), Length: 5 * time.Minute},
+		{ContentCredit: "old", PublishedTime: now.AddDate(0, 0, -10), Length: 10 * time.Minute},
+		{ContentCredit: "played", PublishedTime: now.Add(-4 * time.Hour), Length: 10 * time.Minute},
+		{ContentCredit: "pending", PublishedTime: now.Add(-5 * time.Hour), Length: 10 * time.Minute, State: dao.ContentStatePrepared},
+	} {
+		content.ChannelCredit = "tech"
+		if content.State == 0 {
+			content.State = dao.ContentStateDownloaded
+		}
+		if _, err := s.contentMapper.Insert(content); err != nil {
+			t.Fatalf("Failed to insert content: %v", err)
+		}
+	}
+	if err := s.MarkPlayed("validUser1", "played", true); err != nil {
+		t.Fatalf("SubscribeService.MarkPlayed() error = %v", err)
+	}
+
+	no := false
+	tests := []struct {
+		name    string
+		rules   SmartRules
+		wantErr bool
+		want    []string
+	}{
+		{
+			name:  "Unplayed short tech of the last week",
+			rules: SmartRules{Tags: []string{"TECH"}, Played: &no, MaxLengthSeconds: 20 * 60, PublishedWithinDays: 7},
+			want:  []string{"short", "shorter"},
+		},
+		{
+			name:  "Shortest first",
+			rules: SmartRules{Tags: []string{"news"}, Order: ContentOrderShortest, Limit: 3},
+			want:  []string{"shorter", "short", "played"},
+		},
+		{
+			name:  "Long ones",
+			rules: SmartRules{MinLengthSeconds: 30 * 60},
+			want:  []string{"long"},
+		},
+		{
+			name:  "Untagged channels never match",
+			rules: SmartRules{Tags: []string{"music"}},
+			want:  []string{},
+		},
+		{
+			name:    "Unknown order",
+			rules:   SmartRules{Order: "random"},
+			wantErr: true,
+		},
+		{
+			name:    "Min length greater than max length",
+			rules:   SmartRules{MinLengthSeconds: 60, MaxLengthSeconds: 30},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playlist, err := s.CreateSmartPlaylist("validUser1", tt.name, &tt.rules, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SubscribeService.CreateSmartPlaylist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			contents, err := s.ListPlaylistContents("validUser1", playlist.PlaylistCredit)
+			if err != nil {
+				t.Fatalf("SubscribeService.ListPlaylistContents() error = %v", err)
+			}
+			got := make([]string, 0, len(contents))
+			for _, content := range contents {
+				got = append(got, content.ContentCredit)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SubscribeService.ListPlaylistContents() = %v, want %v", got, tt.want)
+			}
+			if err := s.AddPlaylistItem("validUser1", playlist.PlaylistCredit, "short", false); err == nil {
+				t.Errorf("SubscribeService.AddPlaylistItem() error = nil for smart playlist, want error")
+			}
+		})
+	}
+
+	// the older pending content of the tech channel is downloaded ahead of the newer one
+	if _, err := s.contentMapper.UpdateColumns(&dao.Content{ContentCredit: "any"}, map[string]interface{}{
+		"published_time": now,
+	}); err != nil {
+		t.Fatalf("Failed to update content: %v", err)
+	}
+	if content := s.takeNextDownload(); content == nil || content.ContentCredit != "any" {
+		t.Fatalf("SubscribeService.takeNextDownload() = %v, want any without smart playlists", content)
+	}
+	if _, err := s.contentMapper.UpdateColumns(&dao.Content{ContentCredit: "any"}, map[string]interface{}{
+		"state": dao.ContentStatePrepared,
+	}); err != nil {
+		t.Fatalf("Failed to update content: %v", err)
+	}
+	playlist, err := s.CreateSmartPlaylist("validUser1", "Tech first", &SmartRules{Tags: []string{"tech"}}, false)
+	if err != nil {
+		t.Fatalf("SubscribeService.CreateSmartPlaylist() error = %v", err)
+	}
+	if err := s.UpdateSmartRules("validUser1", playlist.PlaylistCredit, &SmartRules{Tags: []string{"tech"}}, true); err != nil {
+		t.Fatalf("SubscribeService.UpdateSmartRules() error = %v", err)
+	}
+	if content := s.takeNextDownload(); content == nil || content.ContentCredit != "pending" {
+		t.Errorf("SubscribeService.takeNextDownload() = %v, want pending", content)
+	}
+}
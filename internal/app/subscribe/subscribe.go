@@ -3,13 +3,21 @@ package subscribe
 import (
 	"context"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 
 	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/storage"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/tube/downloader"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/tube/fetcher"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/util/str"
@@ -26,8 +34,17 @@ type SubscribeService struct {
 	channelMapper      *dao.ChannelMapper
 	contentMapper      *dao.ContentMapper
 	userMapper         *dao.UserMapper
+	listenStateMapper  *dao.ListenStateMapper
+	playlistMapper     *dao.PlaylistMapper
+	playlistItemMapper *dao.PlaylistItemMapper
 	downloader         *downloader.Downloader
 	fetcher            *fetcher.Fetcher
+	storage            storage.Storage
+	basePath           string
+	fetcherConfig      *conf.FetcherConfig
+	retentionConfig    *conf.RetentionConfig
+	storageConfig      *conf.StorageConfig
+	lookupIPAddr       func(ctx context.Context, host string) ([]net.IPAddr, error) // resolves the hosts of the imported urls
 }
 
 func NewSubscribeService(mapper *dao.UnionMapper, config *conf.SubscriberConfig) (*SubscribeService, error) {
@@ -39,82 +56,177 @@ func NewSubscribeService(mapper *dao.UnionMapper, config *conf.SubscriberConfig)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create fetcher")
 	}
-	ss := &SubscribeService{
+	storage, err := storage.NewStorage(config.StorageConfig, config.DownloaderConfig.BasePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create storage")
+	}
+	return newSubscribeService(mapper, config, downloader, fetcher, storage), nil
+}
+
+func newSubscribeService(mapper *dao.UnionMapper, config *conf.SubscriberConfig, downloader *downloader.Downloader,
+	fetcher *fetcher.Fetcher, storage storage.Storage) *SubscribeService {
+	return &SubscribeService{
 		subscriptionMapper: mapper.SubscriptionMapper,
 		userMapper:         mapper.UserMapper,
 		channelMapper:      mapper.ChannelMapper,
 		contentMapper:      mapper.ContentMapper,
+		listenStateMapper:  mapper.ListenStateMapper,
+		playlistMapper:     mapper.PlaylistMapper,
+		playlistItemMapper: mapper.PlaylistItemMapper,
 		downloader:         downloader,
 		fetcher:            fetcher,
+		storage:            storage,
+		basePath:           config.DownloaderConfig.BasePath,
+		fetcherConfig:      config.FetcherConfig,
+		retentionConfig:    config.RetentionConfig,
+		storageConfig:      config.StorageConfig,
+		lookupIPAddr:       net.DefaultResolver.LookupIPAddr,
 	}
-
-	return ss, nil
 }
 
 // Start the background tasks to fetch and download content periodically
 func (s *SubscribeService) Start(ctx context.Context) error {
+	// contents left in downloading state by the last run will never finish, put them back to the queue
+	if _, err := s.contentMapper.UpdateColumns(&dao.Content{State: dao.ContentStateDownloading}, map[string]interface{}{
+		"state": dao.ContentStatePrepared,
+	}); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.Wrap(err, "failed to reset downloading contents")
+	}
 	go s.fetcher.TryStart(ctx, s.takeNextFetcher, s.updateFetchResult)
 	go s.downloader.TryStart(ctx, s.takeNextDownload, s.updateDownloadResult)
+	go s.tryStartRetention(ctx)
 	return nil
 }
 
 // TODO: test this method
 func (s *SubscribeService) takeNextDownload() *dao.Content {
-	sql := "SELECT * FROM t_content WHERE state = ? ORDER BY published_time DESC LIMIT 1"
-	contents, err := s.contentMapper.SelectBySQL(sql, dao.ContentStatePrepared)
+	content, err := s.nextDownload(time.Now())
 	if err != nil {
-		log.Errorf("failed to list content: %v", err)
+		log.Errorf("failed to take the next download: %v", err)
 		return nil
 	}
-	if len(contents) == 0 {
+	if content == nil {
 		log.Warn("no content to download...")
 		return nil
 	}
-	return contents[0]
+	// mark the content as downloading, so that it can be canceled or requeued
+	if _, err := s.contentMapper.UpdateColumns(&dao.Content{ID: content.ID, State: dao.ContentStatePrepared}, map[string]interface{}{
+		"state": dao.ContentStateDownloading,
+	}); err != nil {
+		log.Errorf("failed to mark content %s as downloading, err:%v", content.ContentCredit, err)
+		return nil
+	}
+	return content
 }
 
 // TODO: test this method
 func (s *SubscribeService) updateDownloadResult(c dao.Content, r *downloader.Result) {
-	state := dao.ContentStateDownloaded
-	info := "finished"
+	columns := map[string]interface{}{
+		"state":     dao.ContentStateDownloaded,
+		"info":      "finished",
+		"force":     false,
+		"priority":  0,
+		"access_at": time.Now(),
+		"update_at": time.Now(),
+	}
+	if r.Finished {
+		if fi, err := os.Stat(r.Output); err == nil {
+			columns["size"] = fi.Size()
+		}
+		// move the downloaded file into the storage, the key is relative to the base path
+		key, err := filepath.Rel(s.basePath, r.Output)
+		if err != nil || strings.HasPrefix(key, "..") {
+			key = r.Output
+		}
+		if err := s.storage.Put(context.Background(), key, r.Output); err != nil {
+			log.Errorf("failed to store content %s, err:%v", c.ContentCredit, err)
+			r = &downloader.Result{Finished: false, Reason: "failed to store the file"}
+		}
+		columns["path"] = key
+	}
 	if !r.Finished {
-		state = dao.ContentStateFailed
+		columns = map[string]interface{}{
+			"state":     dao.ContentStateFailed,
+			"info":      "failed",
+			"update_at": time.Now(),
+		}
+		if r.Canceled {
+			columns["info"] = "canceled"
+		} else if r.Reason != "" {
+			columns["info"] = "failed: " + r.Reason
+		}
 		log.Warnf("Finished download content %s with failed", c.ContentCredit)
 	}
-	_, err := s.contentMapper.Update(&dao.Content{ID: c.ID}, &dao.Content{
-		State:    state,
-		Path:     r.Output,
-		Info:     info,
-		UpdateAt: time.Now(),
-	})
-	if err != nil {
+	// only update the content still in downloading state, it may be requeued during the download
+	_, err := s.contentMapper.UpdateColumns(&dao.Content{ID: c.ID, State: dao.ContentStateDownloading}, columns)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Infof("content %s is requeued during the download, drop the result", c.ContentCredit)
+	} else if err != nil {
 		log.Errorf("failed to update content %s, err%v", c.ContentCredit, err)
 	}
 }
 
-// TODO: test this method
+// takeNextFetcher claims the subscribed channel due to fetch first, or returns nil if none is due. The channel is
+// scheduled to fetch again after the min interval, in case the fetch fails. It's safe to take concurrently, each due
+// channel is claimed once.
 func (s *SubscribeService) takeNextFetcher() *dao.Channel {
-	sql := "SELECT * FROM t_channel ORDER BY update_at ASC LIMIT 1"
-	channels, err := s.channelMapper.SelectBySQL(sql)
+	// the saved pseudo-channels have nothing to fetch, nor the channels nobody subscribes to any more
+	sql := "SELECT * FROM t_channel c WHERE c.platform <> ? AND (c.next_fetch_at IS NULL OR c.next_fetch_at <= ?) " +
+		"AND EXISTS (SELECT 1 FROM t_subscription s WHERE s.channel_credit = c.channel_credit) ORDER BY c.next_fetch_at ASC LIMIT ?"
+	now := time.Now()
+	channels, err := s.channelMapper.SelectBySQL(sql, dao.PlatformSaved, now, fetchCandidates)
 	if err != nil {
 		log.Errorf("failed to list channel, err:%v", err)
 		return nil
 	}
-	if len(channels) == 0 {
-		log.Warn("no channel to fetch...")
-		return nil
+	minInterval, _, _ := s.fetchIntervals()
+	for _, channel := range channels {
+		// claim the channel only if it's still due, it may be claimed by another worker in the meantime
+		claimed, err := s.channelMapper.ExecBySQL("UPDATE t_channel SET next_fetch_at = ? WHERE id = ? AND (next_fetch_at IS NULL OR next_fetch_at <= ?)",
+			now.Add(minInterval), channel.ID, now)
+		if err != nil {
+			log.Errorf("failed to schedule channel %s, err:%v", channel.ChannelCredit, err)
+			continue
+		}
+		if claimed > 0 {
+			return channel
+		}
 	}
-	return channels[0]
+	log.Debug("no channel to fetch...")
+	return nil
 }
 
 // TODO: test this method
 func (s *SubscribeService) updateFetchResult(c *dao.Channel, r *fetcher.Result) {
+	filters, err := s.listChannelFilters(c.ChannelCredit)
+	if err != nil {
+		log.Errorf("failed to list filters of channel %s, err:%v", c.ChannelCredit, err)
+	}
 	for _, content := range r.Contents {
-		state := dao.ContentStatePrepared
-		info := "prepared"
-		if content.MembersOnly {
-			state = dao.ContentStateFailed
-			info = "skip for members only"
+		state, info := fetchedState(filters, &content)
+		oldContents, err := s.contentMapper.Select(&dao.Content{ContentCredit: content.Credit})
+		if err != nil {
+			log.Errorf("failed to list content %s, err:%v", content.Credit, err)
+			continue
+		}
+		if len(oldContents) > 0 {
+			if oldContents[0].State != dao.ContentStateUpcoming {
+				log.Debugf("content %s already exists", content.Credit)
+				continue
+			}
+			// re-check the upcoming content until it's aired
+			if _, err := s.contentMapper.UpdateColumns(&dao.Content{ID: oldContents[0].ID}, map[string]interface{}{
+				"state":          state,
+				"info":           info,
+				"type":           content.Type,
+				"title":          content.Title,
+				"published_time": content.PublishedTime,
+				"length":         content.Length,
+				"update_at":      time.Now(),
+			}); err != nil {
+				log.Errorf("failed to update content %s, err:%v", content.Credit, err)
+			}
+			continue
 		}
 		newContent := &dao.Content{
 			Platform:      "YouTube",
@@ -123,30 +235,39 @@ func (s *SubscribeService) updateFetchResult(c *dao.Channel, r *fetcher.Result)
 			Thumbnail:     content.Thumbnail,
 			ContentCredit: content.Credit,
 			State:         state,
+			Type:          content.Type,
 			Info:          info,
 			PublishedTime: content.PublishedTime,
 			Length:        content.Length,
 			CreateAt:      time.Now(),
 			UpdateAt:      time.Now(),
 		}
-		if oldContents, err := s.contentMapper.Select(&dao.Content{ContentCredit: content.Credit}); err != nil {
-			log.Errorf("failed to list content %s, err:%v", content.Credit, err)
-			continue
-		} else if len(oldContents) > 0 {
-			log.Debugf("content %s already exists", content.Credit)
-			continue
-		}
 		if _, err := s.contentMapper.Insert(newContent); err != nil {
 			log.Errorf("failed to create content %s, err:%v", content.Credit, err)
 		}
 	}
 	if _, err := s.channelMapper.Update(&dao.Channel{ID: c.ID}, &dao.Channel{
-		UpdateAt: time.Now(),
+		NextFetchAt: s.nextFetchAt(c.ChannelCredit, time.Now()),
+		UpdateAt:    time.Now(),
 	}); err != nil {
 		log.Errorf("failed to update channel %s, err:%v", c.ChannelCredit, err)
 	}
 }
 
+// fetchedState decides the state of the fetched content, the contents not aired yet wait to be re-checked.
+func fetchedState(filters []*SubscriptionFilter, content *fetcher.Content) (dao.ContentState, string) {
+	if content.MembersOnly {
+		return dao.ContentStateFailed, "skip for members only"
+	}
+	if !content.Aired() {
+		return dao.ContentStateUpcoming, "waiting to air"
+	}
+	if reason := rejectByAll(filters, content); reason != "" {
+		return dao.ContentStateSkipped, "skipped by the filter: " + reason
+	}
+	return dao.ContentStatePrepared, "prepared"
+}
+
 // AddSubscription adds a new subscription for a user to a channel.
 func (s *SubscribeService) AddSubscription(userCredit, channelCredit string) error {
 	// check if the user exists
@@ -234,13 +355,56 @@ func (s *SubscribeService) ListSubscription(userCredit string) ([]*dao.Subscript
 	return s.subscriptionMapper.Select(&dao.Subscription{UserCredit: userCredit})
 }
 
+// SetSubscriptionTags replaces the tags of a subscription, the tags are case insensitive.
+func (s *SubscribeService) SetSubscriptionTags(userCredit, channelCredit string, tags []string) error {
+	subscriptions, err := s.subscriptionMapper.Select(&dao.Subscription{UserCredit: userCredit, ChannelCredit: channelCredit})
+	if err != nil || len(subscriptions) == 0 {
+		return fmt.Errorf("not subscribed to the channel")
+	}
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		if strings.Contains(tag, ",") {
+			return fmt.Errorf("tag must not contain comma")
+		}
+		normalized = append(normalized, tag)
+	}
+	if _, err := s.subscriptionMapper.UpdateColumns(&dao.Subscription{ID: subscriptions[0].ID}, map[string]interface{}{
+		"tags":      str.ArrayToStringWithSplit(normalized, ","),
+		"update_at": time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to update subscription, err: %v", err)
+	}
+	return nil
+}
+
 // ListContent lists all contents for a user.
 func (s *SubscribeService) ListContent(userCredit string, pageIndex, pageSize int) ([]*dao.Content, error) {
+	return s.FilterContent(userCredit, &ContentFilter{}, pageIndex, pageSize)
+}
+
+// FilterContent lists the contents for a user by the filter.
+func (s *SubscribeService) FilterContent(userCredit string, filter *ContentFilter, pageIndex, pageSize int) ([]*dao.Content, error) {
+	// the evicted contents are listed as well, they are downloaded again on demand
+	return s.filterContent(userCredit, filter, []dao.ContentState{dao.ContentStateDownloaded, dao.ContentStateEvicted},
+		pageIndex, pageSize)
+}
+
+// filterContent lists the contents of the states for a user by the filter.
+func (s *SubscribeService) filterContent(userCredit string, filter *ContentFilter, states []dao.ContentState,
+	pageIndex, pageSize int) ([]*dao.Content, error) {
 	// check if the user exists
 	user, err := s.userMapper.Select(&dao.User{Credit: userCredit})
 	if err != nil || len(user) == 0 {
 		return nil, fmt.Errorf("user does not exist")
 	}
+	orderBy, ok := contentOrderBy[filter.Order]
+	if !ok {
+		return nil, fmt.Errorf("unknown order %s", filter.Order)
+	}
 
 	// list the subscribed channels of the user
 	subscriptions, err := s.subscriptionMapper.Select(&dao.Subscription{UserCredit: userCredit})
@@ -249,16 +413,25 @@ func (s *SubscribeService) ListContent(userCredit string, pageIndex, pageSize in
 	}
 	channelCredits := make([]interface{}, 0)
 	for _, subscription := range subscriptions {
-		channelCredits = append(channelCredits, subscription.ChannelCredit)
+		if (filter.ChannelCredit == "" || filter.ChannelCredit == subscription.ChannelCredit) && filter.matchTags(subscription) {
+			channelCredits = append(channelCredits, subscription.ChannelCredit)
+		}
 	}
 
 	// list the contents of the subscribed channels
-	pageSql := "SELECT * FROM t_content WHERE state = 3 AND channel_credit IN (?) ORDER BY published_time DESC LIMIT ? OFFSET ?"
-	return s.contentMapper.SelectBySQL(pageSql, channelCredits, pageSize, (pageIndex-1)*pageSize)
+	where, args := filter.where()
+	pageSql := "SELECT c.* FROM t_content c LEFT JOIN t_listen_state l ON l.content_credit = c.content_credit AND l.user_credit = ? " +
+		"WHERE c.state IN (?) AND c.channel_credit IN (?)" + where + orderBy + " LIMIT ? OFFSET ?"
+	args = append([]interface{}{userCredit, states, channelCredits}, args...)
+	return s.contentMapper.SelectBySQL(pageSql, append(args, pageSize, (pageIndex-1)*pageSize)...)
 }
 
 // GetContent gets a content by its credit.
 func (s *SubscribeService) GetContent(contentCredit string) (*dao.Content, error) {
+	// an empty credit would be dropped from the where clause and match any content
+	if contentCredit == "" {
+		return nil, fmt.Errorf("content does not exist")
+	}
 	// list the content by its credit
 	contents, err := s.contentMapper.Select(&dao.Content{ContentCredit: contentCredit})
 	if err != nil || len(contents) == 0 {
@@ -267,6 +440,72 @@ func (s *SubscribeService) GetContent(contentCredit string) (*dao.Content, error
 	return contents[0], nil
 }
 
+// ErrContentEvicted is returned when accessing an evicted content, which is requeued to download again.
+var ErrContentEvicted = errors.New("content is evicted, downloading again")
+
+// AccessContent gets a downloaded content of the user's subscribed channels and records the access time.
+// The evicted content is put back to the download queue, and ErrContentEvicted is returned.
+func (s *SubscribeService) AccessContent(userCredit, contentCredit string) (*dao.Content, error) {
+	content, err := s.GetSubscribedContent(userCredit, contentCredit)
+	if err != nil {
+		return nil, err
+	}
+	switch content.State {
+	case dao.ContentStateDownloaded:
+		if _, err := s.contentMapper.UpdateColumns(&dao.Content{ID: content.ID}, map[string]interface{}{
+			"access_at": time.Now(),
+		}); err != nil {
+			log.Warnf("failed to update access time of content %s, err:%v", contentCredit, err)
+		}
+		return content, nil
+	case dao.ContentStateEvicted:
+		if _, err := s.contentMapper.UpdateColumns(&dao.Content{ID: content.ID, State: dao.ContentStateEvicted}, map[string]interface{}{
+			"state":     dao.ContentStatePrepared,
+			"info":      "requeued on demand",
+			"priority":  manualPriority,
+			"update_at": time.Now(),
+		}); err != nil {
+			log.Errorf("failed to requeue evicted content %s, err:%v", contentCredit, err)
+		}
+		return nil, ErrContentEvicted
+	default:
+		return nil, fmt.Errorf("content is not downloaded")
+	}
+}
+
+// OpenContent opens the downloaded file of a content from the storage.
+func (s *SubscribeService) OpenContent(ctx context.Context, content *dao.Content) (io.ReadSeekCloser, *storage.ObjectInfo, error) {
+	return s.storage.Open(ctx, content.Path)
+}
+
+// PresignContentURL returns a temporary url to read the content directly from the storage, or empty if the
+// contents are streamed through the server.
+func (s *SubscribeService) PresignContentURL(ctx context.Context, content *dao.Content) (string, error) {
+	if s.storageConfig == nil || s.storageConfig.StreamMode != conf.RedirectStreamMode {
+		return "", nil
+	}
+	expiry := time.Duration(s.storageConfig.PresignExpirySeconds) * time.Second
+	if expiry <= 0 {
+		expiry = time.Hour
+	}
+	return s.storage.PresignURL(ctx, content.Path, expiry)
+}
+
+// MarkPlayed marks a content as played or unplayed by the user, marking as unplayed starts it over.
+func (s *SubscribeService) MarkPlayed(userCredit, contentCredit string, played bool) error {
+	if _, err := s.GetSubscribedContent(userCredit, contentCredit); err != nil {
+		return err
+	}
+	columns := map[string]interface{}{
+		"played":    played,
+		"played_at": time.Now(),
+	}
+	if !played {
+		columns["position"] = 0
+	}
+	return s.saveListenState(userCredit, contentCredit, columns)
+}
+
 // GetChannel gets a channel by its credit.
 func (s *SubscribeService) GetChannel(channelCredit string) (*dao.Channel, error) {
 	// list the channel by its credit
@@ -276,3 +515,64 @@ func (s *SubscribeService) GetChannel(channelCredit string) (*dao.Channel, error
 	}
 	return channels[0], nil
 }
+
+// CancelDownload cancels the in-flight download of a content of the user's subscribed channels.
+func (s *SubscribeService) CancelDownload(userCredit, contentCredit string) error {
+	content, err := s.GetSubscribedContent(userCredit, contentCredit)
+	if err != nil {
+		return err
+	}
+	if content.State != dao.ContentStateDownloading {
+		return fmt.Errorf("content is not downloading")
+	}
+	if err := s.downloader.Cancel(contentCredit); err != nil {
+		return fmt.Errorf("content is not downloading")
+	}
+	return nil
+}
+
+// RequeueContent puts a failed or skipped content back to the download queue. If force, the content is re-downloaded
+// whatever its state is, and the in-flight download is canceled.
+func (s *SubscribeService) RequeueContent(userCredit, contentCredit string, force bool) error {
+	content, err := s.GetSubscribedContent(userCredit, contentCredit)
+	if err != nil {
+		return err
+	}
+	info := "requeued"
+	if force {
+		info = "requeued to re-download"
+		if content.State == dao.ContentStateDownloading {
+			_ = s.downloader.Cancel(contentCredit)
+		}
+	} else if content.State != dao.ContentStateFailed && content.State != dao.ContentStateSkipped {
+		return fmt.Errorf("only failed or skipped content can be requeued")
+	}
+	if _, err := s.contentMapper.UpdateColumns(&dao.Content{ID: content.ID}, map[string]interface{}{
+		"state":     dao.ContentStatePrepared,
+		"info":      info,
+		"force":     force,
+		"priority":  manualPriority,
+		"update_at": time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to requeue content, err: %v", err)
+	}
+	return nil
+}
+
+// DownloaderStatus returns the status of the download queue.
+func (s *SubscribeService) DownloaderStatus() downloader.Status {
+	return s.downloader.Status()
+}
+
+// GetSubscribedContent gets a content by its credit, the user must subscribe to the channel of the content.
+func (s *SubscribeService) GetSubscribedContent(userCredit, contentCredit string) (*dao.Content, error) {
+	content, err := s.GetContent(contentCredit)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions, err := s.subscriptionMapper.Select(&dao.Subscription{UserCredit: userCredit, ChannelCredit: content.ChannelCredit})
+	if err != nil || len(subscriptions) == 0 {
+		return nil, fmt.Errorf("not subscribed to the channel of the content")
+	}
+	return content, nil
+}
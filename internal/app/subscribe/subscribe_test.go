@@ -1,16 +1,20 @@
 package subscribe
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/storage"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/tube/downloader"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/tube/fetcher"
 )
@@ -149,21 +153,74 @@ func MockSubscribeService() *SubscribeService {
 		YtDlpLink:   "https://github.com/yt-dlp/yt-dlp/releases/latest/download/yt-dlp_linux",
 		BasePath: "/tmp/listen-tube-test/",
 		DownloadIntervalSeconds: 0,
+		Backend: "fake",
 	}
 	fetcherConfig := &conf.FetcherConfig{
 		Enable: true,
 		FetcheIntervalSeconds: 0,
 	}
 
-	subscribeService, err := NewSubscribeService(unionMapper, &conf.SubscriberConfig{
-		DownloaderConfig: downloaderConfig,
-		FetcherConfig: 	fetcherConfig,
-	})
+	d, err := downloader.NewDownloaderWithBackends(downloaderConfig, &fakeBackend{})
 	if err != nil {
 		panic(err)
 	}
 
-	return subscribeService
+	s := newSubscribeService(unionMapper, &conf.SubscriberConfig{
+		DownloaderConfig: downloaderConfig,
+		FetcherConfig:    fetcherConfig,
+		RetentionConfig:  &conf.RetentionConfig{},
+	}, d, fetcher.NewFetcher(fetcherConfig), storage.NewLocalStorage(downloaderConfig.BasePath))
+	s.lookupIPAddr = fakeLookupIPAddr
+	return s
+}
+
+// fakeLookupIPAddr resolves the ip hosts as is, the intranet.example to a private address and the others to a public
+// one, without touching the network.
+func fakeLookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+	if host == "intranet.example" {
+		return []net.IPAddr{{IP: net.ParseIP("10.0.0.1")}}, nil
+	}
+	return []net.IPAddr{{IP: net.ParseIP("203.0.113.1")}}, nil
+}
+
+// fakeBackend pretends to download contents without touching the network.
+type fakeBackend struct{}
+
+func (b *fakeBackend) Name() string {
+	return "fake"
+}
+
+func (b *fakeBackend) Prepare() error {
+	return nil
+}
+
+func (b *fakeBackend) Download(ctx context.Context, opt *downloader.DownloadOption, output string, progress func(float64)) error {
+	progress(100)
+	return os.WriteFile(output, []byte(opt.ContentCredit), 0644)
+}
+
+func (b *fakeBackend) Cancel(contentCredit string) error {
+	return nil
+}
+
+// Probe accepts the youtube urls only, the short links are resolved to the watch page.
+func (b *fakeBackend) Probe(ctx context.Context, url string) (*downloader.Metadata, error) {
+	id, ok := strings.CutPrefix(url, "https://youtu.be/")
+	if !ok {
+		if id, ok = strings.CutPrefix(url, "https://www.youtube.com/watch?v="); !ok {
+			return nil, downloader.ErrUnsupportedURL
+		}
+	}
+	return &downloader.Metadata{
+		ID:       id,
+		Platform: "Youtube",
+		URL:      "https://www.youtube.com/watch?v=" + id,
+		Title:    "Video " + id,
+		Length:   10 * time.Minute,
+	}, nil
 }
 
 func TestSubscribeService_AddSubscription(t *testing.T) {
@@ -481,3 +538,104 @@ func TestConstant_list(t *testing.T) {
 		t.Errorf("ContentStateDownloaded = %v, want 3", dao.ContentStateDownloaded)
 	}
 }
+
+func TestSubscribeService_RequeueContent(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	tests := []struct {
+		name          string
+		userCredit    string
+		contentCredit string
+		state         dao.ContentState
+		force         bool
+		wantErr       bool
+	}{
+		{
+			name:          "Requeue failed content",
+			userCredit:    "validUser1",
+			contentCredit: "dQw4w9WgXcQ",
+			state:         dao.ContentStateFailed,
+			force:         false,
+			wantErr:       false,
+		},
+		{
+			name:          "Requeue downloaded content",
+			userCredit:    "validUser1",
+			contentCredit: "dQw4w9WgXcQ",
+			state:         dao.ContentStateDownloaded,
+			force:         false,
+			wantErr:       true,
+		},
+		{
+			name:          "Force re-download downloaded content",
+			userCredit:    "validUser1",
+			contentCredit: "dQw4w9WgXcQ",
+			state:         dao.ContentStateDownloaded,
+			force:         true,
+			wantErr:       false,
+		},
+		{
+			name:          "Requeue content of unsubscribed channel",
+			userCredit:    "validUser2",
+			contentCredit: "dQw4w9WgXcQ",
+			state:         dao.ContentStateFailed,
+			force:         false,
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := MockSubscribeService()
+			teardownTest := setupTest(t, s)
+			defer teardownTest(t)
+
+			if _, err := s.contentMapper.Update(&dao.Content{ID: 1}, &dao.Content{State: tt.state}); err != nil {
+				t.Fatalf("Failed to update content state: %v", err)
+			}
+			err := s.RequeueContent(tt.userCredit, tt.contentCredit, tt.force)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SubscribeService.RequeueContent() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			content, err := s.GetContent(tt.contentCredit)
+			if err != nil {
+				t.Fatalf("Failed to get content: %v", err)
+			}
+			if content.State != dao.ContentStatePrepared || content.Force != tt.force {
+				t.Errorf("Content state = %v, force = %v, want %v, %v", content.State, content.Force, dao.ContentStatePrepared, tt.force)
+			}
+		})
+	}
+}
+
+func TestSubscribeService_CancelDownload(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	s := MockSubscribeService()
+	teardownTest := setupTest(t, s)
+	defer teardownTest(t)
+
+	if err := s.CancelDownload("validUser1", "dQw4w9WgXcQ"); err == nil {
+		t.Errorf("SubscribeService.CancelDownload() error = nil for downloaded content, want error")
+	}
+
+	// a canceled download is dropped if the content has been requeued meanwhile
+	content := s.takeNextDownload()
+	if err := s.RequeueContent("validUser1", content.ContentCredit, true); err != nil {
+		t.Fatalf("SubscribeService.RequeueContent() error = %v", err)
+	}
+	s.updateDownloadResult(*content, &downloader.Result{Finished: false, Canceled: true})
+	got, err := s.GetContent(content.ContentCredit)
+	if err != nil {
+		t.Fatalf("Failed to get content: %v", err)
+	}
+	if got.State != dao.ContentStatePrepared {
+		t.Errorf("Content state = %v, want %v", got.State, dao.ContentStatePrepared)
+	}
+}
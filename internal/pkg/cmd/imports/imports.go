@@ -0,0 +1,72 @@
+package imports
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gogodjzhu/listen-tube/internal/app/subscribe"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/cmd"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/spf13/cobra"
+)
+
+// NewCmdImport creates the command to import a single content by its url into the saved channel of a user, the
+// content is downloaded by the running restful server.
+func NewCmdImport(f *cmd.Factory) *cobra.Command {
+	var configPath string
+	var userName string
+	cmd := &cobra.Command{
+		Use:    "import <url>",
+		Short:  "import a single video into the saved channel of the user",
+		Args:   cobra.ExactArgs(1),
+		Hidden: false,
+		Run: func(cmd *cobra.Command, args []string) {
+			if configPath == "" || userName == "" {
+				fmt.Fprintln(f.IOStreams.Out, "[Err] config path and user are required")
+				return
+			}
+			configContent, err := os.ReadFile(configPath)
+			if err != nil {
+				fmt.Fprintln(f.IOStreams.Out, "[Err] read config failed", err)
+				return
+			}
+			config, err := conf.ReadConfig(configContent)
+			if err != nil {
+				fmt.Fprintln(f.IOStreams.Out, "[Err] read config failed", err)
+				return
+			}
+			ds, err := db.NewDatabaseSource(config.DBConfig)
+			if err != nil {
+				fmt.Fprintln(f.IOStreams.Out, "[Err] open database failed", err)
+				return
+			}
+			unionMapper, err := dao.NewUnionMapper(ds)
+			if err != nil {
+				fmt.Fprintln(f.IOStreams.Out, "[Err] open database failed", err)
+				return
+			}
+			users, err := unionMapper.UserMapper.Select(&dao.User{Name: userName})
+			if err != nil || len(users) == 0 {
+				fmt.Fprintln(f.IOStreams.Out, "[Err] user does not exist:", userName)
+				return
+			}
+			subscribeService, err := subscribe.NewSubscribeService(unionMapper, config.SubscriberConfig)
+			if err != nil {
+				fmt.Fprintln(f.IOStreams.Out, "[Err] create subscribe service failed", err)
+				return
+			}
+			content, err := subscribeService.ImportContent(cmd.Context(), users[0].Credit, args[0])
+			if err != nil {
+				fmt.Fprintln(f.IOStreams.Out, "[Err] import failed", err)
+				return
+			}
+			fmt.Fprintln(f.IOStreams.Out, "[Info] imported", content.ContentCredit+":", content.Title)
+		},
+	}
+	cmd.Flags().StringVarP(&configPath, "config", "c", "", "config file path")
+	cmd.Flags().StringVarP(&userName, "user", "u", "", "name of the user to import for")
+
+	return cmd
+}
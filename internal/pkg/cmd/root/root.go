@@ -2,6 +2,7 @@ package root
 
 import (
 	"github.com/gogodjzhu/listen-tube/internal/pkg/cmd"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/cmd/imports"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/cmd/restful"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/cmd/version"
 	"github.com/spf13/cobra"
@@ -23,6 +24,7 @@ func NewCmdRoot(f *cmd.Factory) (*cobra.Command, error) {
 
 	restfulCmd := restful.NewCmdRestful(f)
 	cmd.AddCommand(restfulCmd)
+	cmd.AddCommand(imports.NewCmdImport(f))
 
 	return cmd, nil
 }
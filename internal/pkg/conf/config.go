@@ -8,11 +8,85 @@ type Config struct {
 	WebConfig        *WebConfig        `yaml:"web"`
 	DBConfig         *DBConfig         `yaml:"db"`
 	SubscriberConfig *SubscriberConfig `yaml:"subscriber"`
+	AuthConfig       *AuthConfig       `yaml:"auth"`
 }
 
 type WebConfig struct {
-	Port int    `yaml:"port"`
-	Host string `yaml:"host"`
+	Port           int      `yaml:"port"`
+	Host           string   `yaml:"host"`
+	ExternalURL    string   `yaml:"external_url"`    // the url the clients reach the server by, default to http://host:port
+	TrustedProxies []string `yaml:"trusted_proxies"` // ips or cidrs of the reverse proxies to take the client ips from, default to none
+}
+
+type AuthConfig struct {
+	Registration        RegistrationMode     `yaml:"registration"`
+	Admins              []string             `yaml:"admins"` // names of the users who are always admins, besides the admin role
+	JWTConfig           *JWTConfig           `yaml:"jwt"`
+	StreamSigningConfig *StreamSigningConfig `yaml:"stream_signing"`
+	LoginLimitConfig    *LoginLimitConfig    `yaml:"login_limit"`
+	OIDCConfig          *OIDCConfig          `yaml:"oidc"`
+}
+
+// RegistrationMode defines who can register a new user.
+type RegistrationMode string
+
+const (
+	// InviteRegistration requires an invite code, except for the first user
+	InviteRegistration RegistrationMode = "invite"
+	// OpenRegistration allows anyone to register
+	OpenRegistration RegistrationMode = "open"
+	// ClosedRegistration disables the registration
+	ClosedRegistration RegistrationMode = "closed"
+)
+
+// JWTConfig defines how the JWTs are signed and verified. New tokens are signed by the active key, and the tokens
+// signed by any of the keys are accepted, so that the keys can be rotated without logging everyone out.
+type JWTConfig struct {
+	Realm             string          `yaml:"realm"`
+	TimeoutSeconds    int             `yaml:"timeout_seconds"`
+	MaxRefreshSeconds int             `yaml:"max_refresh_seconds"`
+	ActiveKey         string          `yaml:"active_key"` // id of the signing key, default to the first key
+	Keys              []*JWTKeyConfig `yaml:"keys"`
+}
+
+// JWTKeyConfig defines a key to sign or verify the JWTs.
+type JWTKeyConfig struct {
+	ID             string `yaml:"id"`
+	Algorithm      string `yaml:"algorithm"`        // HS256, HS384, HS512, RS256, RS384, RS512 or EdDSA
+	Secret         string `yaml:"secret"`           // secret of the HS algorithms
+	PrivateKeyFile string `yaml:"private_key_file"` // PEM private key of the RS and EdDSA algorithms, only required by the active key
+	PublicKeyFile  string `yaml:"public_key_file"`  // PEM public key of the RS and EdDSA algorithms
+}
+
+// StreamSigningConfig defines the HMAC key and expiry of the signed stream urls.
+type StreamSigningConfig struct {
+	Key           string `yaml:"key"`
+	ExpirySeconds int    `yaml:"expiry_seconds"`
+}
+
+// LoginLimitConfig defines how the failed logins are throttled. Once the failures of a user name or an ip within the
+// window reach the limit, the logins are locked out, and the lockout doubles on every further failure.
+type LoginLimitConfig struct {
+	WindowSeconds     int `yaml:"window_seconds"`
+	MaxUserFailures   int `yaml:"max_user_failures"` // failures of a user name, cleared on a successful login
+	MaxIPFailures     int `yaml:"max_ip_failures"`   // failures from an ip, whatever the user names
+	LockoutSeconds    int `yaml:"lockout_seconds"`   // the first lockout
+	MaxLockoutSeconds int `yaml:"max_lockout_seconds"`
+}
+
+// OIDCConfig defines the OpenID Connect provider to log in with, besides the user name and password. The users are
+// provisioned on the first login and linked by the issuer and subject.
+type OIDCConfig struct {
+	Enable       bool              `yaml:"enable"`
+	Issuer       string            `yaml:"issuer"` // the provider configuration is discovered from the issuer
+	ClientID     string            `yaml:"client_id"`
+	ClientSecret string            `yaml:"client_secret"`  // empty for the public clients, which rely on PKCE only
+	RedirectURL  string            `yaml:"redirect_url"`   // the callback url registered at the provider, ends with /auth/oidc/callback
+	Scopes       []string          `yaml:"scopes"`         // default to openid, profile, email and groups
+	GroupsClaim  string            `yaml:"groups_claim"`   // default to groups
+	RoleMapping  map[string]string `yaml:"role_mapping"`   // group to role, the most privileged role of the groups wins
+	DefaultRole  string            `yaml:"default_role"`   // role of the users in none of the mapped groups, default to member
+	PostLoginURL string            `yaml:"post_login_url"` // where to redirect after login, respond the token if empty
 }
 
 type DBConfig struct {
@@ -30,12 +104,25 @@ const (
 type SubscriberConfig struct {
 	FetcherConfig    *FetcherConfig    `yaml:"fetcher"`
 	DownloaderConfig *DownloaderConfig `yaml:"downloader"`
+	RetentionConfig  *RetentionConfig  `yaml:"retention"`
+	StorageConfig    *StorageConfig    `yaml:"storage"`
 }
 
+// FetcherConfig defines how the channels are fetched. The workers fetch the channels due first, and wait for the fetch
+// interval when none is due. The next fetch of a channel is scheduled by its upload cadence within the min and max
+// intervals, randomized by the jitter. The requests of all the workers are limited by the rate, and by the proxy rate
+// through each proxy.
 type FetcherConfig struct {
-	Enable                bool         `yaml:"enable"`
-	ProxyConfig           *ProxyConfig `yaml:"proxy"`
-	FetcheIntervalSeconds int          `yaml:"fetch_interval_seconds"`
+	Enable                  bool         `yaml:"enable"`
+	ProxyConfig             *ProxyConfig `yaml:"proxy"`
+	FetcheIntervalSeconds   int          `yaml:"fetch_interval_seconds"`
+	MinFetchIntervalSeconds int          `yaml:"min_fetch_interval_seconds"` // of a channel, default to 15 minutes
+	MaxFetchIntervalSeconds int          `yaml:"max_fetch_interval_seconds"` // of a channel, default to 1 day
+	JitterPercent           int          `yaml:"jitter_percent"`             // default to 10, negative to disable
+	Workers                 int          `yaml:"workers"`                    // channels fetched at the same time, default to 1
+	RateLimit               float64      `yaml:"rate_limit"`                 // requests per second, default to 1, negative for unlimited
+	RateBurst               int          `yaml:"rate_burst"`                 // requests at once after idle, default to the workers
+	ProxyRateLimit          float64      `yaml:"proxy_rate_limit"`           // requests per second through each proxy, 0 for unlimited
 }
 
 type DownloaderConfig struct {
@@ -44,6 +131,50 @@ type DownloaderConfig struct {
 	BasePath                string       `yaml:"base_path"`
 	YtDlpLink               string       `yaml:"yt_dlp_link"`
 	DownloadIntervalSeconds int          `yaml:"download_interval_seconds"`
+	Backend                 string       `yaml:"backend"`     // default download backend, yt-dlp or http
+	MinFreeMB               int64        `yaml:"min_free_mb"` // pause downloading when the free space of base path is lower
+}
+
+// RetentionConfig defines the rules to evict the downloaded contents, zero value disables the rule.
+type RetentionConfig struct {
+	Enable                 bool  `yaml:"enable"`
+	CleanupIntervalSeconds int   `yaml:"cleanup_interval_seconds"`
+	KeepLastPerChannel     int   `yaml:"keep_last_per_channel"` // keep the newest N contents of each channel
+	MaxAgeDays             int   `yaml:"max_age_days"`          // evict contents published more than N days ago
+	DeleteAfterPlayed      bool  `yaml:"delete_after_played"`   // evict contents played by all the subscribers
+	QuotaMB                int64 `yaml:"quota_mb"`              // evict the least recently accessed contents beyond the quota
+}
+
+// StorageConfig defines where the downloaded contents are kept, and how they are streamed to the clients.
+type StorageConfig struct {
+	Type                 StorageType `yaml:"type"`
+	StreamMode           StreamMode  `yaml:"stream_mode"`
+	PresignExpirySeconds int         `yaml:"presign_expiry_seconds"`
+	S3Config             *S3Config   `yaml:"s3"`
+}
+
+type StorageType string
+
+const (
+	LocalStorage StorageType = "local" // keep the files under the base path of downloader
+	S3Storage    StorageType = "s3"    // upload the files to an S3-compatible object storage
+)
+
+type StreamMode string
+
+const (
+	ProxyStreamMode    StreamMode = "proxy"    // stream the files through the server, with range requests
+	RedirectStreamMode StreamMode = "redirect" // redirect the clients to the presigned urls of the storage
+)
+
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	UseSSL    bool   `yaml:"use_ssl"`
 }
 
 type ProxyConfig struct {
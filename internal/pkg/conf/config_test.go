@@ -9,6 +9,8 @@ func TestReadConfig(t *testing.T) {
 web:
   port: 8080
   host: "localhost"
+  external_url: "https://podcast.example.com"
+  trusted_proxies: ["10.0.0.0/8"]
 db:
   dsn: "user:password@/dbname"
   driver: "mysql"
@@ -18,6 +20,13 @@ subscriber:
     proxy:
       proxies: ["http://proxy1", "http://proxy2"]
     fetch_interval_seconds: 60
+    min_fetch_interval_seconds: 600
+    max_fetch_interval_seconds: 43200
+    jitter_percent: 20
+    workers: 4
+    rate_limit: 2.5
+    rate_burst: 5
+    proxy_rate_limit: 0.5
   downloader:
     enable: true
     proxy:
@@ -25,6 +34,61 @@ subscriber:
     base_path: "/downloads"
     yt_dlp_link: "http://yt-dlp"
     download_interval_seconds: 120
+    backend: "yt-dlp"
+    min_free_mb: 1024
+  retention:
+    enable: true
+    cleanup_interval_seconds: 3600
+    keep_last_per_channel: 20
+    max_age_days: 30
+    delete_after_played: true
+    quota_mb: 10240
+  storage:
+    type: "s3"
+    stream_mode: "redirect"
+    presign_expiry_seconds: 600
+    s3:
+      endpoint: "localhost:9000"
+      bucket: "listen-tube"
+      access_key: "minioadmin"
+      secret_key: "minioadmin"
+auth:
+  registration: "open"
+  admins: ["admin1", "admin2"]
+  jwt:
+    realm: "listen-tube"
+    timeout_seconds: 3600
+    max_refresh_seconds: 7200
+    active_key: "new"
+    keys:
+      - id: "new"
+        algorithm: "RS256"
+        private_key_file: "/etc/listen-tube/jwt.pem"
+        public_key_file: "/etc/listen-tube/jwt.pub"
+      - id: "old"
+        algorithm: "HS256"
+        secret: "old-secret"
+  stream_signing:
+    key: "secret"
+    expiry_seconds: 3600
+  login_limit:
+    window_seconds: 600
+    max_user_failures: 5
+    max_ip_failures: 20
+    lockout_seconds: 30
+    max_lockout_seconds: 1800
+  oidc:
+    enable: true
+    issuer: "https://idp.example.com"
+    client_id: "listen-tube"
+    client_secret: "secret"
+    redirect_url: "http://localhost:8080/auth/oidc/callback"
+    scopes: ["openid", "groups"]
+    groups_claim: "roles"
+    role_mapping:
+      podcast-admins: "admin"
+    default_role: "readonly"
+    post_login_url: "http://localhost:8090/"
 `)
 
 	config, err := ReadConfig(content)
@@ -38,6 +102,12 @@ subscriber:
 	if config.WebConfig.Host != "localhost" {
 		t.Errorf("Expected WebConfig.Host to be 'localhost', got %s", config.WebConfig.Host)
 	}
+	if config.WebConfig.ExternalURL != "https://podcast.example.com" {
+		t.Errorf("Expected WebConfig.ExternalURL to be 'https://podcast.example.com', got %s", config.WebConfig.ExternalURL)
+	}
+	if len(config.WebConfig.TrustedProxies) != 1 || config.WebConfig.TrustedProxies[0] != "10.0.0.0/8" {
+		t.Errorf("Expected WebConfig.TrustedProxies to be [10.0.0.0/8], got %v", config.WebConfig.TrustedProxies)
+	}
 	if config.DBConfig.DSN != "user:password@/dbname" {
 		t.Errorf("Expected DBConfig.DSN to be 'user:password@/dbname', got %s", config.DBConfig.DSN)
 	}
@@ -65,4 +135,96 @@ subscriber:
 	if config.SubscriberConfig.DownloaderConfig.DownloadIntervalSeconds != 120 {
 		t.Errorf("Expected DownloaderConfig.DownloadIntervalSeconds to be 120, got %d", config.SubscriberConfig.DownloaderConfig.DownloadIntervalSeconds)
 	}
-}
\ No newline at end of file
+	if config.SubscriberConfig.DownloaderConfig.Backend != "yt-dlp" {
+		t.Errorf("Expected DownloaderConfig.Backend to be 'yt-dlp', got %s", config.SubscriberConfig.DownloaderConfig.Backend)
+	}
+	if config.SubscriberConfig.FetcherConfig.MinFetchIntervalSeconds != 600 {
+		t.Errorf("Expected FetcherConfig.MinFetchIntervalSeconds to be 600, got %d", config.SubscriberConfig.FetcherConfig.MinFetchIntervalSeconds)
+	}
+	if config.SubscriberConfig.FetcherConfig.MaxFetchIntervalSeconds != 43200 {
+		t.Errorf("Expected FetcherConfig.MaxFetchIntervalSeconds to be 43200, got %d", config.SubscriberConfig.FetcherConfig.MaxFetchIntervalSeconds)
+	}
+	if config.SubscriberConfig.FetcherConfig.JitterPercent != 20 {
+		t.Errorf("Expected FetcherConfig.JitterPercent to be 20, got %d", config.SubscriberConfig.FetcherConfig.JitterPercent)
+	}
+	if config.SubscriberConfig.FetcherConfig.Workers != 4 {
+		t.Errorf("Expected FetcherConfig.Workers to be 4, got %d", config.SubscriberConfig.FetcherConfig.Workers)
+	}
+	if config.SubscriberConfig.FetcherConfig.RateLimit != 2.5 || config.SubscriberConfig.FetcherConfig.RateBurst != 5 {
+		t.Errorf("Expected FetcherConfig.RateLimit to be 2.5 and RateBurst 5, got %v and %d",
+			config.SubscriberConfig.FetcherConfig.RateLimit, config.SubscriberConfig.FetcherConfig.RateBurst)
+	}
+	if config.SubscriberConfig.FetcherConfig.ProxyRateLimit != 0.5 {
+		t.Errorf("Expected FetcherConfig.ProxyRateLimit to be 0.5, got %v", config.SubscriberConfig.FetcherConfig.ProxyRateLimit)
+	}
+	if config.SubscriberConfig.DownloaderConfig.MinFreeMB != 1024 {
+		t.Errorf("Expected DownloaderConfig.MinFreeMB to be 1024, got %d", config.SubscriberConfig.DownloaderConfig.MinFreeMB)
+	}
+	if !config.SubscriberConfig.RetentionConfig.Enable {
+		t.Errorf("Expected RetentionConfig.Enable to be true, got %v", config.SubscriberConfig.RetentionConfig.Enable)
+	}
+	if config.SubscriberConfig.RetentionConfig.KeepLastPerChannel != 20 {
+		t.Errorf("Expected RetentionConfig.KeepLastPerChannel to be 20, got %d", config.SubscriberConfig.RetentionConfig.KeepLastPerChannel)
+	}
+	if config.SubscriberConfig.RetentionConfig.MaxAgeDays != 30 {
+		t.Errorf("Expected RetentionConfig.MaxAgeDays to be 30, got %d", config.SubscriberConfig.RetentionConfig.MaxAgeDays)
+	}
+	if !config.SubscriberConfig.RetentionConfig.DeleteAfterPlayed {
+		t.Errorf("Expected RetentionConfig.DeleteAfterPlayed to be true, got %v", config.SubscriberConfig.RetentionConfig.DeleteAfterPlayed)
+	}
+	if config.SubscriberConfig.RetentionConfig.QuotaMB != 10240 {
+		t.Errorf("Expected RetentionConfig.QuotaMB to be 10240, got %d", config.SubscriberConfig.RetentionConfig.QuotaMB)
+	}
+	if config.SubscriberConfig.StorageConfig.Type != S3Storage {
+		t.Errorf("Expected StorageConfig.Type to be 's3', got %s", config.SubscriberConfig.StorageConfig.Type)
+	}
+	if config.SubscriberConfig.StorageConfig.StreamMode != RedirectStreamMode {
+		t.Errorf("Expected StorageConfig.StreamMode to be 'redirect', got %s", config.SubscriberConfig.StorageConfig.StreamMode)
+	}
+	if config.SubscriberConfig.StorageConfig.S3Config.Bucket != "listen-tube" {
+		t.Errorf("Expected S3Config.Bucket to be 'listen-tube', got %s", config.SubscriberConfig.StorageConfig.S3Config.Bucket)
+	}
+	if config.AuthConfig.Registration != OpenRegistration {
+		t.Errorf("Expected AuthConfig.Registration to be 'open', got %s", config.AuthConfig.Registration)
+	}
+	if len(config.AuthConfig.Admins) != 2 || config.AuthConfig.Admins[0] != "admin1" {
+		t.Errorf("Expected AuthConfig.Admins to be [admin1 admin2], got %v", config.AuthConfig.Admins)
+	}
+	if config.AuthConfig.JWTConfig.TimeoutSeconds != 3600 {
+		t.Errorf("Expected JWTConfig.TimeoutSeconds to be 3600, got %d", config.AuthConfig.JWTConfig.TimeoutSeconds)
+	}
+	if config.AuthConfig.JWTConfig.MaxRefreshSeconds != 7200 {
+		t.Errorf("Expected JWTConfig.MaxRefreshSeconds to be 7200, got %d", config.AuthConfig.JWTConfig.MaxRefreshSeconds)
+	}
+	if config.AuthConfig.JWTConfig.ActiveKey != "new" {
+		t.Errorf("Expected JWTConfig.ActiveKey to be 'new', got %s", config.AuthConfig.JWTConfig.ActiveKey)
+	}
+	if len(config.AuthConfig.JWTConfig.Keys) != 2 {
+		t.Fatalf("Expected 2 JWT keys, got %d", len(config.AuthConfig.JWTConfig.Keys))
+	}
+	if config.AuthConfig.JWTConfig.Keys[0].Algorithm != "RS256" || config.AuthConfig.JWTConfig.Keys[0].PrivateKeyFile != "/etc/listen-tube/jwt.pem" {
+		t.Errorf("Unexpected JWT key %+v", config.AuthConfig.JWTConfig.Keys[0])
+	}
+	if config.AuthConfig.JWTConfig.Keys[1].Secret != "old-secret" {
+		t.Errorf("Expected the secret of the old JWT key to be 'old-secret', got %s", config.AuthConfig.JWTConfig.Keys[1].Secret)
+	}
+	if config.AuthConfig.StreamSigningConfig.Key != "secret" {
+		t.Errorf("Expected StreamSigningConfig.Key to be 'secret', got %s", config.AuthConfig.StreamSigningConfig.Key)
+	}
+	if config.AuthConfig.StreamSigningConfig.ExpirySeconds != 3600 {
+		t.Errorf("Expected StreamSigningConfig.ExpirySeconds to be 3600, got %d", config.AuthConfig.StreamSigningConfig.ExpirySeconds)
+	}
+	if limit := config.AuthConfig.LoginLimitConfig; limit.WindowSeconds != 600 || limit.MaxUserFailures != 5 ||
+		limit.MaxIPFailures != 20 || limit.LockoutSeconds != 30 || limit.MaxLockoutSeconds != 1800 {
+		t.Errorf("Unexpected LoginLimitConfig %+v", limit)
+	}
+	oidc := config.AuthConfig.OIDCConfig
+	if !oidc.Enable || oidc.Issuer != "https://idp.example.com" || oidc.ClientID != "listen-tube" || oidc.ClientSecret != "secret" ||
+		oidc.RedirectURL != "http://localhost:8080/auth/oidc/callback" || oidc.GroupsClaim != "roles" ||
+		oidc.DefaultRole != "readonly" || oidc.PostLoginURL != "http://localhost:8090/" {
+		t.Errorf("Unexpected OIDCConfig %+v", oidc)
+	}
+	if len(oidc.Scopes) != 2 || oidc.RoleMapping["podcast-admins"] != "admin" {
+		t.Errorf("Unexpected scopes %v or role mapping %v of OIDCConfig", oidc.Scopes, oidc.RoleMapping)
+	}
+}
@@ -0,0 +1,38 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+)
+
+// APIToken is a long-lived personal token of a user, only the hash of the token is stored.
+type APIToken struct {
+	ID         uint      `gorm:"id;primaryKey;autoIncrement"`
+	UserCredit string    `gorm:"user_credit"`
+	Name       string    `gorm:"name"`
+	TokenHash  string    `gorm:"token_hash"`
+	Prefix     string    `gorm:"prefix"` // the first characters of the token, to tell the tokens apart
+	Scopes     string    `gorm:"scopes"` // comma separated scopes
+	LastUsedAt time.Time `gorm:"last_used_at"`
+	CreateAt   time.Time `gorm:"create_at"`
+	UpdateAt   time.Time `gorm:"update_at"`
+}
+
+func (APIToken) TableName() string {
+	return "t_api_token"
+}
+
+type APITokenMapper struct {
+	*db.BasicMapper[APIToken]
+}
+
+func NewAPITokenMapper(ds *db.DatabaseSource) (*APITokenMapper, error) {
+	bm, err := db.NewBasicMapper[APIToken](ds)
+	if err != nil {
+		return nil, err
+	}
+	return &APITokenMapper{
+		bm,
+	}, nil
+}
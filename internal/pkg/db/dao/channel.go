@@ -14,12 +14,17 @@ type Channel struct {
 	OwnerUrls     string    `gorm:"owner_urls"`
 	Thumbnails    string    `gorm:"thumbnails"`
 	ChannelCredit string    `gorm:"channel_credit"`
+	NextFetchAt   time.Time `gorm:"next_fetch_at"` // scheduled by the upload cadence, the channels due first are fetched first
 	CreateAt      time.Time `gorm:"create_at"`
 	UpdateAt      time.Time `gorm:"update_at"`
 }
 
 type Platform string
 
+// PlatformSaved is the platform of the saved pseudo-channels, which hold the contents imported by the users one by one
+// and are never fetched.
+const PlatformSaved Platform = "saved"
+
 func (Channel) TableName() string {
 	return "t_channel"
 }
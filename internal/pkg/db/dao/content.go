@@ -14,10 +14,16 @@ type Content struct {
 	Thumbnail     string        `gorm:"thumbnail"`
 	ContentCredit string        `gorm:"content_credit"`
 	State         ContentState  `gorm:"state"`
+	Type          ContentType   `gorm:"type"`
 	Info          string        `gorm:"info"`
 	PublishedTime time.Time     `gorm:"published_time"`
 	Length        time.Duration `gorm:"length"`
 	Path          string        `gorm:"path"`
+	Size          int64         `gorm:"size"`
+	Force         bool          `gorm:"force"`
+	URL           string        `gorm:"url"`      // source url, empty for the youtube watch page of the content
+	Priority      int           `gorm:"priority"` // the contents of higher priority are downloaded first, e.g. the imported ones
+	AccessAt      time.Time     `gorm:"access_at"`
 	CreateAt      time.Time     `gorm:"create_at"`
 	UpdateAt      time.Time     `gorm:"update_at"`
 }
@@ -30,6 +36,20 @@ const (
 	ContentStatePrepared    ContentState = 1
 	ContentStateDownloading ContentState = 2
 	ContentStateDownloaded  ContentState = 3
+	ContentStateEvicted     ContentState = 4 // the downloaded file is removed by the retention rules
+	ContentStateSkipped     ContentState = 5 // rejected by the filters of all the subscriptions, never downloaded
+	ContentStateUpcoming    ContentState = 6 // the premiere or livestream is not aired yet, prepared once aired
+)
+
+// ContentType classifies the contents by how they are published.
+type ContentType int
+
+const (
+	ContentTypeRegular  ContentType = 0
+	ContentTypeShort    ContentType = 1
+	ContentTypeLive     ContentType = 2 // a livestream, on air or the vod
+	ContentTypeUpcoming ContentType = 3 // a scheduled premiere or livestream
+	ContentTypePremiere ContentType = 4 // a premiered video
 )
 
 func (Content) TableName() string {
@@ -0,0 +1,65 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+)
+
+// InviteCode allows the new users to register, it can be redeemed up to MaxUses times before ExpireAt.
+type InviteCode struct {
+	ID            uint      `gorm:"id;primaryKey;autoIncrement"`
+	Code          string    `gorm:"code"`
+	CreatorCredit string    `gorm:"creator_credit"`
+	MaxUses       int       `gorm:"max_uses"`
+	UsedCount     int       `gorm:"used_count"`
+	ExpireAt      time.Time `gorm:"expire_at"`
+	Revoked       bool      `gorm:"revoked"`
+	CreateAt      time.Time `gorm:"create_at"`
+	UpdateAt      time.Time `gorm:"update_at"`
+}
+
+func (InviteCode) TableName() string {
+	return "t_invite_code"
+}
+
+type InviteCodeMapper struct {
+	*db.BasicMapper[InviteCode]
+}
+
+func NewInviteCodeMapper(ds *db.DatabaseSource) (*InviteCodeMapper, error) {
+	bm, err := db.NewBasicMapper[InviteCode](ds)
+	if err != nil {
+		return nil, err
+	}
+	return &InviteCodeMapper{
+		bm,
+	}, nil
+}
+
+// InviteRedemption records which user registered with an invite code.
+type InviteRedemption struct {
+	ID           uint      `gorm:"id;primaryKey;autoIncrement"`
+	InviteCodeID uint      `gorm:"invite_code_id"`
+	UserCredit   string    `gorm:"user_credit"`
+	UserName     string    `gorm:"user_name"`
+	CreateAt     time.Time `gorm:"create_at"`
+}
+
+func (InviteRedemption) TableName() string {
+	return "t_invite_redemption"
+}
+
+type InviteRedemptionMapper struct {
+	*db.BasicMapper[InviteRedemption]
+}
+
+func NewInviteRedemptionMapper(ds *db.DatabaseSource) (*InviteRedemptionMapper, error) {
+	bm, err := db.NewBasicMapper[InviteRedemption](ds)
+	if err != nil {
+		return nil, err
+	}
+	return &InviteRedemptionMapper{
+		bm,
+	}, nil
+}
@@ -0,0 +1,41 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+)
+
+// ListenState records how a user has listened to a content, it's synced across the devices of the user.
+type ListenState struct {
+	ID            uint      `gorm:"id;primaryKey;autoIncrement"`
+	UserCredit    string    `gorm:"user_credit"`
+	ContentCredit string    `gorm:"content_credit"`
+	Played        bool      `gorm:"played"`    // completed, or marked as played
+	PlayedAt      time.Time `gorm:"played_at"` // when the played flag is changed
+	Position      int       `gorm:"position"`  // resume position in seconds
+	Device        string    `gorm:"device"`    // the device last played on
+	LastPlayedAt  time.Time `gorm:"last_played_at"`
+	Archived      bool      `gorm:"archived"` // handled by the user, hidden from the inbox
+	Starred       bool      `gorm:"starred"`
+	CreateAt      time.Time `gorm:"create_at"`
+	UpdateAt      time.Time `gorm:"update_at"`
+}
+
+func (ListenState) TableName() string {
+	return "t_listen_state"
+}
+
+type ListenStateMapper struct {
+	*db.BasicMapper[ListenState]
+}
+
+func NewListenStateMapper(ds *db.DatabaseSource) (*ListenStateMapper, error) {
+	bm, err := db.NewBasicMapper[ListenState](ds)
+	if err != nil {
+		return nil, err
+	}
+	return &ListenStateMapper{
+		bm,
+	}, nil
+}
@@ -0,0 +1,35 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+)
+
+// LoginFailure is a failed login attempt, the failures of a user name are cleared but kept on a successful login.
+type LoginFailure struct {
+	ID       uint      `gorm:"id;primaryKey;autoIncrement"`
+	UserName string    `gorm:"user_name"`
+	IP       string    `gorm:"ip"`
+	Cleared  bool      `gorm:"cleared"`
+	CreateAt time.Time `gorm:"create_at"`
+	UpdateAt time.Time `gorm:"update_at"`
+}
+
+func (LoginFailure) TableName() string {
+	return "t_login_failure"
+}
+
+type LoginFailureMapper struct {
+	*db.BasicMapper[LoginFailure]
+}
+
+func NewLoginFailureMapper(ds *db.DatabaseSource) (*LoginFailureMapper, error) {
+	bm, err := db.NewBasicMapper[LoginFailure](ds)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginFailureMapper{
+		bm,
+	}, nil
+}
@@ -0,0 +1,58 @@
+package dao
+
+import (
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// userCreditColumns are the columns referencing the credit of the users, the personal ones are deleted along with
+// the user.
+var userCreditColumns = []struct {
+	table    string
+	column   string
+	personal bool
+}{
+	{Subscription{}.TableName(), "user_credit", true},
+	{ListenState{}.TableName(), "user_credit", true},
+	{APIToken{}.TableName(), "user_credit", true},
+	{InviteCode{}.TableName(), "creator_credit", false},
+	{InviteRedemption{}.TableName(), "user_credit", true},
+	{PasswordReset{}.TableName(), "user_credit", true},
+	{Session{}.TableName(), "user_credit", true},
+	{UserIdentity{}.TableName(), "user_credit", true},
+	{Playlist{}.TableName(), "user_credit", true},
+	{PlaylistItem{}.TableName(), "user_credit", true},
+}
+
+// migrateUserCredit moves the password hash, which was used as the user credit, into its own column, and replaces
+// the credit with a UUID in the users and all the tables referencing them.
+func migrateUserCredit(ds *db.DatabaseSource) error {
+	var users []*User
+	if err := ds.DB.Where("password_hash = ? OR password_hash IS NULL", "").Find(&users).Error; err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	return ds.DB.Transaction(func(tx *gorm.DB) error {
+		for _, user := range users {
+			oldCredit, newCredit := user.Credit, uuid.NewString()
+			if err := tx.Model(&User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+				"credit":        newCredit,
+				"password_hash": oldCredit,
+			}).Error; err != nil {
+				return err
+			}
+			for _, c := range userCreditColumns {
+				if err := tx.Table(c.table).Where(c.column+" = ?", oldCredit).
+					Update(c.column, newCredit).Error; err != nil {
+					return err
+				}
+			}
+			log.Infof("migrated the credit of user %s", user.Name)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,72 @@
+package dao
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+)
+
+func TestMigrateUserCredit(t *testing.T) {
+	defer func() {
+		files, _ := filepath.Glob("/tmp/listen-tube-unit-test-*.db")
+		for _, file := range files {
+			os.Remove(file)
+		}
+	}()
+	ds, err := db.NewDatabaseSource(&conf.DBConfig{
+		DSN:    fmt.Sprintf("/tmp/listen-tube-unit-test-%d.db", time.Now().UnixNano()),
+		Driver: conf.SQLiteDriver,
+	})
+	if err != nil {
+		t.Fatalf("NewDatabaseSource() error = %v", err)
+	}
+	m, err := NewUnionMapper(ds)
+	if err != nil {
+		t.Fatalf("NewUnionMapper() error = %v", err)
+	}
+
+	// the users registered by the older versions use the password hash as the credit
+	hash := "$2a$10$P/2om2cYvUSHBBwmjZqm5OVc4vR96zYmz5bxYf5u6126ziHVD7py."
+	if _, err := m.UserMapper.Insert(&User{Credit: hash, Name: "OldUser"}); err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+	if _, err := m.UserMapper.Insert(&User{Credit: "new-user-id", PasswordHash: hash, Name: "NewUser"}); err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+	if _, err := m.SubscriptionMapper.Insert(&Subscription{UserCredit: hash, ChannelCredit: "channel1"}); err != nil {
+		t.Fatalf("Failed to insert subscription: %v", err)
+	}
+	if _, err := m.ListenStateMapper.Insert(&ListenState{UserCredit: hash, ContentCredit: "content1"}); err != nil {
+		t.Fatalf("Failed to insert listen state: %v", err)
+	}
+
+	// migrate twice to make sure it's idempotent
+	for i := 0; i < 2; i++ {
+		if err := migrateUserCredit(ds); err != nil {
+			t.Fatalf("migrateUserCredit() error = %v", err)
+		}
+	}
+
+	users, err := m.UserMapper.Select(&User{Name: "OldUser"})
+	if err != nil || len(users) != 1 {
+		t.Fatalf("Failed to select user: %v", err)
+	}
+	oldUser := users[0]
+	if oldUser.PasswordHash != hash || oldUser.Credit == hash || len(oldUser.Credit) != 36 {
+		t.Errorf("migrateUserCredit() user = %+v", oldUser)
+	}
+	if subscriptions, _ := m.SubscriptionMapper.Select(&Subscription{UserCredit: oldUser.Credit}); len(subscriptions) != 1 {
+		t.Errorf("migrateUserCredit() subscriptions = %v, want 1", subscriptions)
+	}
+	if states, _ := m.ListenStateMapper.Select(&ListenState{UserCredit: oldUser.Credit}); len(states) != 1 {
+		t.Errorf("migrateUserCredit() listen states = %v, want 1", states)
+	}
+	if users, _ := m.UserMapper.Select(&User{Name: "NewUser"}); len(users) != 1 || users[0].Credit != "new-user-id" {
+		t.Errorf("migrateUserCredit() changed the migrated user %v", users)
+	}
+}
@@ -0,0 +1,35 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+)
+
+// OIDCState is a pending OpenID Connect login, consumed once by the callback of the state.
+type OIDCState struct {
+	ID           uint      `gorm:"id;primaryKey;autoIncrement"`
+	State        string    `gorm:"state"`
+	Nonce        string    `gorm:"nonce"`
+	CodeVerifier string    `gorm:"code_verifier"` // PKCE code verifier
+	ExpireAt     time.Time `gorm:"expire_at"`
+	CreateAt     time.Time `gorm:"create_at"`
+}
+
+func (OIDCState) TableName() string {
+	return "t_oidc_state"
+}
+
+type OIDCStateMapper struct {
+	*db.BasicMapper[OIDCState]
+}
+
+func NewOIDCStateMapper(ds *db.DatabaseSource) (*OIDCStateMapper, error) {
+	bm, err := db.NewBasicMapper[OIDCState](ds)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCStateMapper{
+		bm,
+	}, nil
+}
@@ -0,0 +1,36 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+)
+
+// PasswordReset is a one-time token issued by an admin for a user to reset the password, only the hash is stored.
+type PasswordReset struct {
+	ID         uint      `gorm:"id;primaryKey;autoIncrement"`
+	UserCredit string    `gorm:"user_credit"`
+	TokenHash  string    `gorm:"token_hash"`
+	Used       bool      `gorm:"used"`
+	ExpireAt   time.Time `gorm:"expire_at"`
+	CreateAt   time.Time `gorm:"create_at"`
+	UpdateAt   time.Time `gorm:"update_at"`
+}
+
+func (PasswordReset) TableName() string {
+	return "t_password_reset"
+}
+
+type PasswordResetMapper struct {
+	*db.BasicMapper[PasswordReset]
+}
+
+func NewPasswordResetMapper(ds *db.DatabaseSource) (*PasswordResetMapper, error) {
+	bm, err := db.NewBasicMapper[PasswordReset](ds)
+	if err != nil {
+		return nil, err
+	}
+	return &PasswordResetMapper{
+		bm,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+)
+
+// Playlist is a list of contents ordered by the user, the contents can be of any subscribed channels.
+type Playlist struct {
+	ID             uint         `gorm:"id;primaryKey;autoIncrement"`
+	UserCredit     string       `gorm:"user_credit"`
+	PlaylistCredit string       `gorm:"playlist_credit"`
+	Name           string       `gorm:"name"`
+	Kind           PlaylistKind `gorm:"kind"`
+	Rules          string       `gorm:"rules"`          // the rules of the smart playlist in json
+	DownloadFirst  bool         `gorm:"download_first"` // the contents matching the smart playlist are downloaded first
+	CreateAt       time.Time    `gorm:"create_at"`
+	UpdateAt       time.Time    `gorm:"update_at"`
+}
+
+type PlaylistKind int
+
+const (
+	PlaylistKindCustom PlaylistKind = 0
+	PlaylistKindQueue  PlaylistKind = 1 // the up next queue, each user has one
+	PlaylistKindSmart  PlaylistKind = 2 // the contents are evaluated by the rules, instead of the items
+)
+
+func (Playlist) TableName() string {
+	return "t_playlist"
+}
+
+type PlaylistMapper struct {
+	*db.BasicMapper[Playlist]
+}
+
+func NewPlaylistMapper(ds *db.DatabaseSource) (*PlaylistMapper, error) {
+	bm, err := db.NewBasicMapper[Playlist](ds)
+	if err != nil {
+		return nil, err
+	}
+	return &PlaylistMapper{
+		bm,
+	}, nil
+}
+
+// PlaylistItem is a content in a playlist, the items are played by the position ascending.
+type PlaylistItem struct {
+	ID             uint      `gorm:"id;primaryKey;autoIncrement"`
+	UserCredit     string    `gorm:"user_credit"`
+	PlaylistCredit string    `gorm:"playlist_credit"`
+	ContentCredit  string    `gorm:"content_credit"`
+	Position       int       `gorm:"position"` // starts from 0
+	CreateAt       time.Time `gorm:"create_at"`
+	UpdateAt       time.Time `gorm:"update_at"`
+}
+
+func (PlaylistItem) TableName() string {
+	return "t_playlist_item"
+}
+
+type PlaylistItemMapper struct {
+	*db.BasicMapper[PlaylistItem]
+}
+
+func NewPlaylistItemMapper(ds *db.DatabaseSource) (*PlaylistItemMapper, error) {
+	bm, err := db.NewBasicMapper[PlaylistItem](ds)
+	if err != nil {
+		return nil, err
+	}
+	return &PlaylistItemMapper{
+		bm,
+	}, nil
+}
@@ -0,0 +1,39 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+)
+
+// Session is a login of a user, identified by the jti claim of the JWTs issued for it.
+type Session struct {
+	ID         uint      `gorm:"id;primaryKey;autoIncrement"`
+	JTI        string    `gorm:"jti"`
+	UserCredit string    `gorm:"user_credit"`
+	Device     string    `gorm:"device"` // user agent of the login request
+	IP         string    `gorm:"ip"`
+	Revoked    bool      `gorm:"revoked"`
+	LastSeenAt time.Time `gorm:"last_seen_at"`
+	ExpireAt   time.Time `gorm:"expire_at"`
+	CreateAt   time.Time `gorm:"create_at"`
+	UpdateAt   time.Time `gorm:"update_at"`
+}
+
+func (Session) TableName() string {
+	return "t_session"
+}
+
+type SessionMapper struct {
+	*db.BasicMapper[Session]
+}
+
+func NewSessionMapper(ds *db.DatabaseSource) (*SessionMapper, error) {
+	bm, err := db.NewBasicMapper[Session](ds)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionMapper{
+		bm,
+	}, nil
+}
@@ -10,6 +10,9 @@ type Subscription struct {
 	ID            uint      `gorm:"id;primaryKey;autoIncrement"`
 	UserCredit    string    `gorm:"user_credit"`
 	ChannelCredit string    `gorm:"channel_credit"`
+	Tags          string    `gorm:"tags"`     // split by comma, e.g. tech,news
+	Filter        string    `gorm:"filter"`   // the filter of the contents to download in json
+	Priority      int       `gorm:"priority"` // the download priority of the channel set by the user, -10 to 10
 	CreateAt      time.Time `gorm:"create_at"`
 	UpdateAt      time.Time `gorm:"update_at"`
 }
@@ -3,10 +3,21 @@ package dao
 import "github.com/gogodjzhu/listen-tube/internal/pkg/db"
 
 type UnionMapper struct {
-	ChannelMapper      *ChannelMapper
-	SubscriptionMapper *SubscriptionMapper
-	ContentMapper      *ContentMapper
-	UserMapper         *UserMapper
+	ChannelMapper          *ChannelMapper
+	SubscriptionMapper     *SubscriptionMapper
+	ContentMapper          *ContentMapper
+	UserMapper             *UserMapper
+	ListenStateMapper      *ListenStateMapper
+	APITokenMapper         *APITokenMapper
+	InviteCodeMapper       *InviteCodeMapper
+	InviteRedemptionMapper *InviteRedemptionMapper
+	PasswordResetMapper    *PasswordResetMapper
+	SessionMapper          *SessionMapper
+	LoginFailureMapper     *LoginFailureMapper
+	UserIdentityMapper     *UserIdentityMapper
+	OIDCStateMapper        *OIDCStateMapper
+	PlaylistMapper         *PlaylistMapper
+	PlaylistItemMapper     *PlaylistItemMapper
 }
 
 func NewUnionMapper(ds *db.DatabaseSource) (*UnionMapper, error) {
@@ -26,10 +37,68 @@ func NewUnionMapper(ds *db.DatabaseSource) (*UnionMapper, error) {
 	if err != nil {
 		return nil, err
 	}
+	lm, err := NewListenStateMapper(ds)
+	if err != nil {
+		return nil, err
+	}
+	am, err := NewAPITokenMapper(ds)
+	if err != nil {
+		return nil, err
+	}
+	im, err := NewInviteCodeMapper(ds)
+	if err != nil {
+		return nil, err
+	}
+	rm, err := NewInviteRedemptionMapper(ds)
+	if err != nil {
+		return nil, err
+	}
+	pm, err := NewPasswordResetMapper(ds)
+	if err != nil {
+		return nil, err
+	}
+	sem, err := NewSessionMapper(ds)
+	if err != nil {
+		return nil, err
+	}
+	lfm, err := NewLoginFailureMapper(ds)
+	if err != nil {
+		return nil, err
+	}
+	uim, err := NewUserIdentityMapper(ds)
+	if err != nil {
+		return nil, err
+	}
+	osm, err := NewOIDCStateMapper(ds)
+	if err != nil {
+		return nil, err
+	}
+	plm, err := NewPlaylistMapper(ds)
+	if err != nil {
+		return nil, err
+	}
+	pim, err := NewPlaylistItemMapper(ds)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateUserCredit(ds); err != nil {
+		return nil, err
+	}
 	return &UnionMapper{
-		ChannelMapper:      cm,
-		SubscriptionMapper: sm,
-		ContentMapper:      co,
-		UserMapper:         um,
+		ChannelMapper:          cm,
+		SubscriptionMapper:     sm,
+		ContentMapper:          co,
+		UserMapper:             um,
+		ListenStateMapper:      lm,
+		APITokenMapper:         am,
+		InviteCodeMapper:       im,
+		InviteRedemptionMapper: rm,
+		PasswordResetMapper:    pm,
+		SessionMapper:          sem,
+		LoginFailureMapper:     lfm,
+		UserIdentityMapper:     uim,
+		OIDCStateMapper:        osm,
+		PlaylistMapper:         plm,
+		PlaylistItemMapper:     pim,
 	}, nil
-}
\ No newline at end of file
+}
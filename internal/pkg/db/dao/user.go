@@ -4,16 +4,28 @@ import (
 	"time"
 
 	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+	"gorm.io/gorm"
 )
 
 type User struct {
-	ID       uint      `gorm:"id;primaryKey;autoIncrement"`
-	Credit   string    `gorm:"credit"`
-	Name     string    `gorm:"name"`
-	CreateAt time.Time `gorm:"create_at"`
-	UpdateAt time.Time `gorm:"update_at"`
+	ID           uint      `gorm:"id;primaryKey;autoIncrement"`
+	Credit       string    `gorm:"credit"` // opaque and immutable id of the user, referenced as user_credit
+	Name         string    `gorm:"name"`
+	DisplayName  string    `gorm:"display_name"`
+	PasswordHash string    `gorm:"password_hash"`
+	Role         UserRole  `gorm:"role"`
+	CreateAt     time.Time `gorm:"create_at"`
+	UpdateAt     time.Time `gorm:"update_at"`
 }
 
+type UserRole string
+
+const (
+	UserRoleAdmin    UserRole = "admin"    // manage the users and invite codes, besides all the member permissions
+	UserRoleMember   UserRole = "member"   // manage the own subscriptions and contents
+	UserRoleReadOnly UserRole = "readonly" // read and stream the contents only
+)
+
 func (User) TableName() string {
 	return "t_user"
 }
@@ -31,3 +43,29 @@ func NewUserMapper(ds *db.DatabaseSource) (*UserMapper, error) {
 		bm,
 	}, nil
 }
+
+// InsertWithIdentity inserts the user with the external identity linked to it, neither is inserted if the other fails.
+func (m *UserMapper) InsertWithIdentity(user *User, identity *UserIdentity) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserCredit = user.Credit
+		return tx.Create(identity).Error
+	})
+}
+
+// DeleteCascade deletes the user and the personal data referencing the user.
+func (m *UserMapper) DeleteCascade(user *User) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		for _, c := range userCreditColumns {
+			if !c.personal {
+				continue
+			}
+			if err := tx.Exec("DELETE FROM "+c.table+" WHERE "+c.column+" = ?", user.Credit).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(user).Error
+	})
+}
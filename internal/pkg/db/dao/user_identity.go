@@ -0,0 +1,35 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+)
+
+// UserIdentity links a user to the subject of an OpenID Connect issuer.
+type UserIdentity struct {
+	ID         uint      `gorm:"id;primaryKey;autoIncrement"`
+	UserCredit string    `gorm:"user_credit"`
+	Issuer     string    `gorm:"issuer"`
+	Subject    string    `gorm:"subject"`
+	CreateAt   time.Time `gorm:"create_at"`
+	UpdateAt   time.Time `gorm:"update_at"`
+}
+
+func (UserIdentity) TableName() string {
+	return "t_user_identity"
+}
+
+type UserIdentityMapper struct {
+	*db.BasicMapper[UserIdentity]
+}
+
+func NewUserIdentityMapper(ds *db.DatabaseSource) (*UserIdentityMapper, error) {
+	bm, err := db.NewBasicMapper[UserIdentity](ds)
+	if err != nil {
+		return nil, err
+	}
+	return &UserIdentityMapper{
+		bm,
+	}, nil
+}
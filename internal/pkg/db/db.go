@@ -103,6 +103,17 @@ func (d *BasicMapper[T]) SelectWithPage(where *T, p *Pagenation) ([]*T, error) {
 	return tArr, nil
 }
 
+// Count counts the rows matching the where, the zero values of which are ignored as Select does.
+func (d *BasicMapper[T]) Count(where *T) (int64, error) {
+	var t T
+	var count int64
+	result := d.DB.Model(&t).Where(where).Count(&count)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
+
 func (d *BasicMapper[T]) SelectBySQL(sql string, args ...interface{}) ([]*T, error) {
 	var tArr []*T
 	result := d.DB.Raw(sql, args...).Find(&tArr)
@@ -112,6 +123,15 @@ func (d *BasicMapper[T]) SelectBySQL(sql string, args ...interface{}) ([]*T, err
 	return tArr, nil
 }
 
+// ExecBySQL executes a write statement, e.g. a conditional update, and returns the number of affected rows.
+func (d *BasicMapper[T]) ExecBySQL(sql string, args ...interface{}) (int64, error) {
+	result := d.DB.Exec(sql, args...)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
 func (d *BasicMapper[T]) Delete(t *T) (int64, error) {
 	result := d.DB.Delete(t)
 	if result.Error != nil {
@@ -133,3 +153,15 @@ func (d *BasicMapper[T]) Update(old *T, new *T) (int64, error) {
 	}
 	return result.RowsAffected, nil
 }
+
+func (d *BasicMapper[T]) UpdateColumns(where *T, columns map[string]interface{}) (int64, error) {
+	var t T
+	result := d.DB.Model(&t).Where(where).Updates(columns)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return result.RowsAffected, nil
+}
@@ -419,3 +419,171 @@ func TestBasicMapper_SelectBySQL(t *testing.T) {
 		})
 	}
 }
+
+func TestBasicMapper_ExecBySQL(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	tests := []struct {
+		name string
+		args struct {
+			sql  string
+			args []interface{}
+		}
+		want    int64
+		wantErr bool
+	}{
+		{
+			name: "Conditional update matched",
+			args: struct {
+				sql  string
+				args []interface{}
+			}{
+				sql:  "UPDATE t_test_table SET enum = enum + 1 WHERE id = ? AND enum < ?",
+				args: []interface{}{1, 2},
+			},
+			want:    1,
+			wantErr: false,
+		},
+		{
+			name: "Conditional update unmatched",
+			args: struct {
+				sql  string
+				args []interface{}
+			}{
+				sql:  "UPDATE t_test_table SET enum = enum + 1 WHERE id = ? AND enum < ?",
+				args: []interface{}{1, 1},
+			},
+			want:    0,
+			wantErr: false,
+		},
+		{
+			name: "Invalid SQL",
+			args: struct {
+				sql  string
+				args []interface{}
+			}{
+				sql:  "UPDATE t_unknown_table SET enum = 1",
+				args: nil,
+			},
+			want:    0,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper := MockTestTableMapper()
+			teardownTest := setupTest(t, mapper)
+			defer teardownTest(t)
+
+			got, err := mapper.ExecBySQL(tt.args.sql, tt.args.args...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExecBySQL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ExecBySQL() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasicMapper_Count(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	tests := []struct {
+		name    string
+		where   *TestTable
+		want    int64
+		wantErr bool
+	}{
+		{
+			name:    "Count matched",
+			where:   &TestTable{Name: "Test"},
+			want:    1,
+			wantErr: false,
+		},
+		{
+			name:    "Count unmatched",
+			where:   &TestTable{Name: "Unknown"},
+			want:    0,
+			wantErr: false,
+		},
+		{
+			name:    "Count all",
+			where:   &TestTable{},
+			want:    1,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper := MockTestTableMapper()
+			teardownTest := setupTest(t, mapper)
+			defer teardownTest(t)
+
+			got, err := mapper.Count(tt.where)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Count() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Count() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasicMapper_UpdateColumns(t *testing.T) {
+	teardownSuite := setupSuite(t)
+	defer teardownSuite(t)
+
+	tests := []struct {
+		name string
+		args struct {
+			where   *TestTable
+			columns map[string]interface{}
+		}
+		want    int64
+		wantErr bool
+	}{
+		{
+			name: "Update matched record",
+			args: struct {
+				where   *TestTable
+				columns map[string]interface{}
+			}{where: &TestTable{ID: 1, Enum: 1}, columns: map[string]interface{}{"name": "", "enum": 0}},
+			want:    1,
+			wantErr: false,
+		},
+		{
+			name: "Update unmatched record",
+			args: struct {
+				where   *TestTable
+				columns map[string]interface{}
+			}{where: &TestTable{ID: 1, Enum: 2}, columns: map[string]interface{}{"name": ""}},
+			want:    0,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper := MockTestTableMapper()
+			teardownTest := setupTest(t, mapper)
+			defer teardownTest(t)
+
+			got, err := mapper.UpdateColumns(tt.args.where, tt.args.columns)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UpdateColumns() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("UpdateColumns() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LocalStorage keeps the files in the local file system.
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{
+		root: root,
+	}
+}
+
+// path returns the local path of the key. Absolute keys are the paths recorded by the older versions.
+func (s *LocalStorage) path(key string) string {
+	if filepath.IsAbs(key) {
+		return key
+	}
+	return filepath.Join(s.root, key)
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, localPath string) error {
+	path := s.path(key)
+	if path == filepath.Clean(localPath) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(localPath, path)
+}
+
+func (s *LocalStorage) Open(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	file, err := os.Open(s.path(key))
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, &ObjectInfo{Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path := s.path(key)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// remove the directory of the content if it's empty
+	_ = os.Remove(filepath.Dir(path))
+	return nil
+}
+
+func (s *LocalStorage) PresignURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	log "github.com/sirupsen/logrus"
+)
+
+// S3Storage keeps the files in an S3-compatible object storage, e.g. AWS S3 or MinIO.
+type S3Storage struct {
+	client *minio.Client
+	conf   *conf.S3Config
+}
+
+// NewS3Storage creates a new S3Storage, and makes sure the bucket exists.
+func NewS3Storage(config *conf.S3Config) (*S3Storage, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region}); err != nil {
+			return nil, err
+		}
+		log.Infof("created bucket %s", config.Bucket)
+	}
+	return &S3Storage{
+		client: client,
+		conf:   config,
+	}, nil
+}
+
+func (s *S3Storage) objectName(key string) string {
+	return path.Join(s.conf.Prefix, filepath.ToSlash(key))
+}
+
+// Put uploads the local file, and removes it after uploaded.
+func (s *S3Storage) Put(ctx context.Context, key string, localPath string) error {
+	if _, err := s.client.FPutObject(ctx, s.conf.Bucket, s.objectName(key), localPath, minio.PutObjectOptions{
+		ContentType: "audio/mpeg",
+	}); err != nil {
+		return err
+	}
+	if err := os.Remove(localPath); err != nil {
+		log.Warnf("failed to remove uploaded file %s: %v", localPath, err)
+	}
+	_ = os.Remove(filepath.Dir(localPath))
+	return nil
+}
+
+func (s *S3Storage) Open(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	object, err := s.client.GetObject(ctx, s.conf.Bucket, s.objectName(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, nil, err
+	}
+	return object, &ObjectInfo{Size: stat.Size, ModTime: stat.LastModified}, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.conf.Bucket, s.objectName(key), minio.RemoveObjectOptions{})
+}
+
+func (s *S3Storage) PresignURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.conf.Bucket, s.objectName(key), expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/pkg/errors"
+)
+
+// ErrPresignNotSupported is returned by the storages which can't be read directly by the clients.
+var ErrPresignNotSupported = errors.New("presigned url is not supported")
+
+// Storage is where the downloaded audio files are kept, the files are addressed by keys relative to the root.
+type Storage interface {
+	// Put moves the local file into the storage under the key
+	Put(ctx context.Context, key string, localPath string) error
+	// Open opens the file of the key for reading
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error)
+	// Delete removes the file of the key
+	Delete(ctx context.Context, key string) error
+	// PresignURL returns a temporary url for the clients to read the file directly from the storage
+	PresignURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+type ObjectInfo struct {
+	Size    int64     // size in bytes
+	ModTime time.Time // last modified time
+}
+
+// NewStorage creates the configured storage, the local storage under basePath is used by default.
+func NewStorage(config *conf.StorageConfig, basePath string) (Storage, error) {
+	if config == nil || config.Type == "" || config.Type == conf.LocalStorage {
+		return NewLocalStorage(basePath), nil
+	}
+	switch config.Type {
+	case conf.S3Storage:
+		return NewS3Storage(config.S3Config)
+	default:
+		return nil, errors.Errorf("unsupported storage type %s", config.Type)
+	}
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+)
+
+// MockS3Storage connects to the S3-compatible storage for test, e.g. a local MinIO started by:
+// docker run -p 9000:9000 minio/minio server /data
+// and LISTEN_TUBE_TEST_S3_ENDPOINT=localhost:9000
+func MockS3Storage(t *testing.T) *S3Storage {
+	endpoint := os.Getenv("LISTEN_TUBE_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("LISTEN_TUBE_TEST_S3_ENDPOINT is not set")
+	}
+	accessKey := os.Getenv("LISTEN_TUBE_TEST_S3_ACCESS_KEY")
+	if accessKey == "" {
+		accessKey = "minioadmin"
+	}
+	secretKey := os.Getenv("LISTEN_TUBE_TEST_S3_SECRET_KEY")
+	if secretKey == "" {
+		secretKey = "minioadmin"
+	}
+	s, err := NewS3Storage(&conf.S3Config{
+		Endpoint:  endpoint,
+		Bucket:    "listen-tube-unit-test",
+		Prefix:    "audio",
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage() error = %v", err)
+	}
+	return s
+}
+
+func TestStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage func(t *testing.T) Storage
+		presign bool
+	}{
+		{
+			name: "Local storage",
+			storage: func(t *testing.T) Storage {
+				return NewLocalStorage(t.TempDir())
+			},
+			presign: false,
+		},
+		{
+			name: "S3 storage",
+			storage: func(t *testing.T) Storage {
+				return MockS3Storage(t)
+			},
+			presign: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.storage(t)
+			ctx := context.Background()
+			key := filepath.Join("dQw4w9WgXcQ", "worstaudio.mp3")
+			localPath := filepath.Join(t.TempDir(), "worstaudio.mp3")
+			if err := os.WriteFile(localPath, []byte("listen-tube"), 0644); err != nil {
+				t.Fatalf("Failed to write local file: %v", err)
+			}
+
+			if err := s.Put(ctx, key, localPath); err != nil {
+				t.Fatalf("Storage.Put() error = %v", err)
+			}
+			if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+				t.Errorf("Storage.Put() local file is not moved, err = %v", err)
+			}
+
+			file, info, err := s.Open(ctx, key)
+			if err != nil {
+				t.Fatalf("Storage.Open() error = %v", err)
+			}
+			// read from the middle, as the range requests do
+			if _, err := file.Seek(7, io.SeekStart); err != nil {
+				t.Fatalf("Storage.Open() seek error = %v", err)
+			}
+			got, err := io.ReadAll(file)
+			file.Close()
+			if err != nil || string(got) != "tube" || info.Size != 11 {
+				t.Errorf("Storage.Open() read = %s, size = %d, err = %v", got, info.Size, err)
+			}
+
+			url, err := s.PresignURL(ctx, key, time.Minute)
+			if tt.presign {
+				if err != nil {
+					t.Fatalf("Storage.PresignURL() error = %v", err)
+				}
+				resp, err := http.Get(url)
+				if err != nil || resp.StatusCode != http.StatusOK {
+					t.Errorf("Storage.PresignURL() url = %s is not readable, err = %v", url, err)
+				}
+				if resp != nil {
+					resp.Body.Close()
+				}
+			} else if err != ErrPresignNotSupported {
+				t.Errorf("Storage.PresignURL() error = %v, want %v", err, ErrPresignNotSupported)
+			}
+
+			if err := s.Delete(ctx, key); err != nil {
+				t.Fatalf("Storage.Delete() error = %v", err)
+			}
+			if _, _, err := s.Open(ctx, key); err == nil {
+				t.Errorf("Storage.Open() error = nil after deleted")
+			}
+		})
+	}
+}
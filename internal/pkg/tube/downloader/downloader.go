@@ -2,12 +2,11 @@ package downloader
 
 import (
 	"context"
+	goerrors "errors"
+	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
-	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
@@ -17,10 +16,57 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// Downloader is responsible for downloading contents using youtube-dl. @see https://github.com/yt-dlp/yt-dlp
+const (
+	// BackendYtDlp is the name of the backend which downloads contents with yt-dlp
+	BackendYtDlp = "yt-dlp"
+	// BackendHTTP is the name of the backend which downloads plain http enclosures, e.g. from RSS sources
+	BackendHTTP = "http"
+)
+
+// Backend does the actual download work for the Downloader.
+type Backend interface {
+	// Name returns the unique name of the backend
+	Name() string
+	// Prepare makes sure the backend is ready to download, e.g. the binaries are installed
+	Prepare() error
+	// Download downloads the content into the output file, the progress (0-100) is reported through the callback
+	Download(ctx context.Context, opt *DownloadOption, output string, progress func(float64)) error
+	// Cancel stops the in-flight download of the content
+	Cancel(contentCredit string) error
+}
+
+// SizeEstimator is implemented by the backends which know the size of a content before downloading it.
+type SizeEstimator interface {
+	// EstimateSize returns the estimated size in bytes of the content, or -1 if unknown
+	EstimateSize(ctx context.Context, opt *DownloadOption) (int64, error)
+}
+
+// Prober is implemented by the backends which can look up a single content by its url, e.g. to import it.
+type Prober interface {
+	// Probe returns the metadata of the content at the url without downloading it
+	Probe(ctx context.Context, url string) (*Metadata, error)
+}
+
+// ErrUnsupportedURL is returned when the backend can not download the content at the url.
+var ErrUnsupportedURL = goerrors.New("unsupported url")
+
+// ErrInsufficientSpace is returned when the content is larger than the remaining disk budget.
+var ErrInsufficientSpace = goerrors.New("insufficient disk space")
+
+// Downloader is responsible for downloading contents with the registered backends.
 type Downloader struct {
-	conf   *conf.DownloaderConfig
-	binUri string
+	conf     *conf.DownloaderConfig
+	backends map[string]Backend
+	mu       sync.Mutex
+	status   Status
+}
+
+// Status describes whether the downloader is working or paused.
+type Status struct {
+	Paused    bool      // the queue is paused, no more content is claimed
+	Reason    string    // why the queue is paused
+	FreeBytes uint64    // free bytes of the base path at the last check
+	CheckAt   time.Time // time of the last check
 }
 
 func (opt *DownloadOption) Validate() error {
@@ -33,14 +79,27 @@ func (opt *DownloadOption) Validate() error {
 	return nil
 }
 
-// NewDownloader creates a new Downloader instance and ensures the necessary binaries and directories are set up.
+// NewDownloader creates a new Downloader instance with the yt-dlp and http backends.
 func NewDownloader(conf *conf.DownloaderConfig) (*Downloader, error) {
+	return NewDownloaderWithBackends(conf, NewYtDlpBackend(conf), NewHTTPBackend(conf))
+}
+
+// NewDownloaderWithBackends creates a new Downloader instance and ensures the base path and all the backends are set up.
+func NewDownloaderWithBackends(conf *conf.DownloaderConfig, backends ...Backend) (*Downloader, error) {
 	d := &Downloader{
-		conf:   conf,
-		binUri: filepath.Join(conf.BasePath, ".bin", "yt-dlp"),
+		conf:     conf,
+		backends: make(map[string]Backend),
 	}
-	if err := d.prepare(); err != nil {
-		return nil, err
+	// create base path if not exists
+	if err := os.MkdirAll(conf.BasePath, os.ModePerm); err != nil {
+		log.Errorf("failed to create base path: %v", err)
+		return nil, errors.ErrFailedOS
+	}
+	for _, backend := range backends {
+		if err := backend.Prepare(); err != nil {
+			return nil, err
+		}
+		d.backends[backend.Name()] = backend
 	}
 	return d, nil
 }
@@ -58,17 +117,26 @@ func (d *Downloader) TryStart(ctx context.Context, next func() *dao.Content, upd
 			log.Info("downloader stopped")
 			return
 		case <-timer.C:
+			// do not claim any content while the disk is running out of space
+			if !d.checkSpace() {
+				continue
+			}
 			content := next()
 			if content == nil {
 				continue
 			}
 			result, err := d.Download(ctx, &DownloadOption{
 				ContentCredit: content.ContentCredit,
+				URL:           content.URL,
 				Format:        "mp3",
-				Force:         false,
+				Force:         content.Force,
 			})
 			if err != nil {
-				update(*content, &Result{Finished: false})
+				update(*content, &Result{
+					Finished: false,
+					Canceled: goerrors.Is(err, context.Canceled),
+					Reason:   err.Error(),
+				})
 			} else {
 				update(*content, result)
 			}
@@ -76,54 +144,96 @@ func (d *Downloader) TryStart(ctx context.Context, next func() *dao.Content, upd
 	}
 }
 
-func (d *Downloader) prepare() error {
-	// execute ``yt-dlp --version`` to check if the binary is working
-	cmd := exec.Command(d.binUri, "--version")
-	if err := cmd.Run(); err != nil {
-		log.Info("yt-dlp binary not found, downloading...")
-		// download yt-dlp binary if not exists
-		if err := ioutil.DownloadFile(d.conf.YtDlpLink, d.binUri, true, 0755); err != nil {
-			log.Errorf("failed to download yt-dlp binary: %v", err)
-			return errors.ErrFailedOS
-		}
+// checkSpace checks the free space of the base path against the configured minimum, and pauses the queue if it's low.
+func (d *Downloader) checkSpace() bool {
+	minFree := uint64(d.conf.MinFreeMB) * 1024 * 1024
+	if minFree == 0 {
+		return true
 	}
-	cmd = exec.Command(d.binUri, "--version")
-	versionOutput, err := cmd.Output()
+	status := Status{CheckAt: time.Now()}
+	free, err := ioutil.FreeSpace(d.conf.BasePath)
 	if err != nil {
-		log.Errorf("yt-dlp binary is not working: %v", err)
-		return errors.ErrFailedOS
+		// the guard is not working on this platform, never block the downloads
+		log.Warnf("failed to check free space of %s: %v", d.conf.BasePath, err)
+	} else {
+		status.FreeBytes = free
+		if free < minFree {
+			status.Paused = true
+			status.Reason = fmt.Sprintf("low disk space, %dMB free, %dMB required", free/1024/1024, d.conf.MinFreeMB)
+		}
 	}
-	// log the version of yt-dlp binary and its path
-	log.Infof("yt-dlp version: %s, path: %s", strings.TrimSpace(string(versionOutput)), d.binUri)
 
-	// create base path if not exists
-	if err := os.MkdirAll(d.conf.BasePath, os.ModePerm); err != nil {
-		log.Errorf("failed to create base path: %v", err)
-		return errors.ErrFailedOS
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if status.Paused && !d.status.Paused {
+		log.Warnf("downloader paused: %s", status.Reason)
+	} else if !status.Paused && d.status.Paused {
+		log.Infof("downloader resumed")
+	}
+	d.status = status
+	return !status.Paused
+}
+
+// Status returns the status of the download queue.
+func (d *Downloader) Status() Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+// checkBudget refuses the content, if it is larger than the free space beyond the configured minimum.
+func (d *Downloader) checkBudget(ctx context.Context, backend Backend, opt *DownloadOption) error {
+	estimator, ok := backend.(SizeEstimator)
+	if !ok || d.conf.MinFreeMB <= 0 {
+		return nil
 	}
-	// check if ffmpeg exists
-	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		log.Errorf("ffmpeg not found: %v", err)
-		return errors.ErrFailedOS
+	size, err := estimator.EstimateSize(ctx, opt)
+	if err != nil || size < 0 {
+		log.Debugf("unknown size of content %s, err: %v", opt.ContentCredit, err)
+		return nil
+	}
+	free, err := ioutil.FreeSpace(d.conf.BasePath)
+	if err != nil {
+		return nil
+	}
+	budget := int64(free) - d.conf.MinFreeMB*1024*1024
+	if size > budget {
+		log.Warnf("refuse to download content %s, size %d exceeds the budget %d", opt.ContentCredit, size, budget)
+		return ErrInsufficientSpace
 	}
 	return nil
 }
 
+// backend returns the backend to download the content with, default to the configured one.
+func (d *Downloader) backend(opt *DownloadOption) (Backend, error) {
+	name := opt.Backend
+	if name == "" {
+		name = d.conf.Backend
+	}
+	if name == "" {
+		name = BackendYtDlp
+	}
+	backend, ok := d.backends[name]
+	if !ok {
+		log.Errorf("download backend %s not found", name)
+		return nil, errors.ErrInvalidParams
+	}
+	return backend, nil
+}
+
 // Download downloads a content based on the provided DownloadOption and returns the Result.
 func (d *Downloader) Download(ctx context.Context, opt *DownloadOption) (*Result, error) {
 	// check if option is valid
 	if err := opt.Validate(); err != nil {
 		return nil, errors.ErrInvalidParams
 	}
-
-	// prepare the output file path
-	outPath := filepath.Join(d.conf.BasePath, opt.ContentCredit)
-	if err := os.Mkdir(outPath, os.ModePerm); err != nil && !os.IsExist(err) {
-		log.Errorf("failed to create output directory: %v", err)
-		return nil, errors.ErrFailedOS
+	backend, err := d.backend(opt)
+	if err != nil {
+		return nil, err
 	}
 
 	// clean the output directory if force download
+	outPath := filepath.Join(d.conf.BasePath, opt.ContentCredit)
 	if opt.Force {
 		if err := os.RemoveAll(outPath); err != nil {
 			log.Errorf("failed to remove output directory: %v", err)
@@ -131,44 +241,32 @@ func (d *Downloader) Download(ctx context.Context, opt *DownloadOption) (*Result
 		}
 	}
 
+	// prepare the output file path
+	if err := os.Mkdir(outPath, os.ModePerm); err != nil && !os.IsExist(err) {
+		log.Errorf("failed to create output directory: %v", err)
+		return nil, errors.ErrFailedOS
+	}
+
 	// prepare the Result struct
+	contentURL := opt.URL
+	if contentURL == "" {
+		contentURL = "https://www.youtube.com/watch?v=" + opt.ContentCredit
+	}
 	result := &Result{
 		Finished:   false,
 		Progress:   0,
-		ContentURL: "https://www.youtube.com/watch?v=" + opt.ContentCredit,
+		ContentURL: contentURL,
 		Output:     filepath.Join(outPath, "worstaudio."+opt.Format),
 	}
 
-	messageChan := make(ioutil.ChanWriter)
-	defer close(messageChan)
-	go func() {
-		percentagePattern := regexp.MustCompile(`\[download\]\s+(\d+\.\d+|\d+)%\s+of\s+.+\s+in`)
-		for msg := range messageChan {
-			for _, m := range strings.Split(msg, "\n") {
-				if len(strings.TrimSpace(m)) != 0 {
-					match := percentagePattern.FindStringSubmatch(m)
-					if len(match) > 1 {
-						progress, _ := strconv.ParseFloat(match[1], 64)
-						result.Progress = progress
-					}
-					log.Debugf("downloading %s: %s", opt.ContentCredit, m)
-				}
-			}
-		}
-	}()
-
-	// prepare the download command
-	args := make([]string, 0)
-	// if opt.Format != "" {
-	// 	args = append(args, "--merge-output-format", opt.Format)
-	// }
-	args = append(args, "-f", "worstaudio")
-	args = append(args, "-o", result.Output)
-	args = append(args, result.ContentURL)
-	cmd := exec.Command(d.binUri, args...)
-	cmd.Stdout = messageChan
-	cmd.Stderr = messageChan
-	err := cmd.Run()
+	backendOpt := *opt
+	backendOpt.URL = contentURL
+	if err := d.checkBudget(ctx, backend, &backendOpt); err != nil {
+		return nil, err
+	}
+	err = backend.Download(ctx, &backendOpt, result.Output, func(progress float64) {
+		result.Progress = progress
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -177,14 +275,53 @@ func (d *Downloader) Download(ctx context.Context, opt *DownloadOption) (*Result
 	return result, nil
 }
 
+// Probe looks up the content at the url with the configured backend, ErrUnsupportedURL is returned if the backend
+// can not download it.
+func (d *Downloader) Probe(ctx context.Context, url string) (*Metadata, error) {
+	backend, err := d.backend(&DownloadOption{})
+	if err != nil {
+		return nil, err
+	}
+	prober, ok := backend.(Prober)
+	if !ok {
+		return nil, ErrUnsupportedURL
+	}
+	return prober.Probe(ctx, url)
+}
+
+// Cancel stops the in-flight download of the content on every backend.
+func (d *Downloader) Cancel(contentCredit string) error {
+	for _, backend := range d.backends {
+		if err := backend.Cancel(contentCredit); err == nil {
+			return nil
+		}
+	}
+	return errors.ErrNotFound
+}
+
 type DownloadOption struct {
 	ContentCredit string // content credit
+	URL           string // source url, default to the youtube watch page of the content
+	Backend       string // backend name, default to the configured backend
 	Format        string // download format
 	Force         bool   // force download, delete the existing file
 }
 
+// Metadata describes a single content looked up by its url.
+type Metadata struct {
+	ID            string        // id of the content on its platform
+	Platform      string        // platform of the content, e.g. Youtube
+	URL           string        // canonical url of the content
+	Title         string        // title
+	Thumbnail     string        // thumbnail url
+	Length        time.Duration // length, 0 if unknown
+	PublishedTime time.Time     // published time, zero if unknown
+}
+
 type Result struct {
 	Finished   bool    // download finished
+	Canceled   bool    // download canceled before finished
+	Reason     string  // why the download is not finished
 	Progress   float64 // download progress
 	ContentURL string  // content url
 	Output     string  // absolute output file path
@@ -2,16 +2,63 @@ package downloader
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/util/errors"
 )
 
+var fixedModTime = time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// fakeBackend writes the content credit into the output file without touching the network.
+type fakeBackend struct {
+	err  error
+	size int64
+}
+
+func (b *fakeBackend) Name() string {
+	return "fake"
+}
+
+func (b *fakeBackend) Prepare() error {
+	return nil
+}
+
+func (b *fakeBackend) Download(ctx context.Context, opt *DownloadOption, output string, progress func(float64)) error {
+	if b.err != nil {
+		return b.err
+	}
+	progress(50)
+	if err := os.WriteFile(output, []byte(opt.ContentCredit), 0644); err != nil {
+		return err
+	}
+	progress(100)
+	return nil
+}
+
+func (b *fakeBackend) Cancel(contentCredit string) error {
+	return errors.ErrNotFound
+}
+
+func (b *fakeBackend) EstimateSize(ctx context.Context, opt *DownloadOption) (int64, error) {
+	if b.size == 0 {
+		return -1, nil
+	}
+	return b.size, nil
+}
+
 func TestDownloader_Download(t *testing.T) {
 	type fields struct {
-		conf   *conf.DownloaderConfig
-		binUri string
+		conf    *conf.DownloaderConfig
+		backend *fakeBackend
 	}
 	type args struct {
 		ctx context.Context
@@ -28,10 +75,10 @@ func TestDownloader_Download(t *testing.T) {
 			name: "Valid download",
 			fields: fields{
 				conf: &conf.DownloaderConfig{
-					BasePath:  "/tmp/listen-tube-test/",
-					YtDlpLink: "https://github.com/yt-dlp/yt-dlp/releases/latest/download/yt-dlp_linux",
+					BasePath: "/tmp/listen-tube-test/",
+					Backend:  "fake",
 				},
-				binUri: "/tmp/listen-tube-test/.bin/yt-dlp",
+				backend: &fakeBackend{},
 			},
 			args: args{
 				ctx: context.Background(),
@@ -49,12 +96,86 @@ func TestDownloader_Download(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Failed download",
+			fields: fields{
+				conf: &conf.DownloaderConfig{
+					BasePath: "/tmp/listen-tube-test/",
+					Backend:  "fake",
+				},
+				backend: &fakeBackend{err: errors.ErrFailedOS},
+			},
+			args: args{
+				ctx: context.Background(),
+				opt: &DownloadOption{
+					ContentCredit: "dQw4w9WgXcQ",
+					Format:        "mp4",
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Content larger than the disk budget",
+			fields: fields{
+				conf: &conf.DownloaderConfig{
+					BasePath:  "/tmp/listen-tube-test/",
+					Backend:   "fake",
+					MinFreeMB: 1,
+				},
+				backend: &fakeBackend{size: 1 << 62},
+			},
+			args: args{
+				ctx: context.Background(),
+				opt: &DownloadOption{
+					ContentCredit: "dQw4w9WgXcQ",
+					Format:        "mp4",
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Unknown backend",
+			fields: fields{
+				conf: &conf.DownloaderConfig{
+					BasePath: "/tmp/listen-tube-test/",
+				},
+				backend: &fakeBackend{},
+			},
+			args: args{
+				ctx: context.Background(),
+				opt: &DownloadOption{
+					ContentCredit: "dQw4w9WgXcQ",
+					Format:        "mp4",
+					Backend:       "unknown",
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Invalid option",
+			fields: fields{
+				conf: &conf.DownloaderConfig{
+					BasePath: "/tmp/listen-tube-test/",
+					Backend:  "fake",
+				},
+				backend: &fakeBackend{},
+			},
+			args: args{
+				ctx: context.Background(),
+				opt: &DownloadOption{},
+			},
+			want:    nil,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			d, err := NewDownloader(tt.fields.conf)
+			d, err := NewDownloaderWithBackends(tt.fields.conf, tt.fields.backend)
 			if err != nil {
-				t.Errorf("NewDownloader() error = %v", err)
+				t.Errorf("NewDownloaderWithBackends() error = %v", err)
 				return
 			}
 			got, err := d.Download(tt.args.ctx, tt.args.opt)
@@ -68,3 +189,139 @@ func TestDownloader_Download(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloader_checkSpace(t *testing.T) {
+	tests := []struct {
+		name       string
+		minFreeMB  int64
+		wantPaused bool
+	}{
+		{
+			name:       "Guard disabled",
+			minFreeMB:  0,
+			wantPaused: false,
+		},
+		{
+			name:       "Enough free space",
+			minFreeMB:  1,
+			wantPaused: false,
+		},
+		{
+			name:       "Low free space",
+			minFreeMB:  1 << 40,
+			wantPaused: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDownloaderWithBackends(&conf.DownloaderConfig{
+				BasePath:  t.TempDir(),
+				MinFreeMB: tt.minFreeMB,
+			}, &fakeBackend{})
+			if err != nil {
+				t.Fatalf("NewDownloaderWithBackends() error = %v", err)
+			}
+			if got := d.checkSpace(); got == tt.wantPaused {
+				t.Errorf("Downloader.checkSpace() = %v, wantPaused %v", got, tt.wantPaused)
+			}
+			if status := d.Status(); status.Paused != tt.wantPaused || (tt.wantPaused && status.Reason == "") {
+				t.Errorf("Downloader.Status() = %+v, wantPaused %v", status, tt.wantPaused)
+			}
+		})
+	}
+}
+
+func TestHTTPBackend_Download(t *testing.T) {
+	body := strings.Repeat("listen-tube", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "audio.mp3", fixedModTime, strings.NewReader(body))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		partial string
+	}{
+		{
+			name:    "Download from the beginning",
+			partial: "",
+		},
+		{
+			name:    "Resume from the partial file",
+			partial: body[:300],
+		},
+		{
+			name:    "Partial file already complete",
+			partial: body,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "audio.mp3")
+			if tt.partial != "" {
+				if err := os.WriteFile(output+".part", []byte(tt.partial), 0644); err != nil {
+					t.Fatalf("Failed to write partial file: %v", err)
+				}
+			}
+			var progress float64
+			b := NewHTTPBackend(&conf.DownloaderConfig{})
+			err := b.Download(context.Background(), &DownloadOption{
+				ContentCredit: "enclosure",
+				URL:           server.URL,
+			}, output, func(p float64) {
+				progress = p
+			})
+			if err != nil {
+				t.Fatalf("HTTPBackend.Download() error = %v", err)
+			}
+			got, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if string(got) != body {
+				t.Errorf("HTTPBackend.Download() wrote %d bytes, want %d", len(got), len(body))
+			}
+			if progress != 100 {
+				t.Errorf("HTTPBackend.Download() progress = %v, want 100", progress)
+			}
+		})
+	}
+}
+
+func TestYtDlpBackend_Cancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process group is not supported on windows")
+	}
+	// a fake yt-dlp binary which spawns a child process and waits for it
+	binUri := filepath.Join(t.TempDir(), "yt-dlp")
+	if err := os.WriteFile(binUri, []byte("#!/bin/sh\nsleep 30 &\nwait\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake binary: %v", err)
+	}
+	b := NewYtDlpBackend(&conf.DownloaderConfig{BasePath: t.TempDir()})
+	b.binUri = binUri
+
+	done := make(chan error)
+	go func() {
+		done <- b.Download(context.Background(), &DownloadOption{
+			ContentCredit: "dQw4w9WgXcQ",
+			URL:           "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		}, filepath.Join(t.TempDir(), "worstaudio.mp3"), func(float64) {})
+	}()
+
+	// wait for the download to start
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Cancel("dQw4w9WgXcQ") != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("YtDlpBackend.Download() not started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("YtDlpBackend.Download() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("YtDlpBackend.Download() not stopped after cancel")
+	}
+}
@@ -0,0 +1,163 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/util/errors"
+	utilhttp "github.com/gogodjzhu/listen-tube/internal/pkg/util/http"
+	log "github.com/sirupsen/logrus"
+)
+
+// HTTPBackend downloads plain http enclosures, e.g. the audio files of RSS sources.
+// The partial file is kept on failure, so that the next download resumes from it with a range request.
+type HTTPBackend struct {
+	proxies []string
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+// NewHTTPBackend creates a new HTTPBackend.
+func NewHTTPBackend(conf *conf.DownloaderConfig) *HTTPBackend {
+	var proxies []string
+	if conf.ProxyConfig != nil {
+		proxies = conf.ProxyConfig.Proxies
+	}
+	return &HTTPBackend{
+		proxies: proxies,
+		running: make(map[string]context.CancelFunc),
+	}
+}
+
+func (b *HTTPBackend) Name() string {
+	return BackendHTTP
+}
+
+func (b *HTTPBackend) Prepare() error {
+	return nil
+}
+
+func (b *HTTPBackend) Download(ctx context.Context, opt *DownloadOption, output string, progress func(float64)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	b.mu.Lock()
+	b.running[opt.ContentCredit] = cancel
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.running, opt.ContentCredit)
+		b.mu.Unlock()
+		cancel()
+	}()
+
+	// resume from the partial file if exists
+	partPath := output + ".part"
+	var offset int64
+	if fi, err := os.Stat(partPath); err == nil {
+		offset = fi.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, opt.URL, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := utilhttp.NewClient(b.proxies).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flag := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flag |= os.O_APPEND
+	case http.StatusOK:
+		// the server ignores the range, download from the beginning
+		flag |= os.O_TRUNC
+		offset = 0
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the partial file is already complete
+		progress(100)
+		return os.Rename(partPath, output)
+	default:
+		return fmt.Errorf("unexpected status %d downloading %s", resp.StatusCode, opt.URL)
+	}
+
+	out, err := os.OpenFile(partPath, flag, 0644)
+	if err != nil {
+		log.Errorf("failed to open output file: %v", err)
+		return errors.ErrFailedOS
+	}
+	defer out.Close()
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	_, err = io.Copy(out, &progressReader{
+		reader:   resp.Body,
+		read:     offset,
+		total:    total,
+		progress: progress,
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	progress(100)
+	return os.Rename(partPath, output)
+}
+
+// EstimateSize returns the content length of the enclosure.
+func (b *HTTPBackend) EstimateSize(ctx context.Context, opt *DownloadOption) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, opt.URL, nil)
+	if err != nil {
+		return -1, err
+	}
+	resp, err := utilhttp.NewClient(b.proxies).Do(req)
+	if err != nil {
+		return -1, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1, nil
+	}
+	return resp.ContentLength, nil
+}
+
+func (b *HTTPBackend) Cancel(contentCredit string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cancel, ok := b.running[contentCredit]
+	if !ok {
+		return errors.ErrNotFound
+	}
+	cancel()
+	return nil
+}
+
+// progressReader reports the percentage of the read bytes to the callback.
+type progressReader struct {
+	reader   io.Reader
+	read     int64
+	total    int64
+	progress func(float64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if r.total > 0 {
+		r.progress(float64(r.read) * 100 / float64(r.total))
+	}
+	return n, err
+}
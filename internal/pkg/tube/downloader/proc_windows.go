@@ -0,0 +1,9 @@
+//go:build windows
+
+package downloader
+
+import "os/exec"
+
+// setProcessGroup is a no-op on windows, only the yt-dlp process itself is killed on cancel.
+func setProcessGroup(cmd *exec.Cmd) {
+}
@@ -0,0 +1,193 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/util/errors"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/util/ioutil"
+	log "github.com/sirupsen/logrus"
+)
+
+var percentagePattern = regexp.MustCompile(`\[download\]\s+(\d+\.\d+|\d+)%\s+of\s+.+\s+in`)
+
+// YtDlpBackend downloads contents using yt-dlp. @see https://github.com/yt-dlp/yt-dlp
+type YtDlpBackend struct {
+	conf    *conf.DownloaderConfig
+	binUri  string
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+// NewYtDlpBackend creates a new YtDlpBackend, the binary is installed under the base path.
+func NewYtDlpBackend(conf *conf.DownloaderConfig) *YtDlpBackend {
+	return &YtDlpBackend{
+		conf:    conf,
+		binUri:  filepath.Join(conf.BasePath, ".bin", "yt-dlp"),
+		running: make(map[string]context.CancelFunc),
+	}
+}
+
+func (b *YtDlpBackend) Name() string {
+	return BackendYtDlp
+}
+
+func (b *YtDlpBackend) Prepare() error {
+	// execute ``yt-dlp --version`` to check if the binary is working
+	cmd := exec.Command(b.binUri, "--version")
+	if err := cmd.Run(); err != nil {
+		log.Info("yt-dlp binary not found, downloading...")
+		// download yt-dlp binary if not exists
+		if err := ioutil.DownloadFile(b.conf.YtDlpLink, b.binUri, true, 0755); err != nil {
+			log.Errorf("failed to download yt-dlp binary: %v", err)
+			return errors.ErrFailedOS
+		}
+	}
+	cmd = exec.Command(b.binUri, "--version")
+	versionOutput, err := cmd.Output()
+	if err != nil {
+		log.Errorf("yt-dlp binary is not working: %v", err)
+		return errors.ErrFailedOS
+	}
+	// log the version of yt-dlp binary and its path
+	log.Infof("yt-dlp version: %s, path: %s", strings.TrimSpace(string(versionOutput)), b.binUri)
+
+	// check if ffmpeg exists
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		log.Errorf("ffmpeg not found: %v", err)
+		return errors.ErrFailedOS
+	}
+	return nil
+}
+
+func (b *YtDlpBackend) Download(ctx context.Context, opt *DownloadOption, output string, progress func(float64)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	b.mu.Lock()
+	b.running[opt.ContentCredit] = cancel
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.running, opt.ContentCredit)
+		b.mu.Unlock()
+		cancel()
+	}()
+
+	messageChan := make(ioutil.ChanWriter)
+	parsed := make(chan struct{})
+	go func() {
+		defer close(parsed)
+		for msg := range messageChan {
+			for _, m := range strings.Split(msg, "\n") {
+				if len(strings.TrimSpace(m)) != 0 {
+					match := percentagePattern.FindStringSubmatch(m)
+					if len(match) > 1 {
+						p, _ := strconv.ParseFloat(match[1], 64)
+						progress(p)
+					}
+					log.Debugf("downloading %s: %s", opt.ContentCredit, m)
+				}
+			}
+		}
+	}()
+
+	// prepare the download command
+	args := make([]string, 0)
+	// if opt.Format != "" {
+	// 	args = append(args, "--merge-output-format", opt.Format)
+	// }
+	args = append(args, "-f", "worstaudio")
+	args = append(args, "-o", output)
+	args = append(args, opt.URL)
+	cmd := exec.CommandContext(ctx, b.binUri, args...)
+	setProcessGroup(cmd)
+	cmd.Stdout = messageChan
+	cmd.Stderr = messageChan
+	err := cmd.Run()
+	close(messageChan)
+	<-parsed
+	if ctx.Err() != nil {
+		// killed by cancel, report the cancellation rather than the exit status
+		return ctx.Err()
+	}
+	return err
+}
+
+// EstimateSize asks yt-dlp for the size of the audio format without downloading it.
+func (b *YtDlpBackend) EstimateSize(ctx context.Context, opt *DownloadOption) (int64, error) {
+	cmd := exec.CommandContext(ctx, b.binUri, "-f", "worstaudio", "--skip-download",
+		"--print", "%(filesize,filesize_approx)s", opt.URL)
+	output, err := cmd.Output()
+	if err != nil {
+		return -1, err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		// yt-dlp prints NA if the size is unknown
+		return -1, nil
+	}
+	return size, nil
+}
+
+// Probe asks yt-dlp for the metadata of the single content at the url, the playlists are not supported. The generic
+// extractor is disabled, which fetches whatever the url is, e.g. an internal host redirected to.
+func (b *YtDlpBackend) Probe(ctx context.Context, url string) (*Metadata, error) {
+	cmd := exec.CommandContext(ctx, b.binUri, "--use-extractors", "default,-generic",
+		"--dump-json", "--no-playlist", "--skip-download", url)
+	output, err := cmd.Output()
+	if err != nil {
+		log.Warnf("failed to probe %s: %v", url, err)
+		return nil, ErrUnsupportedURL
+	}
+	var info struct {
+		ID           string  `json:"id"`
+		ExtractorKey string  `json:"extractor_key"`
+		WebpageURL   string  `json:"webpage_url"`
+		Title        string  `json:"title"`
+		Thumbnail    string  `json:"thumbnail"`
+		Duration     float64 `json:"duration"`
+		Timestamp    int64   `json:"timestamp"`
+		LiveStatus   string  `json:"live_status"`
+	}
+	if err := json.Unmarshal(output, &info); err != nil {
+		log.Warnf("failed to parse the metadata of %s: %v", url, err)
+		return nil, ErrUnsupportedURL
+	}
+	if info.LiveStatus == "is_live" || info.LiveStatus == "is_upcoming" {
+		return nil, fmt.Errorf("the content is not aired yet")
+	}
+	metadata := &Metadata{
+		ID:        info.ID,
+		Platform:  info.ExtractorKey,
+		URL:       info.WebpageURL,
+		Title:     info.Title,
+		Thumbnail: info.Thumbnail,
+		Length:    time.Duration(info.Duration * float64(time.Second)),
+	}
+	if metadata.URL == "" {
+		metadata.URL = url
+	}
+	if info.Timestamp > 0 {
+		metadata.PublishedTime = time.Unix(info.Timestamp, 0)
+	}
+	return metadata, nil
+}
+
+func (b *YtDlpBackend) Cancel(contentCredit string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cancel, ok := b.running[contentCredit]
+	if !ok {
+		return errors.ErrNotFound
+	}
+	cancel()
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
@@ -18,6 +19,11 @@ import (
 type Fetcher struct {
 	proxies []string
 	conf 	*conf.FetcherConfig
+	// limiter limits the requests of all the workers, and proxyLimiters the requests through each proxy
+	limiter       *tokenBucket
+	proxyLimiters map[string]*tokenBucket
+	mu            sync.Mutex
+	inflight      map[string]bool // the channels being fetched
 }
 
 func NewFetcher(config *conf.FetcherConfig) *Fetcher {
@@ -25,43 +31,129 @@ func NewFetcher(config *conf.FetcherConfig) *Fetcher {
 	if config.ProxyConfig != nil {
 		proxies = config.ProxyConfig.Proxies
 	}
+	rateLimit := config.RateLimit
+	if rateLimit == 0 {
+		rateLimit = 1
+	}
+	burst := config.RateBurst
+	if burst <= 0 {
+		burst = config.Workers
+	}
+	proxyLimiters := make(map[string]*tokenBucket)
+	for _, proxy := range proxies {
+		proxyLimiters[proxy] = newTokenBucket(config.ProxyRateLimit, 1)
+	}
 	return &Fetcher{
-		proxies: proxies,
-		conf:    config,
+		proxies:       proxies,
+		conf:          config,
+		limiter:       newTokenBucket(rateLimit, burst),
+		proxyLimiters: proxyLimiters,
+		inflight:      make(map[string]bool),
 	}
 }
 
+// TryStart starts the workers to fetch the channels taken from next, and waits for them to stop with the context.
+// The channel being fetched by a worker is skipped by the others.
 func (cf *Fetcher) TryStart(ctx context.Context, next func() *dao.Channel, update func(*dao.Channel, *Result)) {
 	if !cf.conf.Enable {
 		log.Info("fetcher disabled")
 		return
 	}
-	// periodically (from d.conf.DownloadIntervalSeconds) fetch the content
-	timer := time.NewTicker(time.Duration(cf.conf.FetcheIntervalSeconds) * time.Second)
+	workers := cf.conf.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cf.work(ctx, next, update)
+		}()
+	}
+	wg.Wait()
+	log.Info("fetcher stopped")
+}
+
+// work fetches the channels one by one, and waits for the fetch interval when no channel is due.
+func (cf *Fetcher) work(ctx context.Context, next func() *dao.Channel, update func(*dao.Channel, *Result)) {
+	idle := time.Duration(cf.conf.FetcheIntervalSeconds) * time.Second
+	if idle <= 0 {
+		idle = time.Second
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 	for {
 		select {
 		case <-ctx.Done():
-			log.Info("fetcher stopped")
 			return
 		case <-timer.C:
-			channel := next()
-			if channel == nil {
-				continue
+			if cf.fetchNext(ctx, next, update) {
+				timer.Reset(0)
+			} else {
+				timer.Reset(idle)
 			}
-			result, err := cf.Fetch(FetchOption{
-				ChannelCredit: channel.ChannelCredit,
-			})
-			if err != nil {
-				log.Errorf("failed to fetch channel %s: %s", channel.ChannelCredit, err)
-				continue
-			}
-			update(channel, result)
 		}
 	}
 }
 
+// fetchNext fetches the next channel and updates the result, returns false if no channel is due.
+func (cf *Fetcher) fetchNext(ctx context.Context, next func() *dao.Channel, update func(*dao.Channel, *Result)) bool {
+	channel := next()
+	if channel == nil {
+		return false
+	}
+	if !cf.acquire(channel.ChannelCredit) {
+		log.Debugf("channel %s is being fetched, skip", channel.ChannelCredit)
+		return true
+	}
+	defer cf.release(channel.ChannelCredit)
+	result, err := cf.FetchContext(ctx, FetchOption{
+		ChannelCredit: channel.ChannelCredit,
+	})
+	if err != nil {
+		log.Errorf("failed to fetch channel %s: %s", channel.ChannelCredit, err)
+		return true
+	}
+	update(channel, result)
+	return true
+}
+
+// acquire marks the channel as being fetched, returns false if it's being fetched already.
+func (cf *Fetcher) acquire(channelCredit string) bool {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	if cf.inflight[channelCredit] {
+		return false
+	}
+	cf.inflight[channelCredit] = true
+	return true
+}
+
+func (cf *Fetcher) release(channelCredit string) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	delete(cf.inflight, channelCredit)
+}
+
+// get requests the url through a random proxy once allowed by the rate limits.
+func (cf *Fetcher) get(ctx context.Context, url string) (string, error) {
+	proxy := http.RandomProxy(cf.proxies)
+	if err := cf.limiter.Wait(ctx); err != nil {
+		return "", err
+	}
+	if err := cf.proxyLimiters[proxy].Wait(ctx); err != nil {
+		return "", err
+	}
+	return http.HttpGetWithProxy(ctx, proxy, url)
+}
+
 // ParseChannelCredit parse channel credit from channel credit string
 func (cf *Fetcher) ParseChannelCredit(channelCredit string) (string, error) {
+	return cf.parseChannelCredit(context.Background(), channelCredit)
+}
+
+func (cf *Fetcher) parseChannelCredit(ctx context.Context, channelCredit string) (string, error) {
 	channelCredit = strings.TrimSpace(channelCredit)
 	if !strings.HasPrefix(channelCredit, "https://") && !strings.HasPrefix(channelCredit, "http://") {
 		if strings.HasPrefix(channelCredit, "@") {
@@ -70,7 +162,7 @@ func (cf *Fetcher) ParseChannelCredit(channelCredit string) (string, error) {
 			channelCredit = "https://www.youtube.com/channel/" + channelCredit
 		}
 	}
-	html, err := http.HttpGet(cf.proxies, channelCredit)
+	html, err := cf.get(ctx, channelCredit)
 	if err != nil {
 		return "", err
 	}
@@ -84,12 +176,17 @@ func (cf *Fetcher) ParseChannelCredit(channelCredit string) (string, error) {
 }
 
 func (cf *Fetcher) Fetch(opt FetchOption) (*Result, error) {
-	channelID, err := cf.ParseChannelCredit(opt.ChannelCredit)
+	return cf.FetchContext(context.Background(), opt)
+}
+
+// FetchContext fetches the latest contents of the channel, the requests are limited by the rates.
+func (cf *Fetcher) FetchContext(ctx context.Context, opt FetchOption) (*Result, error) {
+	channelID, err := cf.parseChannelCredit(ctx, opt.ChannelCredit)
 	if err != nil {
 		return nil, err
 	}
 	baseUrl := fmt.Sprintf("https://www.youtube.com/channel/%s/videos?view=0&flow=grid", channelID)
-	html, err := http.HttpGet(cf.proxies, baseUrl)
+	html, err := cf.get(ctx, baseUrl)
 	if err != nil {
 		return nil, err
 	}
@@ -110,43 +207,12 @@ func (cf *Fetcher) Fetch(opt FetchOption) (*Result, error) {
 			continue
 		}
 		videoRenderer := gjson.Get(content.Raw, "richItemRenderer.content.videoRenderer")
-		videoId := gjson.Get(videoRenderer.Raw, "videoId")
-		title := gjson.Get(videoRenderer.Raw, "title.runs.0.text")
-		if videoId.Str == "" || title.Str == "" {
+		c, ok := parseVideoRenderer(videoRenderer, time.Now())
+		if !ok {
 			log.Warnf("videoId or title is empty, skip. channel: %s", opt.ChannelCredit)
 			continue
 		}
-		thumbnail := gjson.Get(videoRenderer.Raw, "thumbnail.thumbnails.@reverse.0.url")
-		thumbnailStr := strings.Split(thumbnail.Str, "?")[0]
-		thumbnailStr = regexp.MustCompile(`hqdefault_custom_[0-9]+\.jpg`).ReplaceAllString(thumbnailStr, "hqdefault.jpg")
-		publishedTimeText := gjson.Get(videoRenderer.Raw, "publishedTimeText.simpleText")
-		publishedTime, err := utiltime.TranslateAccessibility2Duration(publishedTimeText.Str)
-		if err != nil {
-			log.Warnf("failed to parse published time: %s", publishedTimeText.Str)
-		}
-		lengthText := gjson.Get(videoRenderer.Raw, "lengthText.simpleText")
-		length, err := utiltime.TranslateDuration(lengthText.Str)
-		if err != nil {
-			log.Warnf("failed to parse length: %s", lengthText.Str)
-		}
-		membersOnly := false
-		badges := gjson.Get(videoRenderer.Raw, "badges")
-		if badges.Exists() {
-			for _, badge := range badges.Array() {
-				if gjson.Get(badge.Raw, "metadataBadgeRenderer.label").Str == "Members only" {
-					membersOnly = true
-					break
-				}
-			}
-		}
-		contents = append(contents, Content{
-			Credit:        videoId.Str,
-			Title:         title.Str,
-			Thumbnail:     thumbnailStr,
-			PublishedTime: time.Now().Add(-publishedTime),
-			Length:        length,
-			MembersOnly:   membersOnly,
-		})
+		contents = append(contents, *c)
 	}
 	metadata := gjson.Get(initialDataStr, "metadata.channelMetadataRenderer")
 	title := gjson.Get(metadata.Raw, "title")
@@ -173,6 +239,76 @@ func (cf *Fetcher) Fetch(opt FetchOption) (*Result, error) {
 	}, nil
 }
 
+// parseVideoRenderer parses a content from the video renderer of the grid, returns false if it's not a video.
+func parseVideoRenderer(videoRenderer gjson.Result, now time.Time) (*Content, bool) {
+	videoId := gjson.Get(videoRenderer.Raw, "videoId")
+	title := gjson.Get(videoRenderer.Raw, "title.runs.0.text")
+	if videoId.Str == "" || title.Str == "" {
+		return nil, false
+	}
+	thumbnail := gjson.Get(videoRenderer.Raw, "thumbnail.thumbnails.@reverse.0.url")
+	thumbnailStr := strings.Split(thumbnail.Str, "?")[0]
+	thumbnailStr = regexp.MustCompile(`hqdefault_custom_[0-9]+\.jpg`).ReplaceAllString(thumbnailStr, "hqdefault.jpg")
+	content := &Content{
+		Credit:        videoId.Str,
+		Title:         title.Str,
+		Thumbnail:     thumbnailStr,
+		PublishedTime: now,
+		Type:          dao.ContentTypeRegular,
+	}
+	for _, badge := range gjson.Get(videoRenderer.Raw, "badges").Array() {
+		switch gjson.Get(badge.Raw, "metadataBadgeRenderer.label").Str {
+		case "Members only":
+			content.MembersOnly = true
+		case "LIVE":
+			content.Type = dao.ContentTypeLive
+		}
+	}
+	for _, overlay := range gjson.Get(videoRenderer.Raw, "thumbnailOverlays").Array() {
+		switch gjson.Get(overlay.Raw, "thumbnailOverlayTimeStatusRenderer.style").Str {
+		case "LIVE":
+			content.Type = dao.ContentTypeLive
+		case "SHORTS":
+			content.Type = dao.ContentTypeShort
+		}
+	}
+	url := gjson.Get(videoRenderer.Raw, "navigationEndpoint.commandMetadata.webCommandMetadata.url").Str
+	if strings.HasPrefix(url, "/shorts/") {
+		content.Type = dao.ContentTypeShort
+	}
+	// the scheduled ones carry the start time instead of the published time
+	if startTime := gjson.Get(videoRenderer.Raw, "upcomingEventData.startTime"); startTime.Exists() {
+		content.Type = dao.ContentTypeUpcoming
+		content.PublishedTime = time.Unix(startTime.Int(), 0)
+		return content, true
+	}
+	// the livestream vods are published as "Streamed 2 days ago", the premiered ones as "Premiered 2 days ago"
+	publishedTimeText := gjson.Get(videoRenderer.Raw, "publishedTimeText.simpleText").Str
+	if strings.HasPrefix(publishedTimeText, "Streamed ") {
+		content.Type = dao.ContentTypeLive
+		publishedTimeText = strings.TrimPrefix(publishedTimeText, "Streamed ")
+	} else if strings.HasPrefix(publishedTimeText, "Premiered ") {
+		content.Type = dao.ContentTypePremiere
+		publishedTimeText = strings.TrimPrefix(publishedTimeText, "Premiered ")
+	}
+	if publishedTimeText != "" {
+		publishedTime, err := utiltime.TranslateAccessibility2Duration(publishedTimeText)
+		if err != nil {
+			log.Warnf("failed to parse published time: %s", publishedTimeText)
+		}
+		content.PublishedTime = now.Add(-publishedTime)
+	}
+	lengthText := gjson.Get(videoRenderer.Raw, "lengthText.simpleText")
+	if lengthText.Exists() {
+		length, err := utiltime.TranslateDuration(lengthText.Str)
+		if err != nil {
+			log.Warnf("failed to parse length: %s", lengthText.Str)
+		}
+		content.Length = length
+	}
+	return content, true
+}
+
 func getTextFromHtml(html, key string, numChars int, stop string) (string, error) {
 	posBegin := strings.Index(html, key)
 	if posBegin == -1 {
@@ -210,4 +346,17 @@ type Content struct {
 	PublishedTime time.Time
 	Length        time.Duration
 	MembersOnly   bool
+	Type          dao.ContentType
+}
+
+// Aired reports whether the content can be downloaded, the upcoming ones and the livestreams on air are not.
+func (c *Content) Aired() bool {
+	switch c.Type {
+	case dao.ContentTypeUpcoming:
+		return false
+	case dao.ContentTypeLive:
+		return c.Length > 0
+	default:
+		return true
+	}
 }
@@ -1,9 +1,13 @@
 package fetcher
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/tidwall/gjson"
 )
 
 func TestChannelFetcher_Fetch(t *testing.T) {
@@ -141,3 +145,146 @@ func TestFetcher_ParseChannelCredit(t *testing.T) {
 		})
 	}
 }
+
+func TestParseVideoRenderer(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		raw           string
+		wantOk        bool
+		wantType      dao.ContentType
+		wantLength    time.Duration
+		wantPublished time.Time
+		wantAired     bool
+	}{
+		{
+			name:          "Regular",
+			raw:           `{"videoId":"a","title":{"runs":[{"text":"A"}]},"publishedTimeText":{"simpleText":"2 days ago"},"lengthText":{"simpleText":"1:02:03"}}`,
+			wantOk:        true,
+			wantType:      dao.ContentTypeRegular,
+			wantLength:    time.Hour + 2*time.Minute + 3*time.Second,
+			wantPublished: now.AddDate(0, 0, -2),
+			wantAired:     true,
+		},
+		{
+			name:          "Short",
+			raw:           `{"videoId":"b","title":{"runs":[{"text":"B"}]},"publishedTimeText":{"simpleText":"1 hour ago"},"lengthText":{"simpleText":"0:45"},"navigationEndpoint":{"commandMetadata":{"webCommandMetadata":{"url":"/shorts/b"}}}}`,
+			wantOk:        true,
+			wantType:      dao.ContentTypeShort,
+			wantLength:    45 * time.Second,
+			wantPublished: now.Add(-time.Hour),
+			wantAired:     true,
+		},
+		{
+			name:          "Livestream on air",
+			raw:           `{"videoId":"c","title":{"runs":[{"text":"C"}]},"badges":[{"metadataBadgeRenderer":{"label":"LIVE"}}]}`,
+			wantOk:        true,
+			wantType:      dao.ContentTypeLive,
+			wantPublished: now,
+			wantAired:     false,
+		},
+		{
+			name:          "Livestream vod",
+			raw:           `{"videoId":"d","title":{"runs":[{"text":"D"}]},"publishedTimeText":{"simpleText":"Streamed 3 days ago"},"lengthText":{"simpleText":"2:00:00"}}`,
+			wantOk:        true,
+			wantType:      dao.ContentTypeLive,
+			wantLength:    2 * time.Hour,
+			wantPublished: now.AddDate(0, 0, -3),
+			wantAired:     true,
+		},
+		{
+			name:          "Upcoming",
+			raw:           `{"videoId":"e","title":{"runs":[{"text":"E"}]},"upcomingEventData":{"startTime":"1705000000"},"thumbnailOverlays":[{"thumbnailOverlayTimeStatusRenderer":{"style":"UPCOMING"}}]}`,
+			wantOk:        true,
+			wantType:      dao.ContentTypeUpcoming,
+			wantPublished: time.Unix(1705000000, 0),
+			wantAired:     false,
+		},
+		{
+			name:          "Premiered",
+			raw:           `{"videoId":"f","title":{"runs":[{"text":"F"}]},"publishedTimeText":{"simpleText":"Premiered 1 day ago"},"lengthText":{"simpleText":"10:00"}}`,
+			wantOk:        true,
+			wantType:      dao.ContentTypePremiere,
+			wantLength:    10 * time.Minute,
+			wantPublished: now.AddDate(0, 0, -1),
+			wantAired:     true,
+		},
+		{
+			name:   "Not a video",
+			raw:    `{}`,
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseVideoRenderer(gjson.Parse(tt.raw), now)
+			if ok != tt.wantOk {
+				t.Fatalf("parseVideoRenderer() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if got.Type != tt.wantType || got.Length != tt.wantLength || !got.PublishedTime.Equal(tt.wantPublished) {
+				t.Errorf("parseVideoRenderer() = %+v, want type %v, length %v, published %v", got, tt.wantType, tt.wantLength, tt.wantPublished)
+			}
+			if got.Aired() != tt.wantAired {
+				t.Errorf("Content.Aired() = %v, want %v", got.Aired(), tt.wantAired)
+			}
+		})
+	}
+}
+
+func TestTokenBucket_reserve(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newTokenBucket(2, 2)
+	b.last = now
+	b.now = func() time.Time { return now }
+
+	// the burst goes at once, then a token every half second
+	for i, want := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		if got := b.reserve(); got != want {
+			t.Errorf("tokenBucket.reserve() #%d = %v, want %v", i, got, want)
+		}
+	}
+	now = now.Add(2 * time.Second)
+	if got := b.reserve(); got != 0 {
+		t.Errorf("tokenBucket.reserve() after refilled = %v, want 0", got)
+	}
+	if b := newTokenBucket(0, 1); b != nil {
+		t.Errorf("newTokenBucket(0) = %v, want nil", b)
+	}
+}
+
+func TestTokenBucket_Wait(t *testing.T) {
+	var unlimited *tokenBucket
+	if err := unlimited.Wait(context.Background()); err != nil {
+		t.Errorf("tokenBucket.Wait() unlimited error = %v", err)
+	}
+	b := newTokenBucket(0.001, 1)
+	if err := b.Wait(context.Background()); err != nil {
+		t.Errorf("tokenBucket.Wait() error = %v", err)
+	}
+	// the canceled wait gives back its token
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); err == nil {
+		t.Errorf("tokenBucket.Wait() error = nil, want the context error")
+	}
+	if b.tokens < -0.01 {
+		t.Errorf("tokenBucket tokens = %v after canceled, want about 0", b.tokens)
+	}
+}
+
+func TestFetcher_acquire(t *testing.T) {
+	cf := NewFetcher(&conf.FetcherConfig{})
+	if !cf.acquire("a") {
+		t.Fatalf("Fetcher.acquire() = false, want true")
+	}
+	if cf.acquire("a") {
+		t.Errorf("Fetcher.acquire() the channel being fetched = true, want false")
+	}
+	cf.release("a")
+	if !cf.acquire("a") {
+		t.Errorf("Fetcher.acquire() after released = false, want true")
+	}
+}
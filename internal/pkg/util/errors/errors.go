@@ -8,4 +8,5 @@ var (
 	ErrUnknown       = err.New("unknown error")
 	ErrInvalidParams = err.New("invalid params")
 	ErrFailedOS      = err.New("failed to execute os command")
+	ErrNotFound      = err.New("not found")
 )
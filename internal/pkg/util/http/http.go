@@ -1,22 +1,49 @@
 package http
 
 import (
+    "context"
     "io"
     "math/rand"
     "net/http"
     net_url "net/url"
 )
 
-// HttpGet performs an HTTP GET request with optional proxies.
-func HttpGet(proxies []string, url string) (string, error) {
+// NewClient creates an HTTP client which goes through a random proxy of the given proxies, if any.
+func NewClient(proxies []string) *http.Client {
+    return NewClientWithProxy(RandomProxy(proxies))
+}
+
+// NewClientWithProxy creates an HTTP client which goes through the proxy, or directly if the proxy is empty.
+func NewClientWithProxy(proxy string) *http.Client {
     client := &http.Client{}
-    if len(proxies) > 0 {
-        randomIdx := rand.Intn(len(proxies))
-        proxyURL, _ := net_url.Parse(proxies[randomIdx])
+    if proxy != "" {
+        proxyURL, _ := net_url.Parse(proxy)
         client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
     }
+    return client
+}
+
+// RandomProxy returns a random proxy of the given proxies, or empty if none.
+func RandomProxy(proxies []string) string {
+    if len(proxies) == 0 {
+        return ""
+    }
+    return proxies[rand.Intn(len(proxies))]
+}
+
+// HttpGet performs an HTTP GET request with optional proxies.
+func HttpGet(proxies []string, url string) (string, error) {
+    return HttpGetWithProxy(context.Background(), RandomProxy(proxies), url)
+}
+
+// HttpGetWithProxy performs an HTTP GET request through the proxy, or directly if the proxy is empty.
+func HttpGetWithProxy(ctx context.Context, proxy string, url string) (string, error) {
+    client := NewClientWithProxy(proxy)
 
-    req, _ := http.NewRequest("GET", url, nil)
+    req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+    if err != nil {
+        return "", err
+    }
     req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
     req.Header.Set("Accept-Language", "en")
     req.AddCookie(&http.Cookie{Name: "CONSENT", Value: "YES+cb", Domain: ".youtube.com"})
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package ioutil
+
+import "syscall"
+
+// FreeSpace returns the available bytes of the file system containing the path.
+func FreeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package ioutil
+
+import "errors"
+
+// FreeSpace is not supported on windows yet.
+func FreeSpace(path string) (uint64, error) {
+	return 0, errors.New("free space is not supported on windows")
+}
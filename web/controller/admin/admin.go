@@ -0,0 +1,215 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogodjzhu/listen-tube/internal/app/auth"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/gogodjzhu/listen-tube/web/controller/middleware/interceptor"
+	"github.com/gogodjzhu/listen-tube/web/controller/middleware/jwt"
+)
+
+type AdminController struct {
+	authService *auth.AuthService
+}
+
+func NewAdminController(authService *auth.AuthService) (*AdminController, error) {
+	return &AdminController{
+		authService: authService,
+	}, nil
+}
+
+func (c *AdminController) AddHandler(r gin.IRoutes) error {
+	r.POST("/invite/create", func(ctx *gin.Context) {
+		var req CreateInviteRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.CreateInvite(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.GET("/invite/list", func(ctx *gin.Context) {
+		result := c.ListInvite()
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/invite/revoke", func(ctx *gin.Context) {
+		var req RevokeInviteRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result := c.RevokeInvite(&req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.GET("/user/list", func(ctx *gin.Context) {
+		result := c.ListUser()
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/user/role", func(ctx *gin.Context) {
+		var req SetRoleRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result := c.SetRole(&req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/user/reset_password", func(ctx *gin.Context) {
+		var req ResetPasswordRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result := c.ResetPassword(&req)
+		ctx.JSON(http.StatusOK, result)
+	})
+	return nil
+}
+
+// ResetPassword issues a one-time token for the user to reset the password, the admin hands it over to the user.
+func (c *AdminController) ResetPassword(req *ResetPasswordRequest) *interceptor.APIResponseDTO[*PasswordReset] {
+	token, expireAt, err := c.authService.CreatePasswordReset(req.UserName)
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[*PasswordReset](err.Error())
+	}
+	return interceptor.NewDefaultSuccessResponse(&PasswordReset{
+		Token:    token,
+		ExpireAt: expireAt.Unix(),
+	})
+}
+
+// ListUser lists all the users and their roles.
+func (c *AdminController) ListUser() *interceptor.APIResponseDTO[[]*User] {
+	users, err := c.authService.ListUsers()
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[[]*User](err.Error())
+	}
+	result := make([]*User, 0, len(users))
+	for _, user := range users {
+		result = append(result, &User{
+			UserName:    user.Name,
+			DisplayName: user.DisplayName,
+			Role:        string(auth.RoleOf(user)),
+			CreateAt:    user.CreateAt.Unix(),
+		})
+	}
+	return interceptor.NewDefaultSuccessResponse(result)
+}
+
+// SetRole changes the role of a user.
+func (c *AdminController) SetRole(req *SetRoleRequest) *interceptor.APIResponseDTO[string] {
+	if err := c.authService.SetRole(req.UserName, dao.UserRole(req.Role)); err != nil {
+		return interceptor.NewDefaultErrorResponse[string](err.Error())
+	}
+	return interceptor.NewDefaultSuccessResponse("")
+}
+
+// CreateInvite creates an invite code, default to single use and expire in 7 days.
+func (c *AdminController) CreateInvite(userInfo *jwt.UserInfo, req *CreateInviteRequest) *interceptor.APIResponseDTO[*Invite] {
+	maxUses, expiry := req.MaxUses, time.Duration(req.ExpireSeconds)*time.Second
+	if maxUses == 0 {
+		maxUses = 1
+	}
+	if expiry == 0 {
+		expiry = 7 * 24 * time.Hour
+	}
+	invite, err := c.authService.CreateInviteCode(userInfo.UserCredit, maxUses, expiry)
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[*Invite](err.Error())
+	}
+	return interceptor.NewDefaultSuccessResponse(toInvite(invite, nil))
+}
+
+// ListInvite lists all the invite codes and the users registered with them.
+func (c *AdminController) ListInvite() *interceptor.APIResponseDTO[[]*Invite] {
+	invites, redemptions, err := c.authService.ListInviteCodes()
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[[]*Invite](err.Error())
+	}
+	result := make([]*Invite, 0, len(invites))
+	for _, invite := range invites {
+		result = append(result, toInvite(invite, redemptions[invite.ID]))
+	}
+	return interceptor.NewDefaultSuccessResponse(result)
+}
+
+// RevokeInvite stops an invite code from being redeemed.
+func (c *AdminController) RevokeInvite(req *RevokeInviteRequest) *interceptor.APIResponseDTO[string] {
+	if err := c.authService.RevokeInviteCode(req.Code); err != nil {
+		return interceptor.NewDefaultErrorResponse[string](err.Error())
+	}
+	return interceptor.NewDefaultSuccessResponse("")
+}
+
+func toInvite(invite *dao.InviteCode, redemptions []*dao.InviteRedemption) *Invite {
+	result := &Invite{
+		Code:        invite.Code,
+		MaxUses:     invite.MaxUses,
+		UsedCount:   invite.UsedCount,
+		ExpireAt:    invite.ExpireAt.Unix(),
+		Revoked:     invite.Revoked,
+		CreateAt:    invite.CreateAt.Unix(),
+		Redemptions: make([]*Redemption, 0, len(redemptions)),
+	}
+	for _, redemption := range redemptions {
+		result.Redemptions = append(result.Redemptions, &Redemption{
+			UserName: redemption.UserName,
+			RedeemAt: redemption.CreateAt.Unix(),
+		})
+	}
+	return result
+}
+
+type CreateInviteRequest struct {
+	MaxUses       int `json:"max_uses"`
+	ExpireSeconds int `json:"expire_seconds"`
+}
+
+type RevokeInviteRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type Invite struct {
+	Code        string        `json:"code"`
+	MaxUses     int           `json:"max_uses"`
+	UsedCount   int           `json:"used_count"`
+	ExpireAt    int64         `json:"expire_at"`
+	Revoked     bool          `json:"revoked"`
+	CreateAt    int64         `json:"create_at"`
+	Redemptions []*Redemption `json:"redemptions"`
+}
+
+type Redemption struct {
+	UserName string `json:"user_name"`
+	RedeemAt int64  `json:"redeem_at"`
+}
+
+type SetRoleRequest struct {
+	UserName string `json:"user_name" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+}
+
+type User struct {
+	UserName    string `json:"user_name"`
+	DisplayName string `json:"display_name"`
+	Role        string `json:"role"`
+	CreateAt    int64  `json:"create_at"`
+}
+
+type ResetPasswordRequest struct {
+	UserName string `json:"user_name" binding:"required"`
+}
+
+type PasswordReset struct {
+	Token    string `json:"token"`
+	ExpireAt int64  `json:"expire_at"`
+}
@@ -1,11 +1,18 @@
 package buzz
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gogodjzhu/listen-tube/internal/app/auth"
 	"github.com/gogodjzhu/listen-tube/internal/app/subscribe"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/util/str"
 	utiltime "github.com/gogodjzhu/listen-tube/internal/pkg/util/time"
 	"github.com/gogodjzhu/listen-tube/web/controller/middleware/interceptor"
 	"github.com/gogodjzhu/listen-tube/web/controller/middleware/jwt"
@@ -13,11 +20,15 @@ import (
 
 type BuzzController struct {
 	subscribeService *subscribe.SubscribeService
+	signer           *auth.StreamSigner
+	baseURL          string // the external url to build the signed urls with
 }
 
-func NewBuzzController(subscribeService *subscribe.SubscribeService) (*BuzzController, error) {
+func NewBuzzController(subscribeService *subscribe.SubscribeService, signer *auth.StreamSigner, baseURL string) (*BuzzController, error) {
 	return &BuzzController{
 		subscribeService: subscribeService,
+		signer:           signer,
+		baseURL:          strings.TrimSuffix(baseURL, "/"),
 	}, nil
 }
 
@@ -44,6 +55,39 @@ func (c *BuzzController) AddHandler(r gin.IRoutes) error {
 		ctx.JSON(http.StatusOK, result)
 	})
 
+	r.POST("/subscription/tags", func(ctx *gin.Context) {
+		var req SubscriptionTagsRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.SetSubscriptionTags(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/subscription/filter", func(ctx *gin.Context) {
+		var req SubscriptionFilterRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.SetSubscriptionFilter(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/subscription/priority", func(ctx *gin.Context) {
+		var req SubscriptionPriorityRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.SetSubscriptionPriority(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
 	r.GET("/subscription/list", func(ctx *gin.Context) {
 		var req ListSubscriptionRequest
 		if err := ctx.ShouldBindQuery(&req); err != nil {
@@ -66,6 +110,142 @@ func (c *BuzzController) AddHandler(r gin.IRoutes) error {
 		ctx.JSON(http.StatusOK, result)
 	})
 
+	r.GET("/downloader/status", func(ctx *gin.Context) {
+		result := c.DownloaderStatus()
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.GET("/downloader/queue", func(ctx *gin.Context) {
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.DownloadQueue(userinfo)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.GET("/content/stream_url", func(ctx *gin.Context) {
+		var req StreamURLRequest
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.StreamURL(userinfo, c.baseURL, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/content/played", func(ctx *gin.Context) {
+		var req MarkPlayedRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.MarkPlayed(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/content/archive", func(ctx *gin.Context) {
+		var req ArchiveContentRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.ArchiveContent(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/content/star", func(ctx *gin.Context) {
+		var req StarContentRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.StarContent(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/channel/played", func(ctx *gin.Context) {
+		var req ChannelRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.MarkChannelPlayed(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/content/progress", func(ctx *gin.Context) {
+		var req ReportProgressRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Device == "" {
+			req.Device = ctx.Request.UserAgent()
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.ReportProgress(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.GET("/content/progress", func(ctx *gin.Context) {
+		var req ProgressRequest
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.GetProgress(userinfo, req.ContentCredit)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/content/cancel", func(ctx *gin.Context) {
+		var req ContentRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.CancelDownload(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/content/requeue", func(ctx *gin.Context) {
+		var req ContentRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.RequeueContent(userinfo, &req, false)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/content/redownload", func(ctx *gin.Context) {
+		var req ContentRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.RequeueContent(userinfo, &req, true)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/content/import", func(ctx *gin.Context) {
+		var req ImportContentRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.ImportContent(ctx.Request.Context(), userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	c.addPlaylistHandler(r)
 	return nil
 }
 
@@ -87,6 +267,33 @@ func (c *BuzzController) DeleteSubscription(userInfo *jwt.UserInfo, req *DeleteS
 	}
 }
 
+// SetSubscriptionTags replaces the tags of a subscription, which are matched by the smart playlists.
+func (c *BuzzController) SetSubscriptionTags(userInfo *jwt.UserInfo, req *SubscriptionTagsRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.SetSubscriptionTags(userInfo.UserCredit, req.ChannelID, req.Tags); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// SetSubscriptionFilter replaces the filter of the contents to download of a subscription.
+func (c *BuzzController) SetSubscriptionFilter(userInfo *jwt.UserInfo, req *SubscriptionFilterRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.SetSubscriptionFilter(userInfo.UserCredit, req.ChannelID, &req.Filter); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// SetSubscriptionPriority sets the download priority of the contents of a subscription.
+func (c *BuzzController) SetSubscriptionPriority(userInfo *jwt.UserInfo, req *SubscriptionPriorityRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.SetSubscriptionPriority(userInfo.UserCredit, req.ChannelID, req.Priority); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
 // ListSubscription lists all subscriptions for a user.
 func (c *BuzzController) ListSubscription(userInfo *jwt.UserInfo, req *ListSubscriptionRequest) *interceptor.APIResponseDTO[[]*Subscription] {
 	subscriptions, err := c.subscribeService.ListSubscription(userInfo.UserCredit)
@@ -99,10 +306,15 @@ func (c *BuzzController) ListSubscription(userInfo *jwt.UserInfo, req *ListSubsc
 		if err != nil {
 			continue
 		}
+		filter, _ := subscribe.SubscriptionFilterOf(sub)
 		result[i] = &Subscription{
 			Platform:         "youtube", // TODO: get platform
+			ChannelCredit:    sub.ChannelCredit,
 			ChannelName:      channel.Name,
 			ChannelThubmnail: channel.Thumbnails,
+			Tags:             str.StringToArrayWithSplit(sub.Tags, ","),
+			Filter:           filter,
+			Priority:         sub.Priority,
 			CreateAt:         sub.CreateAt.Unix(),
 			UpdateAt:         sub.UpdateAt.Unix(),
 		}
@@ -112,12 +324,27 @@ func (c *BuzzController) ListSubscription(userInfo *jwt.UserInfo, req *ListSubsc
 
 // ListContent lists all contents for a user.
 func (c *BuzzController) ListContent(userInfo *jwt.UserInfo, req *ListContentRequest) *interceptor.APIResponseDTO[[]*Content] {
-	contents, err := c.subscribeService.ListContent(userInfo.UserCredit, req.PageIndex, req.PageSize)
+	filter, err := req.filter()
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[[]*Content](err.Error())
+	}
+	contents, err := c.subscribeService.FilterContent(userInfo.UserCredit, filter, req.PageIndex, req.PageSize)
 	if err != nil {
 		return interceptor.NewDefaultErrorResponse[[]*Content](err.Error())
 	}
+	result, err := c.toContents(userInfo, contents)
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[[]*Content](err.Error())
+	}
+	return interceptor.NewDefaultSuccessResponse(result)
+}
+
+// toContents converts the contents with the channel names and the listen states of the user.
+func (c *BuzzController) toContents(userInfo *jwt.UserInfo, contents []*dao.Content) ([]*Content, error) {
+	contentCredits := make([]string, 0, len(contents))
 	channelCredits := make(map[string]string)
 	for _, content := range contents {
+		contentCredits = append(contentCredits, content.ContentCredit)
 		if _, ok := channelCredits[content.ChannelCredit]; !ok {
 			channel, err := c.subscribeService.GetChannel(content.ChannelCredit)
 			if err != nil {
@@ -126,6 +353,10 @@ func (c *BuzzController) ListContent(userInfo *jwt.UserInfo, req *ListContentReq
 			channelCredits[content.ChannelCredit] = channel.Name
 		}
 	}
+	listenStates, err := c.subscribeService.ListListenStates(userInfo.UserCredit, contentCredits)
+	if err != nil {
+		return nil, err
+	}
 
 	result := make([]*Content, len(contents))
 	for i, content := range contents {
@@ -138,15 +369,182 @@ func (c *BuzzController) ListContent(userInfo *jwt.UserInfo, req *ListContentReq
 			Thumbnail:     content.Thumbnail,
 			PublishedTime: utiltime.TranslateDuration2Accessibility(time.Now(), content.PublishedTime),
 			// format duration, format: 01:00:10, 10:10, 00:10
-			Length:   utiltime.FormatDuration(content.Length),
-			State:    int(content.State),
-			CreateAt: content.CreateAt.Unix(),
-			UpdateAt: content.UpdateAt.Unix(),
+			Length:       utiltime.FormatDuration(content.Length),
+			State:        int(content.State),
+			Type:         int(content.Type),
+			ListenStatus: string(subscribe.StatusOf(listenStates[content.ContentCredit])),
+			CreateAt:     content.CreateAt.Unix(),
+			UpdateAt:     content.UpdateAt.Unix(),
+		}
+		if state, ok := listenStates[content.ContentCredit]; ok {
+			result[i].Position = state.Position
+			result[i].Starred = state.Starred
+			result[i].Archived = state.Archived
+			if !state.LastPlayedAt.IsZero() {
+				result[i].LastPlayedAt = state.LastPlayedAt.Unix()
+			}
+		}
+	}
+	return result, nil
+}
+
+// DownloaderStatus returns the status of the download queue.
+func (c *BuzzController) DownloaderStatus() *interceptor.APIResponseDTO[*DownloaderStatus] {
+	status := c.subscribeService.DownloaderStatus()
+	return interceptor.NewDefaultSuccessResponse(&DownloaderStatus{
+		Paused:    status.Paused,
+		Reason:    status.Reason,
+		FreeBytes: status.FreeBytes,
+		CheckAt:   status.CheckAt.Unix(),
+	})
+}
+
+// DownloadQueue lists the contents of the user waiting in the download queue with their positions.
+func (c *BuzzController) DownloadQueue(userInfo *jwt.UserInfo) *interceptor.APIResponseDTO[*DownloadQueue] {
+	queue, total, err := c.subscribeService.ListDownloadQueue(userInfo.UserCredit)
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[*DownloadQueue](err.Error())
+	}
+	contents := make([]*dao.Content, len(queue))
+	for i, queued := range queue {
+		contents[i] = queued.Content
+	}
+	converted, err := c.toContents(userInfo, contents)
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[*DownloadQueue](err.Error())
+	}
+	result := &DownloadQueue{Total: total, Contents: make([]*QueuedContent, len(queue))}
+	for i, queued := range queue {
+		result.Contents[i] = &QueuedContent{
+			Content:  converted[i],
+			Position: queued.Position,
+			Score:    queued.Score,
+			Manual:   queued.Manual,
 		}
 	}
 	return interceptor.NewDefaultSuccessResponse(result)
 }
 
+// StreamURL returns a signed url for the clients without cookies to stream a content, e.g. the podcast apps.
+func (c *BuzzController) StreamURL(userInfo *jwt.UserInfo, baseURL string, req *StreamURLRequest) *interceptor.APIResponseDTO[string] {
+	if _, err := c.subscribeService.GetSubscribedContent(userInfo.UserCredit, req.ContentCredit); err != nil {
+		return interceptor.NewDefaultErrorResponse[string](err.Error())
+	}
+	return interceptor.NewDefaultSuccessResponse(c.streamURL(userInfo.UserCredit, baseURL, req.ContentCredit))
+}
+
+func (c *BuzzController) streamURL(userCredit, baseURL, contentCredit string) string {
+	values := c.signer.Sign(userCredit, contentCredit, auth.ScopeStream)
+	return baseURL + "/openapi/content/stream/" + url.PathEscape(contentCredit) + "?" + values.Encode()
+}
+
+// MarkPlayed marks a content as played or unplayed by the user.
+func (c *BuzzController) MarkPlayed(userInfo *jwt.UserInfo, req *MarkPlayedRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.MarkPlayed(userInfo.UserCredit, req.ContentCredit, req.Played); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// ArchiveContent archives a content to hide it from the inbox, or moves it back.
+func (c *BuzzController) ArchiveContent(userInfo *jwt.UserInfo, req *ArchiveContentRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.ArchiveContent(userInfo.UserCredit, req.ContentCredit, req.Archived); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// StarContent stars a content as a favorite, or unstars it.
+func (c *BuzzController) StarContent(userInfo *jwt.UserInfo, req *StarContentRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.StarContent(userInfo.UserCredit, req.ContentCredit, req.Starred); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// MarkChannelPlayed marks all the contents of a channel as played, and returns how many are newly marked.
+func (c *BuzzController) MarkChannelPlayed(userInfo *jwt.UserInfo, req *ChannelRequest) *interceptor.APIResponseDTO[int] {
+	marked, err := c.subscribeService.MarkChannelPlayed(userInfo.UserCredit, req.ChannelCredit)
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[int](err.Error())
+	}
+	return interceptor.NewDefaultSuccessResponse(marked)
+}
+
+// ReportProgress records the playback progress of a content reported by a device.
+func (c *BuzzController) ReportProgress(userInfo *jwt.UserInfo, req *ReportProgressRequest) *interceptor.APIResponseDTO[*ListenState] {
+	progress := &subscribe.Progress{
+		Position:  req.Position,
+		Completed: req.Completed,
+		Device:    req.Device,
+	}
+	if req.PlayedAt > 0 {
+		progress.PlayedAt = time.Unix(req.PlayedAt, 0)
+	}
+	state, err := c.subscribeService.ReportProgress(userInfo.UserCredit, req.ContentCredit, progress)
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[*ListenState](err.Error())
+	}
+	return interceptor.NewDefaultSuccessResponse(toListenState(state))
+}
+
+// GetProgress gets the playback progress of a content to resume from.
+func (c *BuzzController) GetProgress(userInfo *jwt.UserInfo, contentCredit string) *interceptor.APIResponseDTO[*ListenState] {
+	state, err := c.subscribeService.GetListenState(userInfo.UserCredit, contentCredit)
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[*ListenState](err.Error())
+	}
+	return interceptor.NewDefaultSuccessResponse(toListenState(state))
+}
+
+func toListenState(state *dao.ListenState) *ListenState {
+	result := &ListenState{
+		ContentCredit: state.ContentCredit,
+		Status:        string(subscribe.StatusOf(state)),
+		Position:      state.Position,
+		Played:        state.Played,
+		Device:        state.Device,
+	}
+	if !state.LastPlayedAt.IsZero() {
+		result.LastPlayedAt = state.LastPlayedAt.Unix()
+	}
+	return result
+}
+
+// CancelDownload cancels the in-flight download of a content.
+func (c *BuzzController) CancelDownload(userInfo *jwt.UserInfo, req *ContentRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.CancelDownload(userInfo.UserCredit, req.ContentCredit); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// RequeueContent puts a content back to the download queue, force to re-download it.
+func (c *BuzzController) RequeueContent(userInfo *jwt.UserInfo, req *ContentRequest, force bool) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.RequeueContent(userInfo.UserCredit, req.ContentCredit, force); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// ImportContent imports a single content by its url into the saved channel of the user.
+func (c *BuzzController) ImportContent(ctx context.Context, userInfo *jwt.UserInfo, req *ImportContentRequest) *interceptor.APIResponseDTO[*Content] {
+	content, err := c.subscribeService.ImportContent(ctx, userInfo.UserCredit, req.URL)
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[*Content](err.Error())
+	}
+	result, err := c.toContents(userInfo, []*dao.Content{content})
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[*Content](err.Error())
+	}
+	return interceptor.NewDefaultSuccessResponse(result[0])
+}
+
 type AddSubscriptionRequest struct {
 	ChannelID string `json:"channel_id"`
 }
@@ -155,20 +553,116 @@ type DeleteSubscriptionRequest struct {
 	ChannelID string `json:"channel_id"`
 }
 
+type SubscriptionTagsRequest struct {
+	ChannelID string   `json:"channel_id"`
+	Tags      []string `json:"tags"`
+}
+
+type SubscriptionPriorityRequest struct {
+	ChannelID string `json:"channel_id"`
+	Priority  int    `json:"priority"` // -10 to 10
+}
+
+type SubscriptionFilterRequest struct {
+	ChannelID string                       `json:"channel_id"`
+	Filter    subscribe.SubscriptionFilter `json:"filter"`
+}
+
 type ListSubscriptionRequest struct {
 }
 
 type ListContentRequest struct {
-	PageIndex int `form:"page_index"`
-	PageSize  int `form:"page_size"`
+	PageIndex     int    `form:"page_index"`
+	PageSize      int    `form:"page_size"`
+	ChannelCredit string `form:"channel_credit"`
+	Played        string `form:"played"`   // true or false, default to all
+	Starred       string `form:"starred"`  // true or false, default to all
+	Archived      string `form:"archived"` // true, false or all, default to false, which lists the inbox
+	Since         int64  `form:"since"`    // published at or after, unix seconds
+	Until         int64  `form:"until"`    // published before, unix seconds
+}
+
+func (r *ListContentRequest) filter() (*subscribe.ContentFilter, error) {
+	filter := &subscribe.ContentFilter{ChannelCredit: r.ChannelCredit}
+	if r.Archived == "" {
+		r.Archived = "false"
+	}
+	for _, flag := range []struct {
+		name  string
+		value string
+		dest  **bool
+	}{{"played", r.Played, &filter.Played}, {"starred", r.Starred, &filter.Starred}, {"archived", r.Archived, &filter.Archived}} {
+		switch flag.value {
+		case "", "all":
+		case "true", "false":
+			value := flag.value == "true"
+			*flag.dest = &value
+		default:
+			return nil, fmt.Errorf("invalid %s filter %s", flag.name, flag.value)
+		}
+	}
+	if r.Since > 0 {
+		filter.Since = time.Unix(r.Since, 0)
+	}
+	if r.Until > 0 {
+		filter.Until = time.Unix(r.Until, 0)
+	}
+	return filter, nil
+}
+
+type ArchiveContentRequest struct {
+	ContentCredit string `json:"content_credit"`
+	Archived      bool   `json:"archived"`
+}
+
+type StarContentRequest struct {
+	ContentCredit string `json:"content_credit"`
+	Starred       bool   `json:"starred"`
+}
+
+type ChannelRequest struct {
+	ChannelCredit string `json:"channel_credit"`
+}
+
+type ContentRequest struct {
+	ContentCredit string `json:"content_credit"`
+}
+
+type ImportContentRequest struct {
+	URL string `json:"url"`
+}
+
+type StreamURLRequest struct {
+	ContentCredit string `form:"content_credit"`
+}
+
+type ProgressRequest struct {
+	ContentCredit string `form:"content_credit" binding:"required"`
+}
+
+type MarkPlayedRequest struct {
+	ContentCredit string `json:"content_credit"`
+	Played        bool   `json:"played"`
+}
+
+type ReportProgressRequest struct {
+	ContentCredit string `json:"content_credit" binding:"required"`
+	Position      int    `json:"position"`  // seconds from the start
+	Completed     bool   `json:"completed"` // played to the end
+	Device        string `json:"device"`    // default to the user agent
+	PlayedAt      int64  `json:"played_at"` // when the position was played, for the reports sent later by the offline devices
 }
 
 type Subscription struct {
-	Platform         string `json:"platform"`
-	ChannelName      string `json:"channel_name"`
-	ChannelThubmnail string `json:"channel_thumbnail"`
-	CreateAt         int64  `json:"create_at"`
-	UpdateAt         int64  `json:"update_at"`
+	Platform         string                        `json:"platform"`
+	ChannelCredit    string                        `json:"channel_credit"`
+	ChannelName      string                        `json:"channel_name"`
+	ChannelThubmnail string                        `json:"channel_thumbnail"`
+	Tags             []string                      `json:"tags"`
+	Filter           *subscribe.SubscriptionFilter `json:"filter"`
+	Priority         int                           `json:"priority"`
+	CreateAt         int64                         `json:"create_at"`
+	UpdateAt         int64                         `json:"update_at"`
 }
 
 type Content struct {
@@ -181,6 +675,40 @@ type Content struct {
 	PublishedTime string `json:"published_time"`
 	Length        string `json:"length"`
 	State         int    `json:"state"`
+	Type          int    `json:"type"`          // 0 regular, 1 short, 2 live, 3 upcoming, 4 premiere
+	ListenStatus  string `json:"listen_status"` // unplayed, in_progress or played
+	Position      int    `json:"position"`      // resume position in seconds
+	LastPlayedAt  int64  `json:"last_played_at"`
+	Starred       bool   `json:"starred"`
+	Archived      bool   `json:"archived"`
 	CreateAt      int64  `json:"create_at"`
 	UpdateAt      int64  `json:"update_at"`
 }
+
+type ListenState struct {
+	ContentCredit string `json:"content_credit"`
+	Status        string `json:"status"` // unplayed, in_progress or played
+	Position      int    `json:"position"`
+	Played        bool   `json:"played"`
+	Device        string `json:"device"`
+	LastPlayedAt  int64  `json:"last_played_at"`
+}
+
+type DownloadQueue struct {
+	Total    int              `json:"total"` // length of the whole queue of all the users
+	Contents []*QueuedContent `json:"contents"`
+}
+
+type QueuedContent struct {
+	Content  *Content `json:"content"`
+	Position int      `json:"position"` // starts from 1, 0 for the downloading ones
+	Score    float64  `json:"score"`
+	Manual   bool     `json:"manual"` // requested by the users, ahead of the others
+}
+
+type DownloaderStatus struct {
+	Paused    bool   `json:"paused"`
+	Reason    string `json:"reason"`
+	FreeBytes uint64 `json:"free_bytes"`
+	CheckAt   int64  `json:"check_at"`
+}
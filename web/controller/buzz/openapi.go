@@ -2,11 +2,11 @@ package buzz
 
 import (
 	"net/http"
-	"os"
-	"path/filepath"
+	"path"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gogodjzhu/listen-tube/internal/app/subscribe"
+	"github.com/gogodjzhu/listen-tube/web/controller/middleware/jwt"
 )
 
 type OpenAPIController struct {
@@ -20,25 +20,35 @@ func NewOpenAPIController(subscribeService *subscribe.SubscribeService) (*OpenAP
 }
 
 func (c *OpenAPIController) AddHandler(r gin.IRoutes) error {
-	// ...existing code...
-
 	r.GET("/content/stream/:contentCredit", func(ctx *gin.Context) {
 		contentCredit := ctx.Param("contentCredit")
-		content, err := c.subscribeService.GetContent(contentCredit)
+		userinfo := jwt.GetCurrentUser(ctx)
+		content, err := c.subscribeService.AccessContent(userinfo.UserCredit, contentCredit)
+		if err == subscribe.ErrContentEvicted {
+			ctx.Header("Retry-After", "60")
+			ctx.JSON(http.StatusAccepted, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil || content == nil {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "Content not found"})
 			return
 		}
 
-		file, err := os.Open(content.Path)
-		if (err != nil) {
+		// redirect to the storage if the presigned url is enabled
+		if url, err := c.subscribeService.PresignContentURL(ctx, content); err == nil && url != "" {
+			ctx.Redirect(http.StatusFound, url)
+			return
+		}
+
+		file, info, err := c.subscribeService.OpenContent(ctx, content)
+		if err != nil {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 			return
 		}
 		defer file.Close()
 
 		ctx.Header("Content-Type", "audio/mp3")
-		http.ServeContent(ctx.Writer, ctx.Request, filepath.Base(content.Path), content.UpdateAt, file)
+		http.ServeContent(ctx.Writer, ctx.Request, path.Base(content.Path), info.ModTime, file)
 	})
 
 	return nil
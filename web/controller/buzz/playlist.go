@@ -0,0 +1,434 @@
+package buzz
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogodjzhu/listen-tube/internal/app/subscribe"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/gogodjzhu/listen-tube/web/controller/middleware/interceptor"
+	"github.com/gogodjzhu/listen-tube/web/controller/middleware/jwt"
+)
+
+func (c *BuzzController) addPlaylistHandler(r gin.IRoutes) {
+	r.GET("/playlist/list", func(ctx *gin.Context) {
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.ListPlaylists(userinfo)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/playlist/create", func(ctx *gin.Context) {
+		var req CreatePlaylistRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.CreatePlaylist(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/playlist/rename", func(ctx *gin.Context) {
+		var req RenamePlaylistRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.RenamePlaylist(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/playlist/rules", func(ctx *gin.Context) {
+		var req UpdateSmartRulesRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.UpdateSmartRules(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/playlist/delete", func(ctx *gin.Context) {
+		var req PlaylistRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.DeletePlaylist(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.GET("/playlist/items", func(ctx *gin.Context) {
+		var req PlaylistRequest
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.ListPlaylistItems(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/playlist/add", func(ctx *gin.Context) {
+		var req PlaylistItemRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.AddPlaylistItem(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/playlist/move", func(ctx *gin.Context) {
+		var req PlaylistItemRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.MovePlaylistItem(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.POST("/playlist/remove", func(ctx *gin.Context) {
+		var req PlaylistItemRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		result := c.RemovePlaylistItem(userinfo, &req)
+		ctx.JSON(http.StatusOK, result)
+	})
+
+	r.GET("/playlist/feed", func(ctx *gin.Context) {
+		var req PlaylistRequest
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		feed, err := c.PlaylistFeed(userinfo, c.baseURL, &req)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.Data(http.StatusOK, "application/rss+xml; charset=utf-8", feed)
+	})
+
+	r.GET("/playlist/export", func(ctx *gin.Context) {
+		var req ExportPlaylistRequest
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		contentType, ok := m3uContentTypes[req.Format]
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "format must be m3u or m3u8"})
+			return
+		}
+		userinfo := jwt.GetCurrentUser(ctx)
+		m3u, err := c.ExportPlaylist(userinfo, c.baseURL, &req.PlaylistRequest)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, req.PlaylistCredit, req.Format))
+		ctx.Data(http.StatusOK, contentType, m3u)
+	})
+}
+
+// ListPlaylists lists the playlists of the user, the up next queue comes first.
+func (c *BuzzController) ListPlaylists(userInfo *jwt.UserInfo) *interceptor.APIResponseDTO[[]*Playlist] {
+	playlists, err := c.subscribeService.ListPlaylists(userInfo.UserCredit)
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[[]*Playlist](err.Error())
+	}
+	result := make([]*Playlist, len(playlists))
+	for i, playlist := range playlists {
+		result[i] = toPlaylist(playlist)
+	}
+	return interceptor.NewDefaultSuccessResponse(result)
+}
+
+// CreatePlaylist creates a playlist for the user, or a smart playlist if the rules are given.
+func (c *BuzzController) CreatePlaylist(userInfo *jwt.UserInfo, req *CreatePlaylistRequest) *interceptor.APIResponseDTO[*Playlist] {
+	var playlist *dao.Playlist
+	var err error
+	if req.Rules != nil {
+		playlist, err = c.subscribeService.CreateSmartPlaylist(userInfo.UserCredit, req.Name, req.Rules, req.DownloadFirst)
+	} else {
+		playlist, err = c.subscribeService.CreatePlaylist(userInfo.UserCredit, req.Name)
+	}
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[*Playlist](err.Error())
+	}
+	return interceptor.NewDefaultSuccessResponse(toPlaylist(playlist))
+}
+
+// RenamePlaylist renames a playlist of the user.
+func (c *BuzzController) RenamePlaylist(userInfo *jwt.UserInfo, req *RenamePlaylistRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.RenamePlaylist(userInfo.UserCredit, req.PlaylistCredit, req.Name); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// UpdateSmartRules replaces the rules of a smart playlist of the user.
+func (c *BuzzController) UpdateSmartRules(userInfo *jwt.UserInfo, req *UpdateSmartRulesRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.UpdateSmartRules(userInfo.UserCredit, req.PlaylistCredit, &req.Rules, req.DownloadFirst); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// DeletePlaylist deletes a playlist of the user.
+func (c *BuzzController) DeletePlaylist(userInfo *jwt.UserInfo, req *PlaylistRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.DeletePlaylist(userInfo.UserCredit, req.PlaylistCredit); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// ListPlaylistItems lists the contents of a playlist in the playing order.
+func (c *BuzzController) ListPlaylistItems(userInfo *jwt.UserInfo, req *PlaylistRequest) *interceptor.APIResponseDTO[[]*Content] {
+	contents, err := c.subscribeService.ListPlaylistContents(userInfo.UserCredit, req.PlaylistCredit)
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[[]*Content](err.Error())
+	}
+	result, err := c.toContents(userInfo, contents)
+	if err != nil {
+		return interceptor.NewDefaultErrorResponse[[]*Content](err.Error())
+	}
+	return interceptor.NewDefaultSuccessResponse(result)
+}
+
+// AddPlaylistItem adds a content to a playlist, at the end or to be played next.
+func (c *BuzzController) AddPlaylistItem(userInfo *jwt.UserInfo, req *PlaylistItemRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.AddPlaylistItem(userInfo.UserCredit, req.PlaylistCredit, req.ContentCredit, req.Next); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// MovePlaylistItem moves a content of a playlist to the position.
+func (c *BuzzController) MovePlaylistItem(userInfo *jwt.UserInfo, req *PlaylistItemRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.MovePlaylistItem(userInfo.UserCredit, req.PlaylistCredit, req.ContentCredit, req.Position); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// RemovePlaylistItem removes a content from a playlist.
+func (c *BuzzController) RemovePlaylistItem(userInfo *jwt.UserInfo, req *PlaylistItemRequest) *interceptor.APIResponseDTO[bool] {
+	if err := c.subscribeService.RemovePlaylistItem(userInfo.UserCredit, req.PlaylistCredit, req.ContentCredit); err != nil {
+		return interceptor.NewDefaultErrorResponse[bool](err.Error())
+	} else {
+		return interceptor.NewDefaultSuccessResponse(true)
+	}
+}
+
+// PlaylistFeed renders a playlist as a podcast feed, the enclosures are signed stream urls. The feed is of the
+// serial type, so that the podcast apps play the items in the order of the playlist.
+func (c *BuzzController) PlaylistFeed(userInfo *jwt.UserInfo, baseURL string, req *PlaylistRequest) ([]byte, error) {
+	playlist, contents, err := c.playableContents(userInfo, req.PlaylistCredit)
+	if err != nil {
+		return nil, err
+	}
+	feed := rss{
+		Version: "2.0",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Channel: rssChannel{
+			Title:       playlist.Name,
+			Link:        baseURL,
+			Description: "Playlist " + playlist.Name + " of listen-tube",
+			Type:        "serial",
+			Items:       make([]rssItem, 0, len(contents)),
+		},
+	}
+	for i, content := range contents {
+		item := rssItem{
+			Title:    content.Title,
+			GUID:     rssGUID{IsPermaLink: "false", Value: content.ContentCredit},
+			PubDate:  content.PublishedTime.Format(time.RFC1123Z),
+			Episode:  i + 1,
+			Duration: int(content.Length.Seconds()),
+			Enclosure: rssEnclosure{
+				URL:    c.streamURL(userInfo.UserCredit, baseURL, content.ContentCredit),
+				Length: content.Size,
+				Type:   "audio/mpeg",
+			},
+		}
+		if content.Thumbnail != "" {
+			item.Image = &itunesImage{Href: content.Thumbnail}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// ExportPlaylist exports a playlist as an extended M3U, the entries are signed stream urls which expire as the
+// signing config, so the playlist should be exported again after that.
+func (c *BuzzController) ExportPlaylist(userInfo *jwt.UserInfo, baseURL string, req *PlaylistRequest) ([]byte, error) {
+	playlist, contents, err := c.playableContents(userInfo, req.PlaylistCredit)
+	if err != nil {
+		return nil, err
+	}
+	var m3u strings.Builder
+	m3u.WriteString("#EXTM3U\n")
+	m3u.WriteString("#PLAYLIST:" + m3uEscape(playlist.Name) + "\n")
+	for _, content := range contents {
+		m3u.WriteString(fmt.Sprintf("#EXTINF:%d,%s\n", int(content.Length.Seconds()), m3uEscape(content.Title)))
+		m3u.WriteString(c.streamURL(userInfo.UserCredit, baseURL, content.ContentCredit) + "\n")
+	}
+	return []byte(m3u.String()), nil
+}
+
+// playableContents gets the playlist and its contents which can be streamed, the evicted ones are downloaded
+// again once streamed.
+func (c *BuzzController) playableContents(userInfo *jwt.UserInfo, playlistCredit string) (*dao.Playlist, []*dao.Content, error) {
+	playlist, err := c.subscribeService.GetPlaylist(userInfo.UserCredit, playlistCredit)
+	if err != nil {
+		return nil, nil, err
+	}
+	contents, err := c.subscribeService.ListPlaylistContents(userInfo.UserCredit, playlist.PlaylistCredit)
+	if err != nil {
+		return nil, nil, err
+	}
+	playable := make([]*dao.Content, 0, len(contents))
+	for _, content := range contents {
+		if content.State == dao.ContentStateDownloaded || content.State == dao.ContentStateEvicted {
+			playable = append(playable, content)
+		}
+	}
+	return playlist, playable, nil
+}
+
+// m3uEscape keeps the titles on their own lines.
+func m3uEscape(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+var m3uContentTypes = map[string]string{
+	"m3u":  "audio/x-mpegurl",
+	"m3u8": "application/vnd.apple.mpegurl",
+}
+
+func toPlaylist(playlist *dao.Playlist) *Playlist {
+	result := &Playlist{
+		PlaylistCredit: playlist.PlaylistCredit,
+		Name:           playlist.Name,
+		Kind:           "playlist",
+		DownloadFirst:  playlist.DownloadFirst,
+		CreateAt:       playlist.CreateAt.Unix(),
+		UpdateAt:       playlist.UpdateAt.Unix(),
+	}
+	switch playlist.Kind {
+	case dao.PlaylistKindQueue:
+		result.Kind = "queue"
+	case dao.PlaylistKindSmart:
+		result.Kind = "smart"
+		result.Rules, _ = subscribe.SmartRulesOf(playlist)
+	}
+	return result
+}
+
+type CreatePlaylistRequest struct {
+	Name          string                `json:"name"`
+	Rules         *subscribe.SmartRules `json:"rules"`          // create a smart playlist by the rules
+	DownloadFirst bool                  `json:"download_first"` // download the contents of the smart playlist first
+}
+
+type UpdateSmartRulesRequest struct {
+	PlaylistCredit string               `json:"playlist_credit"`
+	Rules          subscribe.SmartRules `json:"rules"`
+	DownloadFirst  bool                 `json:"download_first"`
+}
+
+type RenamePlaylistRequest struct {
+	PlaylistCredit string `json:"playlist_credit"`
+	Name           string `json:"name"`
+}
+
+type PlaylistRequest struct {
+	PlaylistCredit string `json:"playlist_credit" form:"playlist_credit"` // or queue for the up next queue
+}
+
+type PlaylistItemRequest struct {
+	PlaylistCredit string `json:"playlist_credit"` // or queue for the up next queue
+	ContentCredit  string `json:"content_credit"`
+	Next           bool   `json:"next"`     // add to be played next instead of at the end
+	Position       int    `json:"position"` // move to, starts from 0
+}
+
+type ExportPlaylistRequest struct {
+	PlaylistRequest
+	Format string `form:"format"` // m3u or m3u8
+}
+
+type Playlist struct {
+	PlaylistCredit string                `json:"playlist_credit"`
+	Name           string                `json:"name"`
+	Kind           string                `json:"kind"` // playlist, queue or smart
+	Rules          *subscribe.SmartRules `json:"rules,omitempty"`
+	DownloadFirst  bool                  `json:"download_first"`
+	CreateAt       int64                 `json:"create_at"`
+	UpdateAt       int64                 `json:"update_at"`
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Type        string    `xml:"itunes:type"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title     string       `xml:"title"`
+	GUID      rssGUID      `xml:"guid"`
+	PubDate   string       `xml:"pubDate"`
+	Enclosure rssEnclosure `xml:"enclosure"`
+	Episode   int          `xml:"itunes:episode"`
+	Duration  int          `xml:"itunes:duration"` // seconds
+	Image     *itunesImage `xml:"itunes:image,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
 	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/gogodjzhu/listen-tube/web/controller/admin"
 	"github.com/gogodjzhu/listen-tube/web/controller/buzz"
 	"github.com/gogodjzhu/listen-tube/web/controller/middleware/jwt"
 )
@@ -25,6 +26,10 @@ type Controller struct {
 
 func NewController(ctx context.Context, conf *conf.Config) (*Controller, error) {
 	r := gin.Default()
+	// the client ips limit the logins, only the configured proxies are trusted to forward them
+	if err := r.SetTrustedProxies(conf.WebConfig.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies, err: %v", err)
+	}
 	// TODO: only allow specific origin
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"http://localhost:8090"}
@@ -53,10 +58,11 @@ func NewController(ctx context.Context, conf *conf.Config) (*Controller, error)
 	if err != nil {
 		return nil, err
 	}
-	authService, err := auth.NewAuthService(unionMapper)
+	authService, err := auth.NewAuthService(unionMapper, conf.AuthConfig)
 	if err != nil {
 		return nil, err
 	}
+	authService.OnAccountDeleted(subscribeService.DeleteSavedChannel)
 
 	return &Controller{
 		Conf:            conf,
@@ -67,7 +73,15 @@ func NewController(ctx context.Context, conf *conf.Config) (*Controller, error)
 }
 
 func (c *Controller) Start() error {
-	buzzController, err := buzz.NewBuzzController(c.subcribeService)
+	var signingConfig *conf.StreamSigningConfig
+	if c.Conf.AuthConfig != nil {
+		signingConfig = c.Conf.AuthConfig.StreamSigningConfig
+	}
+	signer, err := auth.NewStreamSigner(signingConfig)
+	if err != nil {
+		return err
+	}
+	buzzController, err := buzz.NewBuzzController(c.subcribeService, signer, externalURL(c.Conf.WebConfig))
 	if err != nil {
 		return err
 	}
@@ -75,7 +89,15 @@ func (c *Controller) Start() error {
 	if err != nil {
 		return err
 	}
-	jwtMiddleware, err := jwt.NewJWTMiddleware(c.authService)
+	adminController, err := admin.NewAdminController(c.authService)
+	if err != nil {
+		return err
+	}
+	var jwtConfig *conf.JWTConfig
+	if c.Conf.AuthConfig != nil {
+		jwtConfig = c.Conf.AuthConfig.JWTConfig
+	}
+	jwtMiddleware, err := jwt.NewJWTMiddleware(c.authService, jwtConfig)
 	if err != nil {
 		return err
 	}
@@ -85,18 +107,74 @@ func (c *Controller) Start() error {
 	authGroup.POST("/refresh_token", jwtMiddleware.RefreshHandler)
 	authGroup.POST("/logout", jwtMiddleware.LogoutHandler)
 	authGroup.POST("/register", jwtMiddleware.RegisterHandler)
+	authGroup.POST("/reset_password", jwtMiddleware.ResetPasswordHandler)
+	if c.authService.OIDCEnabled() {
+		authGroup.GET("/oidc/login", jwtMiddleware.OIDCLoginHandler)
+		authGroup.GET("/oidc/callback", jwtMiddleware.OIDCCallbackHandler)
+	}
 	authGroup.Use(jwtMiddleware.MiddlewareFunc())
 	{
 		authGroup.GET("/current_user", jwtMiddleware.UserInfoHandler)
+		authGroup.GET("/tokens", jwtMiddleware.ListAPITokensHandler)
+		authGroup.POST("/tokens/create", jwtMiddleware.CreateAPITokenHandler)
+		authGroup.POST("/tokens/revoke", jwtMiddleware.RevokeAPITokenHandler)
+		authGroup.POST("/password", jwtMiddleware.ChangePasswordHandler)
+		authGroup.POST("/profile", jwtMiddleware.UpdateProfileHandler)
+		authGroup.POST("/delete_account", jwtMiddleware.DeleteAccountHandler)
+		authGroup.GET("/sessions", jwtMiddleware.ListSessionsHandler)
+		authGroup.POST("/sessions/revoke", jwtMiddleware.RevokeSessionHandler)
+		authGroup.POST("/sessions/revoke_others", jwtMiddleware.RevokeOtherSessionsHandler)
 	}
 
 	buzzGroup := c.Router.Group("/buzz")
-	buzzGroup.Use(jwtMiddleware.MiddlewareFunc())
+	buzzGroup.Use(jwtMiddleware.APITokenOrJWTMiddleware(buzzScope))
 	{
 		buzzController.AddHandler(buzzGroup)
 	}
+	adminGroup := c.Router.Group("/admin")
+	adminGroup.Use(jwtMiddleware.MiddlewareFunc())
+	{
+		adminController.AddHandler(adminGroup)
+	}
 	openapiGroup := c.Router.Group("/openapi")
-	openApiController.AddHandler(openapiGroup)
+	openapiGroup.Use(jwtMiddleware.SignedOrJWTMiddleware(signer, auth.ScopeStream, "contentCredit"))
+	{
+		openApiController.AddHandler(openapiGroup)
+	}
 
 	return c.Router.Run(fmt.Sprintf("0.0.0.0:%d", c.Conf.WebConfig.Port)) // listen and serve on 0.0.0.0:8080
 }
+
+// buzzRouteScopes are the scopes accepted by the buzz apis besides the defaults. The apis giving out the signed stream
+// urls require the stream scope, as the urls grant it, and the players of either scope report the progress.
+var buzzRouteScopes = map[string][]string{
+	"/buzz/content/stream_url": {auth.ScopeStream},
+	"/buzz/playlist/feed":      {auth.ScopeStream},
+	"/buzz/playlist/export":    {auth.ScopeStream},
+	"/buzz/content/progress":   {auth.ScopeStream, auth.ScopeRead, auth.ScopeManage},
+}
+
+// buzzScope returns the scopes of api tokens accepted by the buzz apis, reading apis require the read scope and
+// the others require the manage scope, unless listed in buzzRouteScopes.
+func buzzScope(c *gin.Context) []string {
+	if scopes, ok := buzzRouteScopes[c.FullPath()]; ok {
+		return scopes
+	}
+	if c.Request.Method == http.MethodGet {
+		return []string{auth.ScopeRead}
+	}
+	return []string{auth.ScopeManage}
+}
+
+// externalURL returns the url the clients reach the server by, the signed urls are built with it rather than the
+// request headers, which are controlled by the clients.
+func externalURL(config *conf.WebConfig) string {
+	if config.ExternalURL != "" {
+		return config.ExternalURL
+	}
+	host := config.Host
+	if host == "" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("http://%s:%d", host, config.Port)
+}
@@ -0,0 +1,83 @@
+package jwt
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogodjzhu/listen-tube/web/controller/middleware/interceptor"
+)
+
+func (m *JWTMiddleware) ChangePasswordHandler(ctx *gin.Context) {
+	var req ChangePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	user := GetCurrentUser(ctx)
+	if err := m.authService.ChangePassword(user.UserName, req.OldPassword, req.NewPassword, currentSessionJTI(ctx)); err != nil {
+		ctx.JSON(http.StatusOK, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, interceptor.NewDefaultSuccessResponse(""))
+}
+
+func (m *JWTMiddleware) UpdateProfileHandler(ctx *gin.Context) {
+	var req UpdateProfileRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	user := GetCurrentUser(ctx)
+	if err := m.authService.UpdateDisplayName(user.UserCredit, req.DisplayName); err != nil {
+		ctx.JSON(http.StatusOK, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, interceptor.NewDefaultSuccessResponse(""))
+}
+
+// DeleteAccountHandler deletes the current user along with the personal data, and removes the jwt cookie.
+func (m *JWTMiddleware) DeleteAccountHandler(ctx *gin.Context) {
+	var req DeleteAccountRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	user := GetCurrentUser(ctx)
+	if err := m.authService.DeleteAccount(user.UserCredit, req.Password, currentSessionJTI(ctx)); err != nil {
+		ctx.JSON(http.StatusOK, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	m.LogoutHandler(ctx)
+}
+
+// ResetPasswordHandler sets the new password with the one-time reset token issued by an admin, no login required.
+func (m *JWTMiddleware) ResetPasswordHandler(ctx *gin.Context) {
+	var req ResetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	if err := m.authService.ResetPassword(req.Token, req.NewPassword); err != nil {
+		ctx.JSON(http.StatusOK, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, interceptor.NewDefaultSuccessResponse(""))
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type UpdateProfileRequest struct {
+	DisplayName string `json:"display_name"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"` // not required by the users provisioned by OIDC, who log in again instead
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
@@ -1,27 +1,52 @@
 package jwt
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 	"github.com/gogodjzhu/listen-tube/internal/app/auth"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
 	"github.com/gogodjzhu/listen-tube/web/controller/middleware/interceptor"
+	log "github.com/sirupsen/logrus"
 )
 
 type JWTMiddleware struct {
 	*jwt.GinJWTMiddleware
 	authService *auth.AuthService
+	keys        *keyring
 }
 
-func NewJWTMiddleware(authService *auth.AuthService) (*JWTMiddleware, error) {
+func NewJWTMiddleware(authService *auth.AuthService, config *conf.JWTConfig) (*JWTMiddleware, error) {
+	keys, err := newKeyring(config)
+	if err != nil {
+		return nil, err
+	}
+	realm, timeout, maxRefresh := "listen-tube", time.Hour*24*7, time.Hour*24*7
+	if config != nil && config.Realm != "" {
+		realm = config.Realm
+	}
+	if config != nil && config.TimeoutSeconds > 0 {
+		timeout = time.Duration(config.TimeoutSeconds) * time.Second
+	}
+	if config != nil && config.MaxRefreshSeconds > 0 {
+		maxRefresh = time.Duration(config.MaxRefreshSeconds) * time.Second
+	}
 	authMiddleware, err := jwt.New(&jwt.GinJWTMiddleware{
-		Realm:            "test zone",
-		SigningAlgorithm: "HS256",
-		Key:              []byte("secret key"),
-		Timeout:          time.Hour * 24 * 7,
-		MaxRefresh:       time.Hour * 24 * 7,
+		Realm:            realm,
+		SigningAlgorithm: keys.active.method.Alg(),
+		KeyFunc:          keys.keyFunc,
+		Timeout:          timeout,
+		MaxRefresh:       maxRefresh,
 		IdentityKey:      "listentube",
 		PayloadFunc: func(data interface{}) jwt.MapClaims {
 			if v, ok := data.(*UserInfo); ok {
@@ -45,8 +70,12 @@ func NewJWTMiddleware(authService *auth.AuthService) (*JWTMiddleware, error) {
 			if err := c.ShouldBind(&loginVals); err != nil {
 				return "", jwt.ErrMissingLoginValues
 			}
-			user, err := authService.Authenticate(loginVals.Username, loginVals.Password)
+			user, err := authService.Login(loginVals.Username, loginVals.Password, c.ClientIP())
 			if err != nil {
+				var lockedErr *auth.LoginLockedError
+				if errors.As(err, &lockedErr) {
+					return nil, lockedErr
+				}
 				return nil, jwt.ErrFailedAuthentication
 			}
 			return &UserInfo{
@@ -55,8 +84,7 @@ func NewJWTMiddleware(authService *auth.AuthService) (*JWTMiddleware, error) {
 			}, nil
 		},
 		Authorizator: func(data interface{}, c *gin.Context) bool {
-			// TODO: check if the user is authorized to perform the action
-			return true
+			return authorize(authService, data.(*UserInfo), c)
 		},
 		Unauthorized: func(c *gin.Context, code int, message string) {
 			c.JSON(code, interceptor.APIResponseDTO[string]{
@@ -87,10 +115,223 @@ func NewJWTMiddleware(authService *auth.AuthService) (*JWTMiddleware, error) {
 	m := JWTMiddleware{
 		GinJWTMiddleware: authMiddleware,
 		authService:      authService,
+		keys:             keys,
 	}
 	return &m, err
 }
 
+// LoginHandler authenticates the user and responds a new token of a new session. It replaces the one of gin-jwt,
+// which can neither sign with EdDSA nor set the kid header. The logins locked out by too many failures get 429 with
+// the Retry-After header.
+func (m *JWTMiddleware) LoginHandler(c *gin.Context) {
+	data, err := m.Authenticator(c)
+	if err != nil {
+		var lockedErr *auth.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+			m.unauthorized(c, http.StatusTooManyRequests, m.HTTPStatusMessageFunc(err, c))
+			return
+		}
+		m.unauthorized(c, http.StatusUnauthorized, m.HTTPStatusMessageFunc(err, c))
+		return
+	}
+	tokenString, expire, ok := m.newSession(c, data.(*UserInfo))
+	if !ok {
+		return
+	}
+	m.LoginResponse(c, http.StatusOK, tokenString, expire)
+}
+
+// newSession signs a token of a new session for the user and sets the cookie, the failure is responded.
+func (m *JWTMiddleware) newSession(c *gin.Context, user *UserInfo) (string, time.Time, bool) {
+	claims := m.PayloadFunc(user)
+	claims["jti"] = uuid.NewString()
+	tokenString, expire, err := m.signClaims(claims)
+	if err != nil {
+		m.unauthorized(c, http.StatusUnauthorized, m.HTTPStatusMessageFunc(jwt.ErrFailedTokenCreation, c))
+		return "", time.Time{}, false
+	}
+	if err := m.authService.CreateSession(user.UserCredit, claims["jti"].(string), c.Request.UserAgent(), c.ClientIP(), expire); err != nil {
+		log.Errorf("failed to create session of user %s, err:%v", user.UserName, err)
+		m.unauthorized(c, http.StatusUnauthorized, m.HTTPStatusMessageFunc(jwt.ErrFailedTokenCreation, c))
+		return "", time.Time{}, false
+	}
+	m.SetCookie(c, tokenString)
+	return tokenString, expire, true
+}
+
+// RefreshHandler responds a new token of the same session signed by the active key, the token still needs to be
+// valid on refresh.
+func (m *JWTMiddleware) RefreshHandler(c *gin.Context) {
+	claims, err := m.CheckIfTokenExpire(c)
+	if err != nil {
+		m.unauthorized(c, http.StatusUnauthorized, m.HTTPStatusMessageFunc(err, c))
+		return
+	}
+	jti, _ := claims["jti"].(string)
+	if !m.authService.IsSessionActive(jti) {
+		m.unauthorized(c, http.StatusUnauthorized, auth.ErrSessionRevoked.Error())
+		return
+	}
+	newClaims := jwt.MapClaims{}
+	for key := range claims {
+		newClaims[key] = claims[key]
+	}
+	tokenString, expire, err := m.signClaims(newClaims)
+	if err != nil {
+		m.unauthorized(c, http.StatusUnauthorized, m.HTTPStatusMessageFunc(jwt.ErrFailedTokenCreation, c))
+		return
+	}
+	if err := m.authService.RenewSession(jti, expire); err != nil {
+		m.unauthorized(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	m.SetCookie(c, tokenString)
+	m.RefreshResponse(c, http.StatusOK, tokenString, expire)
+}
+
+// LogoutHandler revokes the session of the token, and removes the jwt cookie.
+func (m *JWTMiddleware) LogoutHandler(c *gin.Context) {
+	if claims, err := m.GetClaimsFromJWT(c); err == nil {
+		if jti, ok := claims["jti"].(string); ok {
+			if err := m.authService.RevokeSessionByJTI(jti); err != nil {
+				log.Errorf("failed to revoke session %s, err:%v", jti, err)
+			}
+		}
+	}
+	m.GinJWTMiddleware.LogoutHandler(c)
+}
+
+// MiddlewareFunc rejects the tokens of the revoked sessions before handing over to gin-jwt, which checks the
+// signature, expiry and authorization.
+func (m *JWTMiddleware) MiddlewareFunc() gin.HandlerFunc {
+	next := m.GinJWTMiddleware.MiddlewareFunc()
+	return func(c *gin.Context) {
+		if claims, err := m.GetClaimsFromJWT(c); err == nil {
+			jti, _ := claims["jti"].(string)
+			if !m.authService.IsSessionActive(jti) {
+				m.unauthorized(c, http.StatusUnauthorized, auth.ErrSessionRevoked.Error())
+				return
+			}
+		}
+		next(c)
+	}
+}
+
+func (m *JWTMiddleware) signClaims(claims jwt.MapClaims) (string, time.Time, error) {
+	expire := m.TimeFunc().Add(m.TimeoutFunc(claims))
+	claims["exp"] = expire.Unix()
+	claims["orig_iat"] = m.TimeFunc().Unix()
+	tokenString, err := m.keys.sign(gojwt.MapClaims(claims))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expire, nil
+}
+
+func (m *JWTMiddleware) unauthorized(c *gin.Context, code int, message string) {
+	c.Header("WWW-Authenticate", "JWT realm="+m.Realm)
+	c.Abort()
+	m.Unauthorized(c, code, message)
+}
+
+// APITokenOrJWTMiddleware accepts either a personal api token granted any of the scopes accepted by the request, or a
+// JWT.
+func (m *JWTMiddleware) APITokenOrJWTMiddleware(acceptedScopes func(c *gin.Context) []string) gin.HandlerFunc {
+	jwtMiddleware := m.MiddlewareFunc()
+	return func(c *gin.Context) {
+		token := apiTokenFromRequest(c)
+		if token == "" {
+			jwtMiddleware(c)
+			return
+		}
+		user, apiToken, err := m.authService.AuthenticateAPIToken(token)
+		if err != nil {
+			m.Unauthorized(c, http.StatusUnauthorized, err.Error())
+			c.Abort()
+			return
+		}
+		if !slices.ContainsFunc(acceptedScopes(c), func(scope string) bool {
+			return auth.HasScope(apiToken, scope)
+		}) {
+			m.Unauthorized(c, http.StatusForbidden, auth.ErrInsufficientScope.Error())
+			c.Abort()
+			return
+		}
+		userInfo := &UserInfo{UserName: user.Name, UserCredit: user.Credit}
+		if !authorize(m.authService, userInfo, c) {
+			m.Unauthorized(c, http.StatusForbidden, jwt.ErrForbidden.Error())
+			c.Abort()
+			return
+		}
+		c.Set("JWT_PAYLOAD", userinfoToClaims(userInfo))
+		c.Next()
+	}
+}
+
+// apiTokenFromRequest returns the api token from the Authorization header or the token query, the podcast apps
+// only support the latter.
+func apiTokenFromRequest(c *gin.Context) string {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !strings.HasPrefix(token, auth.APITokenPrefix) {
+		token = c.Query("token")
+	}
+	if !strings.HasPrefix(token, auth.APITokenPrefix) {
+		return ""
+	}
+	return token
+}
+
+// SignedOrJWTMiddleware accepts either a url signed for the content of the path param with the scope, or an api
+// token granted the scope, or a JWT.
+func (m *JWTMiddleware) SignedOrJWTMiddleware(signer *auth.StreamSigner, scope, param string) gin.HandlerFunc {
+	jwtMiddleware := m.APITokenOrJWTMiddleware(func(c *gin.Context) []string {
+		return []string{scope}
+	})
+	return func(c *gin.Context) {
+		if c.Query("sig") == "" {
+			jwtMiddleware(c)
+			return
+		}
+		claims, err := signer.Verify(c.Request.URL.Query(), c.Param(param))
+		if err == nil && claims.Scope != scope {
+			err = auth.ErrInvalidSignature
+		}
+		if err != nil {
+			m.Unauthorized(c, http.StatusUnauthorized, err.Error())
+			c.Abort()
+			return
+		}
+		c.Set("JWT_PAYLOAD", userinfoToClaims(&UserInfo{UserCredit: claims.UserCredit}))
+		c.Next()
+	}
+}
+
+// authorize checks if the user is authorized to perform the action of the route by the role.
+func authorize(authorizer auth.Authorizer, user *UserInfo, c *gin.Context) bool {
+	ok, err := authorizer.Authorize(user.UserName, routeAction(c))
+	if err != nil {
+		log.Warnf("failed to authorize user %s, err:%v", user.UserName, err)
+		return false
+	}
+	return ok
+}
+
+// routeAction maps the route to the action: the admin apis require the admin action, the user's own account and
+// the reading apis require the read action, and the others require the write action.
+func routeAction(c *gin.Context) string {
+	switch {
+	case strings.HasPrefix(c.FullPath(), "/admin/"):
+		return auth.ActionAdmin
+	case strings.HasPrefix(c.FullPath(), "/auth/"):
+		return auth.ActionRead
+	case c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead:
+		return auth.ActionRead
+	default:
+		return auth.ActionWrite
+	}
+}
+
 func (m *JWTMiddleware) RegisterHandler(ctx *gin.Context) {
 	var req RegisterRequest
 	if err := ctx.ShouldBind(&req); err != nil {
@@ -100,14 +341,7 @@ func (m *JWTMiddleware) RegisterHandler(ctx *gin.Context) {
 		})
 		return
 	}
-	if req.InvitedCode != "123456" {
-		ctx.JSON(http.StatusBadRequest, interceptor.APIResponseDTO[RegisterResult]{
-			Code: 1,
-			Msg:  "invalid invited code",
-		})
-		return
-	}
-	err := m.authService.Register(req.Username, req.Password)
+	err := m.authService.Register(req.Username, req.Password, req.InvitedCode)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, interceptor.APIResponseDTO[RegisterResult]{
 			Code: 1,
@@ -131,6 +365,67 @@ func (m *JWTMiddleware) UserInfoHandler(ctx *gin.Context) {
 	})
 }
 
+func (m *JWTMiddleware) CreateAPITokenHandler(ctx *gin.Context) {
+	var req CreateAPITokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	user := GetCurrentUser(ctx)
+	token, apiToken, err := m.authService.CreateAPIToken(user.UserCredit, req.Name, req.Scopes)
+	if err != nil {
+		ctx.JSON(http.StatusOK, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	result := CreateAPITokenResult{
+		APIToken: toAPIToken(apiToken),
+		Token:    token,
+	}
+	ctx.JSON(http.StatusOK, interceptor.NewDefaultSuccessResponse(result))
+}
+
+func (m *JWTMiddleware) ListAPITokensHandler(ctx *gin.Context) {
+	user := GetCurrentUser(ctx)
+	apiTokens, err := m.authService.ListAPITokens(user.UserCredit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, interceptor.NewDefaultErrorResponse[[]APIToken](err.Error()))
+		return
+	}
+	result := make([]APIToken, 0, len(apiTokens))
+	for _, apiToken := range apiTokens {
+		result = append(result, toAPIToken(apiToken))
+	}
+	ctx.JSON(http.StatusOK, interceptor.NewDefaultSuccessResponse(result))
+}
+
+func (m *JWTMiddleware) RevokeAPITokenHandler(ctx *gin.Context) {
+	var req RevokeAPITokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	user := GetCurrentUser(ctx)
+	if err := m.authService.RevokeAPIToken(user.UserCredit, req.ID); err != nil {
+		ctx.JSON(http.StatusOK, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, interceptor.NewDefaultSuccessResponse(""))
+}
+
+func toAPIToken(apiToken *dao.APIToken) APIToken {
+	result := APIToken{
+		ID:       apiToken.ID,
+		Name:     apiToken.Name,
+		Prefix:   apiToken.Prefix,
+		Scopes:   strings.Split(apiToken.Scopes, ","),
+		CreateAt: apiToken.CreateAt.Unix(),
+	}
+	if !apiToken.LastUsedAt.IsZero() {
+		result.LastUsedAt = apiToken.LastUsedAt.Unix()
+	}
+	return result
+}
+
 type UserInfo struct {
 	UserName   string
 	UserCredit string
@@ -158,7 +453,30 @@ func userinfoToClaims(user *UserInfo) jwt.MapClaims {
 type RegisterRequest struct {
 	Username    string `form:"username" json:"username" binding:"required"`
 	Password    string `form:"password" json:"password" binding:"required"`
-	InvitedCode string `form:"invitedCode" json:"invitedCode" binding:"required"`
+	InvitedCode string `form:"invitedCode" json:"invitedCode"` // required in the invite registration mode
 }
 
 type RegisterResult string
+
+type CreateAPITokenRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+type RevokeAPITokenRequest struct {
+	ID uint `json:"id" binding:"required"`
+}
+
+type APIToken struct {
+	ID         uint     `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	CreateAt   int64    `json:"create_at"`
+	LastUsedAt int64    `json:"last_used_at"`
+}
+
+type CreateAPITokenResult struct {
+	APIToken
+	Token string `json:"token"` // the plain token, only returned on creation
+}
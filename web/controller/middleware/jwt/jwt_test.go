@@ -0,0 +1,165 @@
+package jwt
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogodjzhu/listen-tube/internal/app/auth"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/db/dao"
+	"github.com/gogodjzhu/listen-tube/web/controller/middleware/interceptor"
+)
+
+// mockRouter serves the session apis of a new user TestUser with the password "password", and returns the auth
+// service and the credit of the user.
+func mockRouter(t *testing.T) (*gin.Engine, *auth.AuthService, string) {
+	gin.SetMode(gin.TestMode)
+	ds, err := db.NewDatabaseSource(&conf.DBConfig{
+		DSN:    filepath.Join(t.TempDir(), "test.db"),
+		Driver: conf.SQLiteDriver,
+	})
+	if err != nil {
+		t.Fatalf("NewDatabaseSource() error = %v", err)
+	}
+	unionMapper, err := dao.NewUnionMapper(ds)
+	if err != nil {
+		t.Fatalf("NewUnionMapper() error = %v", err)
+	}
+	authService, err := auth.NewAuthService(unionMapper, &conf.AuthConfig{Registration: conf.OpenRegistration})
+	if err != nil {
+		t.Fatalf("NewAuthService() error = %v", err)
+	}
+	if err := authService.Register("TestUser", "password", ""); err != nil {
+		t.Fatalf("AuthService.Register() error = %v", err)
+	}
+	user, err := authService.Authenticate("TestUser", "password")
+	if err != nil {
+		t.Fatalf("AuthService.Authenticate() error = %v", err)
+	}
+	m, err := NewJWTMiddleware(authService, nil)
+	if err != nil {
+		t.Fatalf("NewJWTMiddleware() error = %v", err)
+	}
+
+	r := gin.New()
+	authGroup := r.Group("/auth")
+	authGroup.POST("/login", m.LoginHandler)
+	authGroup.POST("/refresh_token", m.RefreshHandler)
+	authGroup.POST("/logout", m.LogoutHandler)
+	authGroup.Use(m.MiddlewareFunc())
+	{
+		authGroup.GET("/current_user", m.UserInfoHandler)
+	}
+	return r, authService, user.Credit
+}
+
+// serve sends the request with the token, and returns the status and the data of the response.
+func serve(r *gin.Engine, method, path, body, token string) (int, string) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp interceptor.APIResponseDTO[json.RawMessage]
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	var data string
+	_ = json.Unmarshal(resp.Data, &data)
+	if data == "" {
+		// the refresh responds the token as gin-jwt does
+		var refresh struct {
+			Token string `json:"token"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &refresh)
+		data = refresh.Token
+	}
+	return w.Code, data
+}
+
+func login(t *testing.T, r *gin.Engine) string {
+	code, token := serve(r, http.MethodPost, "/auth/login", `{"username": "TestUser", "password": "password"}`, "")
+	if code != http.StatusOK || token == "" {
+		t.Fatalf("LoginHandler() = %d, %q, want a token", code, token)
+	}
+	return token
+}
+
+func TestJWTMiddleware_MiddlewareFunc(t *testing.T) {
+	r, authService, userCredit := mockRouter(t)
+	token := login(t, r)
+
+	if code, _ := serve(r, http.MethodGet, "/auth/current_user", "", token); code != http.StatusOK {
+		t.Fatalf("MiddlewareFunc() = %d for the active session, want %d", code, http.StatusOK)
+	}
+	// the token of the revoked session is rejected though it's not expired
+	if err := authService.RevokeOtherSessions(userCredit, ""); err != nil {
+		t.Fatalf("AuthService.RevokeOtherSessions() error = %v", err)
+	}
+	if code, _ := serve(r, http.MethodGet, "/auth/current_user", "", token); code != http.StatusUnauthorized {
+		t.Errorf("MiddlewareFunc() = %d for the revoked session, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestJWTMiddleware_LogoutHandler(t *testing.T) {
+	r, authService, userCredit := mockRouter(t)
+	token := login(t, r)
+	other := login(t, r)
+
+	if code, _ := serve(r, http.MethodPost, "/auth/logout", "", token); code != http.StatusOK {
+		t.Fatalf("LogoutHandler() = %d, want %d", code, http.StatusOK)
+	}
+	// only the session logged out is revoked
+	if code, _ := serve(r, http.MethodGet, "/auth/current_user", "", token); code != http.StatusUnauthorized {
+		t.Errorf("MiddlewareFunc() = %d after logout, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := serve(r, http.MethodGet, "/auth/current_user", "", other); code != http.StatusOK {
+		t.Errorf("MiddlewareFunc() = %d for the other session, want %d", code, http.StatusOK)
+	}
+	sessions, err := authService.ListSessions(userCredit)
+	if err != nil || len(sessions) != 1 {
+		t.Errorf("AuthService.ListSessions() = %v, error = %v, want the other session", sessions, err)
+	}
+}
+
+func TestJWTMiddleware_RefreshHandler(t *testing.T) {
+	r, authService, userCredit := mockRouter(t)
+	token := login(t, r)
+	before, err := authService.ListSessions(userCredit)
+	if err != nil || len(before) != 1 {
+		t.Fatalf("AuthService.ListSessions() = %v, error = %v, want 1 session", before, err)
+	}
+
+	// the refreshed token belongs to the same session, which is renewed rather than a new one created
+	code, refreshed := serve(r, http.MethodPost, "/auth/refresh_token", "", token)
+	if code != http.StatusOK || refreshed == "" {
+		t.Fatalf("RefreshHandler() = %d, %q, want a token", code, refreshed)
+	}
+	after, err := authService.ListSessions(userCredit)
+	if err != nil || len(after) != 1 || after[0].JTI != before[0].JTI {
+		t.Fatalf("AuthService.ListSessions() = %v, error = %v, want the session %s", after, err, before[0].JTI)
+	}
+	if after[0].ExpireAt.Before(before[0].ExpireAt) {
+		t.Errorf("RefreshHandler() expire at %v, want renewed from %v", after[0].ExpireAt, before[0].ExpireAt)
+	}
+	if code, _ := serve(r, http.MethodGet, "/auth/current_user", "", refreshed); code != http.StatusOK {
+		t.Errorf("MiddlewareFunc() = %d for the refreshed token, want %d", code, http.StatusOK)
+	}
+
+	// neither the revoked session can be refreshed, nor its refreshed token is accepted
+	if err := authService.RevokeOtherSessions(userCredit, ""); err != nil {
+		t.Fatalf("AuthService.RevokeOtherSessions() error = %v", err)
+	}
+	if code, _ := serve(r, http.MethodPost, "/auth/refresh_token", "", refreshed); code != http.StatusUnauthorized {
+		t.Errorf("RefreshHandler() = %d for the revoked session, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := serve(r, http.MethodGet, "/auth/current_user", "", refreshed); code != http.StatusUnauthorized {
+		t.Errorf("MiddlewareFunc() = %d for the revoked session, want %d", code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,159 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gogodjzhu/listen-tube/internal/app/auth"
+	"github.com/gogodjzhu/listen-tube/internal/pkg/conf"
+	gojwt "github.com/golang-jwt/jwt/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// signingKey signs or verifies the JWTs with one algorithm.
+type signingKey struct {
+	id        string
+	method    gojwt.SigningMethod
+	signKey   interface{} // nil if the key only verifies the tokens
+	verifyKey interface{}
+}
+
+// keyring holds the active key to sign the new tokens, and all the keys to verify the tokens by their kid header.
+type keyring struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+// newKeyring loads the keys from the config, a random HS256 key is used if no key is configured, in which case the
+// tokens are invalid after restart.
+func newKeyring(config *conf.JWTConfig) (*keyring, error) {
+	if config == nil || len(config.Keys) == 0 {
+		log.Warn("jwt signing key is not configured, use a random key")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		key := &signingKey{id: "default", method: gojwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+		return &keyring{active: key, keys: map[string]*signingKey{key.id: key}}, nil
+	}
+
+	k := &keyring{keys: make(map[string]*signingKey)}
+	for _, keyConfig := range config.Keys {
+		key, err := loadSigningKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load jwt key %s: %w", keyConfig.ID, err)
+		}
+		if _, ok := k.keys[key.id]; ok {
+			return nil, fmt.Errorf("duplicated jwt key %s", key.id)
+		}
+		k.keys[key.id] = key
+	}
+	activeKey := config.ActiveKey
+	if activeKey == "" {
+		activeKey = config.Keys[0].ID
+	}
+	k.active = k.keys[activeKey]
+	if k.active == nil {
+		return nil, fmt.Errorf("active jwt key %s not found", activeKey)
+	}
+	if k.active.signKey == nil {
+		return nil, fmt.Errorf("active jwt key %s has no private key", activeKey)
+	}
+	return k, nil
+}
+
+func loadSigningKey(config *conf.JWTKeyConfig) (*signingKey, error) {
+	if config.ID == "" {
+		return nil, errors.New("key id is required")
+	}
+	key := &signingKey{
+		id:     config.ID,
+		method: gojwt.GetSigningMethod(config.Algorithm),
+	}
+	if key.method == nil {
+		return nil, fmt.Errorf("unsupported algorithm %s", config.Algorithm)
+	}
+
+	switch {
+	case strings.HasPrefix(config.Algorithm, "HS"):
+		if config.Secret == "" {
+			return nil, errors.New("secret is required")
+		}
+		if config.Secret == auth.PlaceholderSecret {
+			return nil, fmt.Errorf("secret must be changed from the placeholder %s", auth.PlaceholderSecret)
+		}
+		key.signKey = []byte(config.Secret)
+		key.verifyKey = []byte(config.Secret)
+	case strings.HasPrefix(config.Algorithm, "RS"):
+		if err := loadPEMKeys(config, key, func(data []byte) (interface{}, error) {
+			return gojwt.ParseRSAPrivateKeyFromPEM(data)
+		}, func(data []byte) (interface{}, error) {
+			return gojwt.ParseRSAPublicKeyFromPEM(data)
+		}); err != nil {
+			return nil, err
+		}
+	case config.Algorithm == "EdDSA":
+		if err := loadPEMKeys(config, key, func(data []byte) (interface{}, error) {
+			return gojwt.ParseEdPrivateKeyFromPEM(data)
+		}, func(data []byte) (interface{}, error) {
+			return gojwt.ParseEdPublicKeyFromPEM(data)
+		}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %s", config.Algorithm)
+	}
+	return key, nil
+}
+
+// loadPEMKeys reads the key files, the private key is optional for the keys which only verify the tokens.
+func loadPEMKeys(config *conf.JWTKeyConfig, key *signingKey,
+	parsePrivate func([]byte) (interface{}, error), parsePublic func([]byte) (interface{}, error)) error {
+	if config.PublicKeyFile == "" {
+		return errors.New("public key file is required")
+	}
+	data, err := os.ReadFile(config.PublicKeyFile)
+	if err != nil {
+		return err
+	}
+	if key.verifyKey, err = parsePublic(data); err != nil {
+		return err
+	}
+	if config.PrivateKeyFile == "" {
+		return nil
+	}
+	data, err = os.ReadFile(config.PrivateKeyFile)
+	if err != nil {
+		return err
+	}
+	if key.signKey, err = parsePrivate(data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// sign signs the claims with the active key, the key id is set in the kid header.
+func (k *keyring) sign(claims gojwt.MapClaims) (string, error) {
+	token := gojwt.NewWithClaims(k.active.method, claims)
+	token.Header["kid"] = k.active.id
+	return token.SignedString(k.active.signKey)
+}
+
+// keyFunc finds the key to verify the token by its kid header, the tokens without kid are verified by the active key.
+func (k *keyring) keyFunc(token *gojwt.Token) (interface{}, error) {
+	key := k.active
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = k.keys[kid]
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown jwt key %v", token.Header["kid"])
+	}
+	// refuse the tokens signed by another algorithm, e.g. a HS256 token signed with the RSA public key
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing algorithm %s", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
@@ -0,0 +1,57 @@
+package jwt
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogodjzhu/listen-tube/internal/app/auth"
+	log "github.com/sirupsen/logrus"
+)
+
+// oidcStateCookie keeps the state of the OIDC login in the browser, so that the callback can't be replayed in
+// another browser to log it in as someone else.
+const oidcStateCookie = "oidc_state"
+
+// OIDCLoginHandler redirects the user to log in at the OIDC provider.
+func (m *JWTMiddleware) OIDCLoginHandler(c *gin.Context) {
+	authURL, state, err := m.authService.StartOIDCLogin(c.Request.Context())
+	if err != nil {
+		log.Errorf("failed to start oidc login, err:%v", err)
+		m.unauthorized(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	// the callback is a top level navigation from the provider, which carries the lax cookies
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, 600, "/auth/oidc", m.CookieDomain, m.SecureCookie, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallbackHandler finishes the OIDC login with the code from the provider, and logs in the user as the
+// LoginHandler does.
+func (m *JWTMiddleware) OIDCCallbackHandler(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		m.unauthorized(c, http.StatusUnauthorized, errCode+": "+c.Query("error_description"))
+		return
+	}
+	state := c.Query("state")
+	if cookie, err := c.Cookie(oidcStateCookie); err != nil || cookie != state {
+		m.unauthorized(c, http.StatusUnauthorized, auth.ErrInvalidOIDCState.Error())
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, "/auth/oidc", m.CookieDomain, m.SecureCookie, true)
+	user, err := m.authService.FinishOIDCLogin(c.Request.Context(), state, c.Query("code"))
+	if err != nil {
+		log.Warnf("failed to finish oidc login, err:%v", err)
+		m.unauthorized(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	tokenString, expire, ok := m.newSession(c, &UserInfo{UserName: user.Name, UserCredit: user.Credit})
+	if !ok {
+		return
+	}
+	if postLoginURL := m.authService.OIDCPostLoginURL(); postLoginURL != "" {
+		c.Redirect(http.StatusFound, postLoginURL)
+		return
+	}
+	m.LoginResponse(c, http.StatusOK, tokenString, expire)
+}
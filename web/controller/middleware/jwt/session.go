@@ -0,0 +1,76 @@
+package jwt
+
+import (
+	"net/http"
+
+	jwt "github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gogodjzhu/listen-tube/web/controller/middleware/interceptor"
+)
+
+// ListSessionsHandler lists the active sessions of the current user, the session of the request is marked current.
+func (m *JWTMiddleware) ListSessionsHandler(ctx *gin.Context) {
+	user := GetCurrentUser(ctx)
+	sessions, err := m.authService.ListSessions(user.UserCredit)
+	if err != nil {
+		ctx.JSON(http.StatusOK, interceptor.NewDefaultErrorResponse[[]Session](err.Error()))
+		return
+	}
+	currentJTI := currentSessionJTI(ctx)
+	result := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, Session{
+			ID:         session.ID,
+			Device:     session.Device,
+			IP:         session.IP,
+			Current:    session.JTI == currentJTI,
+			LastSeenAt: session.LastSeenAt.Unix(),
+			ExpireAt:   session.ExpireAt.Unix(),
+			CreateAt:   session.CreateAt.Unix(),
+		})
+	}
+	ctx.JSON(http.StatusOK, interceptor.NewDefaultSuccessResponse(result))
+}
+
+func (m *JWTMiddleware) RevokeSessionHandler(ctx *gin.Context) {
+	var req RevokeSessionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	user := GetCurrentUser(ctx)
+	if err := m.authService.RevokeSession(user.UserCredit, req.ID); err != nil {
+		ctx.JSON(http.StatusOK, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, interceptor.NewDefaultSuccessResponse(""))
+}
+
+// RevokeOtherSessionsHandler logs out the current user everywhere else.
+func (m *JWTMiddleware) RevokeOtherSessionsHandler(ctx *gin.Context) {
+	user := GetCurrentUser(ctx)
+	if err := m.authService.RevokeOtherSessions(user.UserCredit, currentSessionJTI(ctx)); err != nil {
+		ctx.JSON(http.StatusOK, interceptor.NewDefaultErrorResponse[string](err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, interceptor.NewDefaultSuccessResponse(""))
+}
+
+func currentSessionJTI(ctx *gin.Context) string {
+	jti, _ := jwt.ExtractClaims(ctx)["jti"].(string)
+	return jti
+}
+
+type RevokeSessionRequest struct {
+	ID uint `json:"id" binding:"required"`
+}
+
+type Session struct {
+	ID         uint   `json:"id"`
+	Device     string `json:"device"`
+	IP         string `json:"ip"`
+	Current    bool   `json:"current"`
+	LastSeenAt int64  `json:"last_seen_at"`
+	ExpireAt   int64  `json:"expire_at"`
+	CreateAt   int64  `json:"create_at"`
+}